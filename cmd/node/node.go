@@ -0,0 +1,131 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/maxgio92/homework-object-storage/internal/config"
+)
+
+const (
+	defaultGatewayURL = "http://localhost:3000"
+	defaultTimeout    = 30 * time.Second
+
+	adminTokenEnvVar = config.EnvPrefix + "ADMIN_TOKEN"
+)
+
+var (
+	errAdminTokenMissing = errors.New("admin token missing")
+)
+
+// Command represents the node command, which operates the MinIO nodes of a
+// running gateway through its admin API.
+type Command struct {
+	gatewayURL string
+	adminToken string
+	timeout    time.Duration
+
+	out io.Writer
+}
+
+// NewCmd returns a new node command.
+func NewCmd() *cobra.Command {
+	c := new(Command)
+	c.out = os.Stdout
+
+	cmd := &cobra.Command{
+		Use:               "node",
+		Short:             "Operate the MinIO nodes of a running gateway",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.PersistentFlags().StringVar(&c.gatewayURL, "gateway-url", defaultGatewayURL,
+		"The URL of the gateway")
+	cmd.PersistentFlags().StringVar(&c.adminToken, "admin-token", os.Getenv(adminTokenEnvVar),
+		fmt.Sprintf("The gateway admin API token. Defaults to the %s environment variable", adminTokenEnvVar))
+	cmd.PersistentFlags().DurationVar(&c.timeout, "timeout", defaultTimeout,
+		"The timeout of the requests to the gateway")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the nodes with their state and health",
+			Args:  cobra.NoArgs,
+			RunE: func(_ *cobra.Command, _ []string) error {
+				return c.do(http.MethodGet, "/admin/nodes")
+			},
+		},
+		c.newOperationCmd("cordon", "Stop the writes to the node", http.MethodPost, "/cordon"),
+		c.newOperationCmd("uncordon", "Restore the writes to the cordoned or drained node", http.MethodPost, "/uncordon"),
+		c.newOperationCmd("drain", "Cordon the node, and copy its objects to the nodes which store them in its place",
+			http.MethodPost, "/drain"),
+		c.newOperationCmd("remove", "Remove the drained node from the ring", http.MethodDelete, ""),
+	)
+
+	return cmd
+}
+
+// newOperationCmd returns the command of the operation on the node with the ID
+// specified as argument, e.g. 172.18.0.2:9000.
+func (c *Command) newOperationCmd(name, short, method, suffix string) *cobra.Command {
+	return &cobra.Command{
+		Use:   name + " NODE_ID",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return c.do(method, "/admin/nodes/"+url.PathEscape(args[0])+suffix)
+		},
+	}
+}
+
+// do sends the admin request to the gateway, and prints the response.
+func (c *Command) do(method, path string) error {
+	if c.adminToken == "" {
+		return errAdminTokenMissing
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.gatewayURL, "/")+path, nil)
+	if err != nil {
+		return errors.Wrap(err, "error building the admin request")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.adminToken)
+
+	client := &http.Client{Timeout: c.timeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending the admin request")
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "error reading the admin response")
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var msg string
+		if err := json.Unmarshal(body, &msg); err != nil {
+			msg = strings.TrimSpace(string(body))
+		}
+		return errors.Errorf("%s: %s", res.Status, msg)
+	}
+
+	out := &bytes.Buffer{}
+	if err := json.Indent(out, body, "", "  "); err != nil {
+		_, err = c.out.Write(body)
+		return err
+	}
+	_, err = out.WriteTo(c.out)
+
+	return err
+}
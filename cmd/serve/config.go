@@ -0,0 +1,170 @@
+package serve
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	"github.com/maxgio92/homework-object-storage/internal/config"
+	"github.com/maxgio92/homework-object-storage/pkg/credentials"
+	"github.com/maxgio92/homework-object-storage/pkg/gateway"
+)
+
+// loadConfig returns the configuration assembled from defaults, configuration file,
+// environment and flags set on the command line, in increasing order of precedence.
+func (c *Command) loadConfig(flags *pflag.FlagSet) (*config.Config, error) {
+	cfg := config.Default()
+
+	if c.configFile != "" {
+		if err := cfg.LoadFile(c.configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.LoadEnv(os.LookupEnv); err != nil {
+		return nil, errors.Wrap(err, "error loading config from environment")
+	}
+	if err := c.applyFlags(flags, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyFlags overrides the configuration with the flags set on the command line.
+func (c *Command) applyFlags(flags *pflag.FlagSet, cfg *config.Config) error {
+	overrides := map[string]func(){
+		"verbosity":                 func() { cfg.LogLevel = c.logLevel },
+		"listen-address":            func() { cfg.Server.ListenAddress = c.serverListenAddress },
+		"read-timeout":              func() { cfg.Server.ReadTimeout = c.serverReadTimeout },
+		"write-timeout":             func() { cfg.Server.WriteTimeout = c.serverWriteTimeout },
+		"idle-timeout":              func() { cfg.Server.IdleTimeout = c.serverIdleTimeout },
+		"graceful-shutdown-timeout": func() { cfg.Server.GracefulShutdownTimeout = c.serverGracefulShutdownTimeout },
+		"tls-cert-file":             func() { cfg.Server.TLS.CertFile = c.serverTLSCertFile },
+		"tls-key-file":              func() { cfg.Server.TLS.KeyFile = c.serverTLSKeyFile },
+		"tls-client-ca-file":        func() { cfg.Server.TLS.ClientCAFile = c.serverTLSClientCAFile },
+		"health-check-retries":      func() { cfg.NodePool.HealthCheckRetries = c.healthCheckRetries },
+		"health-check-interval":     func() { cfg.NodePool.HealthCheckInterval = c.healthCheckInterval },
+		"health-check-timeout":      func() { cfg.NodePool.HealthCheckTimeout = c.healthCheckTimeout },
+		"health-check-period":       func() { cfg.NodePool.HealthCheckPeriod = c.healthCheckPeriod },
+		"replication-factor":        func() { cfg.NodePool.ReplicationFactor = c.replicationFactor },
+		"virtual-nodes":             func() { cfg.NodePool.VirtualNodes = c.virtualNodes },
+		"state-file":                func() { cfg.NodePool.StateFile = c.stateFile },
+		"circuit-breaker-threshold": func() { cfg.NodePool.CircuitBreakerThreshold = c.circuitBreakerThreshold },
+		"circuit-breaker-cooldown":  func() { cfg.NodePool.CircuitBreakerCooldown = c.circuitBreakerCooldown },
+		"bucket":                    func() { cfg.Gateway.Bucket = c.bucket },
+		"region":                    func() { cfg.Gateway.Region = c.region },
+		"min-healthy-nodes":         func() { cfg.Gateway.MinHealthyNodes = c.minHealthyNodes },
+		"docker-network":            func() { cfg.Discovery.Network = c.dockerNetwork },
+		"minio-label":               func() { cfg.Discovery.LabelSelector = c.minioDockerContainerSelector },
+		"minio-port":                func() { cfg.Discovery.Port = c.minioPort },
+		"minio-access-key-env-var":  func() { cfg.Discovery.AccessKeyEnvVars = c.minioAccessKeyEnvVars },
+		"minio-secret-key-env-var":  func() { cfg.Discovery.SecretKeyEnvVars = c.minioSecretKeyEnvVars },
+		"metrics":                   func() { cfg.Metrics.Enabled = c.metricsEnabled },
+		"metrics-path":              func() { cfg.Metrics.Path = c.metricsPath },
+		"tracing":                   func() { cfg.Tracing.Enabled = c.tracingEnabled },
+		"tracing-endpoint":          func() { cfg.Tracing.Endpoint = c.tracingEndpoint },
+		"tracing-insecure":          func() { cfg.Tracing.Insecure = c.tracingInsecure },
+		"tracing-sample-ratio":      func() { cfg.Tracing.SampleRatio = c.tracingSampleRatio },
+		"access-log":                func() { cfg.AccessLog.Enabled = c.accessLogEnabled },
+		"access-log-sample-ratio":   func() { cfg.AccessLog.SampleRatio = c.accessLogSampleRatio },
+	}
+	for name, override := range overrides {
+		if flags.Changed(name) {
+			override()
+		}
+	}
+
+	if len(c.minioNodeCredentials) > 0 && cfg.Discovery.NodeCredentials == nil {
+		cfg.Discovery.NodeCredentials = make(map[string]credentials.Credentials, len(c.minioNodeCredentials))
+	}
+	for node, v := range c.minioNodeCredentials {
+		accessKey, secretKey, ok := strings.Cut(v, ":")
+		if !ok {
+			return errors.Wrapf(errNodeCredentialsNotValid, "node %s", node)
+		}
+		cfg.Discovery.NodeCredentials[node] = credentials.Credentials{
+			AccessKey: accessKey,
+			SecretKey: secretKey,
+		}
+	}
+
+	return nil
+}
+
+// reload reloads the configuration, rediscovers the MinIO nodes, and swaps the
+// gateway node pool with a new one, built and initialized with them.
+// Requests in flight complete against the previous node pool. Changes to the
+// settings which can't change at runtime are reported, as they require a restart.
+func (c *Command) reload(ctx context.Context) error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	c.logger.Info("reloading the gateway")
+
+	cfg, err := c.loadConfig(c.flags)
+	if err != nil {
+		return errors.Wrap(err, "error reloading configuration")
+	}
+
+	c.applyLogLevel(cfg)
+
+	nodePool, err := c.buildNodePool(ctx, cfg)
+	if err != nil {
+		return errors.Wrap(err, "error building the node pool")
+	}
+	if err = nodePool.Init(); err != nil {
+		return errors.Wrap(err, "error initializing the node pool")
+	}
+	if previous := c.gateway.SwapNodePool(nodePool); previous != nil {
+		previous.Close()
+	}
+
+	c.gateway.SetTimeouts(gateway.Timeouts{
+		Read:  cfg.Server.ReadTimeout,
+		Write: cfg.Server.WriteTimeout,
+	})
+	c.gateway.SetAuthenticator(buildAuthenticator(cfg))
+	if err = c.gateway.SetLimits(gatewayLimits(cfg)); err != nil {
+		return errors.Wrap(err, "error setting the limits")
+	}
+	if err = c.gateway.SetQuotas(gatewayQuotas(cfg)); err != nil {
+		return errors.Wrap(err, "error setting the quotas")
+	}
+
+	for setting, changed := range map[string]bool{
+		"server listen address": cfg.Server.ListenAddress != c.config.Server.ListenAddress,
+		"server idle timeout":   cfg.Server.IdleTimeout != c.config.Server.IdleTimeout,
+		"server tls":            cfg.Server.TLS != c.config.Server.TLS,
+		"gateway":               !reflect.DeepEqual(cfg.Gateway, c.config.Gateway),
+		"admin":                 !reflect.DeepEqual(cfg.Admin, c.config.Admin),
+		"metrics":               !reflect.DeepEqual(cfg.Metrics, c.config.Metrics),
+		"tracing":               !reflect.DeepEqual(cfg.Tracing, c.config.Tracing),
+		"access log":            !reflect.DeepEqual(cfg.AccessLog, c.config.AccessLog),
+		"quotas refresh":        cfg.Quotas.RefreshInterval != c.config.Quotas.RefreshInterval,
+		"cache":                 cfg.Cache != c.config.Cache,
+		"peers":                 !reflect.DeepEqual(cfg.Peers, c.config.Peers),
+	} {
+		if changed {
+			c.logger.Warnf("%s settings changed, a restart is required to apply them", setting)
+		}
+	}
+
+	c.config = cfg
+	c.logger.Info("gateway reloaded")
+
+	return nil
+}
+
+func (c *Command) applyLogLevel(cfg *config.Config) {
+	// The level has been validated with the configuration.
+	level, _ := log.ParseLevel(cfg.LogLevel)
+	c.logger.SetLevel(level)
+}
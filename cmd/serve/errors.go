@@ -3,5 +3,8 @@ package serve
 import "github.com/pkg/errors"
 
 var (
-	errNodesNotFound = errors.New("minio nodes not found")
+	errNodesNotFound           = errors.New("minio nodes not found")
+	errNodeWeightNotValid      = errors.New("minio node weight not valid")
+	errNodeTLSNotValid         = errors.New("minio node tls not valid")
+	errNodeCredentialsNotValid = errors.New("node credentials not valid")
 )
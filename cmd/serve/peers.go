@@ -0,0 +1,103 @@
+package serve
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/internal/config"
+	"github.com/maxgio92/homework-object-storage/pkg/certs"
+	"github.com/maxgio92/homework-object-storage/pkg/discovery"
+	"github.com/maxgio92/homework-object-storage/pkg/peers"
+)
+
+// buildPeerClient returns the client of the requests to the peer gateways,
+// which verifies their certificates when the gateway serves TLS.
+func buildPeerClient(cfg *config.Config) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Server.TLS.CertFile != "" {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.Peers.CAFile != "" {
+			pool, err := certs.LoadCertPool(cfg.Peers.CAFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "error loading peers ca bundle")
+			}
+			transport.TLSClientConfig.RootCAs = pool
+		}
+	}
+
+	return &http.Client{Transport: transport, Timeout: cfg.Peers.Timeout}, nil
+}
+
+// watchPeers rediscovers the peer gateways when their containers start and
+// stop, and every refresh interval, until the context is done. The peers are
+// rediscovered periodically only, if watching their containers fails.
+func (c *Command) watchPeers(ctx context.Context, discoverer *discovery.DockerDiscoverer, p *peers.Peers,
+	cfg *config.Config) {
+	ticker := time.NewTicker(cfg.Peers.RefreshInterval)
+	defer ticker.Stop()
+
+	events, errs := discoverer.Watch(ctx, cfg.Peers.LabelSelector)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if ok {
+				c.logger.WithError(err).Warn("error watching the peer gateways, rediscovering them periodically")
+			}
+			events, errs = nil, nil
+			continue
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		if err := c.refreshPeers(ctx, discoverer, p, cfg); err != nil {
+			c.logger.WithError(err).Warn("error discovering the peer gateways")
+		}
+	}
+}
+
+// refreshPeers discovers the peer gateways, and sets them on the ring. The
+// gateway owns every object, if it's not found among them.
+func (c *Command) refreshPeers(ctx context.Context, discoverer *discovery.DockerDiscoverer, p *peers.Peers,
+	cfg *config.Config) error {
+	endpoints, err := discoverer.DiscoverEndpoints(ctx, cfg.Peers.LabelSelector, cfg.Peers.Port)
+	if err != nil {
+		return err
+	}
+
+	scheme := "http"
+	if cfg.Server.TLS.CertFile != "" {
+		scheme = "https"
+	}
+	hostname, _ := os.Hostname()
+
+	var self string
+	urls := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		urls[i] = fmt.Sprintf("%s://%s", scheme, e.Address)
+		// Docker sets the hostname of the containers to their short ID.
+		if hostname != "" && (strings.HasPrefix(e.ID, hostname) || e.Name == hostname) {
+			self = urls[i]
+		}
+	}
+	if self == "" {
+		c.logger.Warnf("gateway %s not found among the peer gateways, not forwarding the reads", hostname)
+	}
+	p.Set(self, urls)
+	c.metrics.SetPeers(len(p.URLs()))
+	c.logger.Debugf("peer gateways: %v", p.URLs())
+
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -13,11 +15,20 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"github.com/maxgio92/homework-object-storage/internal/config"
 	"github.com/maxgio92/homework-object-storage/internal/output"
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+	"github.com/maxgio92/homework-object-storage/pkg/cache"
+	"github.com/maxgio92/homework-object-storage/pkg/certs"
+	"github.com/maxgio92/homework-object-storage/pkg/credentials"
 	"github.com/maxgio92/homework-object-storage/pkg/discovery"
 	"github.com/maxgio92/homework-object-storage/pkg/gateway"
+	"github.com/maxgio92/homework-object-storage/pkg/metrics"
 	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+	"github.com/maxgio92/homework-object-storage/pkg/peers"
+	"github.com/maxgio92/homework-object-storage/pkg/tracing"
 )
 
 // Command represents the serve command.
@@ -25,50 +36,165 @@ type Command struct {
 	logger   *log.Logger
 	logLevel string
 
+	// configFile is the path of the configuration file.
+	configFile string
+
+	// config is the configuration assembled from defaults, configuration file,
+	// environment and flags, in increasing order of precedence.
+	config *config.Config
+	flags  *pflag.FlagSet
+
+	dockerClient *client.Client
+	gateway      *gateway.Gateway
+	metrics      *metrics.Metrics
+
+	// reloadMu serializes the reloads.
+	reloadMu sync.Mutex
+
 	// Gateway's server parameters.
 	serverListenAddress string
 	serverReadTimeout   time.Duration
 	serverWriteTimeout  time.Duration
 	serverIdleTimeout   time.Duration
 
+	serverGracefulShutdownTimeout time.Duration
+
+	serverTLSCertFile     string
+	serverTLSKeyFile      string
+	serverTLSClientCAFile string
+
+	// Gateway's node pool parameters.
+	healthCheckRetries  int
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+	healthCheckPeriod   time.Duration
+	replicationFactor   int
+	virtualNodes        int
+
+	circuitBreakerThreshold int
+	circuitBreakerCooldown  time.Duration
+	stateFile               string
+
+	// Gateway's object storage parameters.
+	bucket          string
+	region          string
+	minHealthyNodes int
+
 	// Gateway's backend parameters.
+	dockerNetwork                string
 	minioDockerContainerSelector []string
-	minioAccessKeyEnvVar         string
-	minioSecretKeyEnvVar         string
+	minioPort                    uint16
+	minioAccessKeyEnvVars        []string
+	minioSecretKeyEnvVars        []string
+	minioNodeCredentials         map[string]string
+
+	// Gateway's metrics parameters.
+	metricsEnabled bool
+	metricsPath    string
+
+	// Gateway's tracing parameters.
+	tracingEnabled     bool
+	tracingEndpoint    string
+	tracingInsecure    bool
+	tracingSampleRatio float64
+
+	// Gateway's access log parameters.
+	accessLogEnabled     bool
+	accessLogSampleRatio float64
 }
 
 // NewCmd returns a new find command.
 func NewCmd() *cobra.Command {
 	c := new(Command)
+	d := config.Default()
 
 	cmd := &cobra.Command{
 		Use:               "serve",
 		Short:             fmt.Sprintf("Serve the %s", programDescription),
 		DisableAutoGenTag: true,
-		Args:              cobra.MinimumNArgs(1),
+		Args:              cobra.NoArgs,
 		RunE:              c.Run,
 		PersistentPreRun: func(_ *cobra.Command, _ []string) {
 			c.initLogs()
 		},
 	}
 
-	cmd.PersistentFlags().StringVarP(&c.logLevel, "verbosity", "v", log.DebugLevel.String(),
+	cmd.PersistentFlags().StringVarP(&c.logLevel, "verbosity", "v", d.LogLevel,
 		"The log verbosity level.")
 
-	cmd.Flags().StringVarP(&c.serverListenAddress, "listen-address", "l", serverListenAddress,
+	cmd.Flags().StringVarP(&c.configFile, "config", "c", "",
+		fmt.Sprintf("The YAML or TOML configuration file. Settings can be overridden with %s* environment variables, and flags",
+			config.EnvPrefix))
+	cmd.Flags().StringVarP(&c.serverListenAddress, "listen-address", "l", d.Server.ListenAddress,
 		"The address to listen on.")
-	cmd.Flags().DurationVar(&c.serverReadTimeout, "read-timeout", serverReadTimeout,
+	cmd.Flags().DurationVar(&c.serverReadTimeout, "read-timeout", d.Server.ReadTimeout,
 		"Server read timeout")
-	cmd.Flags().DurationVar(&c.serverWriteTimeout, "write-timeout", serverWriteTimeout,
+	cmd.Flags().DurationVar(&c.serverWriteTimeout, "write-timeout", d.Server.WriteTimeout,
 		"Server write timeout")
-	cmd.Flags().DurationVar(&c.serverIdleTimeout, "idle-timeout", serverIdleTimeout,
+	cmd.Flags().DurationVar(&c.serverIdleTimeout, "idle-timeout", d.Server.IdleTimeout,
 		"Server idle timeout")
-	cmd.Flags().StringSliceVar(&c.minioDockerContainerSelector, "minio-label", minIoDockerContainerLabelSelector,
+	cmd.Flags().DurationVar(&c.serverGracefulShutdownTimeout, "graceful-shutdown-timeout", d.Server.GracefulShutdownTimeout,
+		"Server graceful shutdown timeout")
+	cmd.Flags().StringVar(&c.serverTLSCertFile, "tls-cert-file", d.Server.TLS.CertFile,
+		"The TLS certificate file. The gateway serves in cleartext when empty")
+	cmd.Flags().StringVar(&c.serverTLSKeyFile, "tls-key-file", d.Server.TLS.KeyFile,
+		"The TLS private key file")
+	cmd.Flags().StringVar(&c.serverTLSClientCAFile, "tls-client-ca-file", d.Server.TLS.ClientCAFile,
+		"The CA bundle file the TLS client certificates are verified against")
+	cmd.Flags().IntVar(&c.healthCheckRetries, "health-check-retries", d.NodePool.HealthCheckRetries,
+		"The number of connection attempts to each MinIO node on startup")
+	cmd.Flags().DurationVar(&c.healthCheckInterval, "health-check-interval", d.NodePool.HealthCheckInterval,
+		"The interval between connection attempts to each MinIO node on startup")
+	cmd.Flags().DurationVar(&c.healthCheckTimeout, "health-check-timeout", d.NodePool.HealthCheckTimeout,
+		"The timeout of each connection attempt to MinIO nodes")
+	cmd.Flags().DurationVar(&c.healthCheckPeriod, "health-check-period", d.NodePool.HealthCheckPeriod,
+		"The period of the MinIO nodes health checks after startup. Zero disables them")
+	cmd.Flags().IntVar(&c.replicationFactor, "replication-factor", d.NodePool.ReplicationFactor,
+		"The number of MinIO nodes each object is stored on")
+	cmd.Flags().IntVar(&c.virtualNodes, "virtual-nodes", d.NodePool.VirtualNodes,
+		"The number of virtual nodes of each MinIO node on the ring, per weight unit")
+	cmd.Flags().IntVar(&c.circuitBreakerThreshold, "circuit-breaker-threshold", d.NodePool.CircuitBreakerThreshold,
+		"The number of consecutive failures which stop the requests to a MinIO node")
+	cmd.Flags().DurationVar(&c.circuitBreakerCooldown, "circuit-breaker-cooldown", d.NodePool.CircuitBreakerCooldown,
+		"The time the requests to a failing MinIO node are stopped for")
+	cmd.Flags().StringVar(&c.stateFile, "state-file", d.NodePool.StateFile,
+		"The file the cordoned, drained and removed MinIO nodes are persisted to")
+	cmd.Flags().StringVar(&c.bucket, "bucket", d.Gateway.Bucket,
+		"The bucket objects are stored in")
+	cmd.Flags().StringVar(&c.region, "region", d.Gateway.Region,
+		"The region of the bucket objects are stored in")
+	cmd.Flags().IntVar(&c.minHealthyNodes, "min-healthy-nodes", d.Gateway.MinHealthyNodes,
+		"The minimum number of healthy MinIO nodes for the gateway to be ready")
+	cmd.Flags().StringVar(&c.dockerNetwork, "docker-network", d.Discovery.Network,
+		"The Docker network the MinIO containers are reachable at. Defaults to the network shared with the gateway container")
+	cmd.Flags().StringSliceVar(&c.minioDockerContainerSelector, "minio-label", d.Discovery.LabelSelector,
 		"The label selector for MinIO Docker containers")
-	cmd.Flags().StringVar(&c.minioAccessKeyEnvVar, "minio-access-key-env-var", minioEnvAccessKey,
-		"The environment variable name of the MinIO access key")
-	cmd.Flags().StringVar(&c.minioSecretKeyEnvVar, "minio-secret-key-env-var", minioEnvSecretKey,
-		"The environment variable name of the MinIO secret key")
+	cmd.Flags().Uint16Var(&c.minioPort, "minio-port", d.Discovery.Port,
+		fmt.Sprintf("The MinIO port. Defaults to the %s container label, or the lowest exposed port", discovery.DefaultPortLabel))
+	cmd.Flags().StringSliceVar(&c.minioAccessKeyEnvVars, "minio-access-key-env-var", d.Discovery.AccessKeyEnvVars,
+		"The environment variable names of the MinIO access key, in order of precedence. "+
+			"The *_FILE variant of each is read from the container filesystem")
+	cmd.Flags().StringSliceVar(&c.minioSecretKeyEnvVars, "minio-secret-key-env-var", d.Discovery.SecretKeyEnvVars,
+		"The environment variable names of the MinIO secret key, in order of precedence. "+
+			"The *_FILE variant of each is read from the container filesystem")
+	cmd.Flags().StringToStringVar(&c.minioNodeCredentials, "minio-node-credentials", nil,
+		"Per-node MinIO credentials overrides, in the form <container name|id|address>=<access key>:<secret key>")
+	cmd.Flags().BoolVar(&c.metricsEnabled, "metrics", d.Metrics.Enabled,
+		"Expose the Prometheus metrics")
+	cmd.Flags().StringVar(&c.metricsPath, "metrics-path", d.Metrics.Path,
+		"The path the Prometheus metrics are exposed at")
+	cmd.Flags().BoolVar(&c.tracingEnabled, "tracing", d.Tracing.Enabled,
+		"Export the OpenTelemetry traces")
+	cmd.Flags().StringVar(&c.tracingEndpoint, "tracing-endpoint", d.Tracing.Endpoint,
+		"The host:port address of the OTLP over HTTP collector")
+	cmd.Flags().BoolVar(&c.tracingInsecure, "tracing-insecure", d.Tracing.Insecure,
+		"Disable TLS to the OTLP collector")
+	cmd.Flags().Float64Var(&c.tracingSampleRatio, "tracing-sample-ratio", d.Tracing.SampleRatio,
+		"The ratio of the traces sampled, when not propagated")
+	cmd.Flags().BoolVar(&c.accessLogEnabled, "access-log", d.AccessLog.Enabled,
+		"Write the access logs to the standard output")
+	cmd.Flags().Float64Var(&c.accessLogSampleRatio, "access-log-sample-ratio", d.AccessLog.SampleRatio,
+		"The ratio of the successful requests logged. The failed requests are always logged")
 
 	return cmd
 }
@@ -81,87 +207,407 @@ func (c *Command) initLogs() {
 	c.logger = logger
 }
 
-func (c *Command) Run(_ *cobra.Command, _ []string) error {
+func (c *Command) Run(cmd *cobra.Command, _ []string) error {
+	c.flags = cmd.Flags()
+
+	cfg, err := c.loadConfig(c.flags)
+	if err != nil {
+		return err
+	}
+	c.config = cfg
+	c.applyLogLevel(cfg)
+
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+
 	// Build the Docker client.
 	c.logger.Debug("building docker client")
 
-	dockerC, err := client.NewClientWithOpts(client.FromEnv)
+	c.dockerClient, err = client.NewClientWithOpts(client.FromEnv)
 	if err != nil {
 		return errors.Wrap(err, "error building docker client")
 	}
-	c.logger.Debug("discovery minio docker endpoints")
 
-	// Discover the MinIO Docker containers.
-	endpoints, err := discovery.NewDockerDiscovererFromClient(
-		dockerC,
-		discovery.WithNetwork(dockerNetworkName),
-	).DiscoverEndpoints(
-		context.Background(),
-		c.minioDockerContainerSelector,
-		minioPort,
-	)
-	if err != nil {
-		return errors.Wrap(err, "error getting minio endpoints")
+	// Build the Prometheus metrics, which survive reloads.
+	if cfg.Metrics.Enabled {
+		c.metrics = metrics.New()
 	}
-	if len(endpoints) == 0 {
-		return errNodesNotFound
-	}
-	c.logger.Debug("building minio node pool config")
 
 	// Build the MinIO node pool as the gateway backend.
-	nodeConfigs := make([]*nodepool.NodeConfig, len(endpoints))
-	for i := 0; i < len(endpoints); i++ {
-		nodeConfigs[i] = nodepool.NewNodeConfig(
-			endpoints[i].Address,
-			endpoints[i].Env[c.minioAccessKeyEnvVar],
-			endpoints[i].Env[c.minioSecretKeyEnvVar],
-		)
+	backend, err := c.buildNodePool(context.Background(), cfg)
+	if err != nil {
+		return err
 	}
-
-	backend := nodepool.NewNodePool(
-		nodepool.WithNodeConfigs(nodeConfigs...),
-		nodepool.WithLogger(c.logger),
-	)
 	c.logger.Debug("building minio gateway")
 
 	// Build the MinIO gateway.
 	srv := &http.Server{
-		Addr:         c.serverListenAddress,
-		WriteTimeout: c.serverWriteTimeout,
-		ReadTimeout:  c.serverReadTimeout,
-		IdleTimeout:  c.serverIdleTimeout,
+		Addr:         cfg.Server.ListenAddress,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+	if cfg.Server.TLS.CertFile != "" {
+		reloader, err := c.buildCertReloader(cfg)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = reloader.TLSConfig()
+
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go reloader.Watch(watchCtx)
 	}
 
-	gtw := gateway.NewGateway(
+	opts := []gateway.Option{
 		gateway.WithLogger(c.logger),
 		gateway.WithHTTPServer(srv),
 		gateway.WithNodePool(backend),
-	)
+		gateway.WithBucket(cfg.Gateway.Bucket),
+		gateway.WithRegion(cfg.Gateway.Region),
+		gateway.WithMinHealthyNodes(cfg.Gateway.MinHealthyNodes),
+		gateway.WithAdminToken(cfg.Admin.Token),
+		gateway.WithReloadFunc(c.reload),
+		gateway.WithLimits(gatewayLimits(cfg)),
+		gateway.WithMaxObjectSize(cfg.Gateway.MaxObjectSize),
+		gateway.WithQuotas(gatewayQuotas(cfg)),
+	}
+	if c.metrics != nil {
+		opts = append(opts, gateway.WithMetrics(c.metrics, cfg.Metrics.Path))
+	}
+	if authenticator := buildAuthenticator(cfg); authenticator != nil {
+		opts = append(opts, gateway.WithAuthenticator(authenticator))
+	}
+	if cfg.Auth.Presign.BaseURL != "" {
+		opts = append(opts, gateway.WithPresignBaseURL(cfg.Auth.Presign.BaseURL))
+	}
+	if cfg.Cache.Enabled {
+		opts = append(opts, gateway.WithCache(cache.New(
+			cache.WithMaxBytes(cfg.Cache.MaxBytes),
+			cache.WithTTL(cfg.Cache.TTL),
+			cache.WithMaxObjectSize(cfg.Cache.MaxObjectSize),
+		)))
+	}
+	if cfg.Cache.Disk.Dir != "" {
+		diskCache, err := cache.OpenDisk(cfg.Cache.Disk.Dir,
+			cache.WithDiskMaxBytes(cfg.Cache.Disk.MaxBytes),
+			cache.WithDiskMaxObjectSize(cfg.Cache.Disk.MaxObjectSize),
+			cache.WithDiskEviction(cache.DiskEviction(cfg.Cache.Disk.Eviction)),
+		)
+		if err != nil {
+			return errors.Wrap(err, "error opening the disk cache")
+		}
+		opts = append(opts, gateway.WithDiskCache(diskCache))
+	}
+	if cfg.Peers.Enabled {
+		peerClient, err := buildPeerClient(cfg)
+		if err != nil {
+			return err
+		}
+		p := peers.New(peers.WithVirtualNodes(cfg.Peers.VirtualNodes))
+		discoverer := discovery.NewDockerDiscovererFromClient(
+			c.dockerClient,
+			discovery.WithNetwork(cfg.Discovery.Network),
+			discovery.WithDockerLogger(c.logger),
+		)
+		if err = c.refreshPeers(context.Background(), discoverer, p, cfg); err != nil {
+			c.logger.WithError(err).Warn("error discovering the peer gateways")
+		}
+
+		peersCtx, stopPeers := context.WithCancel(context.Background())
+		defer stopPeers()
+		go c.watchPeers(peersCtx, discoverer, p, cfg)
+		opts = append(opts, gateway.WithPeers(p, cfg.Peers.Token, peerClient))
+	}
+
+	if cfg.AccessLog.Enabled {
+		accessLogger := output.NewJSONLogger(
+			output.WithOutput(os.Stdout),
+			output.WithLevel(log.InfoLevel.String()),
+		)
+		opts = append(opts, gateway.WithAccessLog(accessLogger, cfg.AccessLog.SampleRatio))
+	}
+
+	// Build the OpenTelemetry tracer provider.
+	if cfg.Tracing.Enabled {
+		tp, err := tracing.NewTracerProvider(context.Background(),
+			tracing.WithEndpoint(cfg.Tracing.Endpoint),
+			tracing.WithInsecure(cfg.Tracing.Insecure),
+			tracing.WithSampleRatio(cfg.Tracing.SampleRatio),
+			tracing.WithServiceName(cfg.Tracing.ServiceName),
+		)
+		if err != nil {
+			return errors.Wrap(err, "error building tracer provider")
+		}
+		defer func() {
+			if err := tp.Shutdown(context.Background()); err != nil {
+				c.logger.WithError(err).Error("error shutting down the tracer provider")
+			}
+		}()
+		opts = append(opts, gateway.WithTracerProvider(tp))
+	}
+	c.gateway = gateway.NewGateway(opts...)
+
+	// The quotas can be enabled on reload, so their usage is always refreshed.
+	quotasCtx, stopQuotas := context.WithCancel(context.Background())
+	defer stopQuotas()
+	go c.gateway.WatchQuotaUsage(quotasCtx, cfg.Quotas.RefreshInterval)
 
 	// Run the MinIO gateway.
 	go func() {
-		c.logger.Infof("Gateway listening at: %s", c.serverListenAddress)
+		c.logger.Infof("Gateway listening at: %s", cfg.Server.ListenAddress)
 
-		if err := gtw.Run(); err != nil {
+		if err := c.gateway.Run(); err != nil {
 			c.logger.Fatal(errors.Wrap(err, "error running the gateway"))
 		}
 	}()
 
-	// Wait for termination.
-	<-signalCh
+	// Wait for termination, reloading on demand.
+	for wait := true; wait; {
+		select {
+		case <-reloadCh:
+			if err := c.reload(context.Background()); err != nil {
+				c.logger.WithError(err).Error("error reloading the gateway")
+			}
+		case <-signalCh:
+			wait = false
+		}
+	}
 	c.logger.Println("Terminating the gateway...")
 
 	// Gracefully shut down the gateway.
-	ctx, cancel := context.WithTimeout(context.Background(), serverGracefulShutdownTimeout)
+	c.reloadMu.Lock()
+	shutdownTimeout := c.config.Server.GracefulShutdownTimeout
+	c.reloadMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
-	if err := gtw.Shutdown(ctx); err != nil {
+	if err := c.gateway.Shutdown(ctx); err != nil {
 		c.logger.Fatal(errors.Wrap(err, "error shutting down the gateway"))
 		return err
 	}
 
 	return nil
 }
+
+// buildNodePool discovers the MinIO nodes and returns the node pool to serve them.
+// The node pool is not initialized.
+func (c *Command) buildNodePool(ctx context.Context, cfg *config.Config) (*nodepool.NodePool, error) {
+	c.logger.Debug("discovery minio docker endpoints")
+
+	// Discover the MinIO Docker containers.
+	discoverer := discovery.NewDockerDiscovererFromClient(
+		c.dockerClient,
+		discovery.WithNetwork(cfg.Discovery.Network),
+		discovery.WithDockerLogger(c.logger),
+	)
+	endpoints, err := discoverer.DiscoverEndpoints(
+		ctx,
+		cfg.Discovery.LabelSelector,
+		cfg.Discovery.Port,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting minio endpoints")
+	}
+	if len(endpoints) == 0 {
+		return nil, errNodesNotFound
+	}
+	c.logger.Debug("building minio node pool config")
+
+	// Resolve the MinIO credentials.
+	resolver := c.buildCredentialsResolver(discoverer, cfg)
+
+	nodeConfigs := make([]*nodepool.NodeConfig, len(endpoints))
+	for i := 0; i < len(endpoints); i++ {
+		creds, err := resolver.Resolve(ctx, endpoints[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "error resolving credentials of minio node %s", endpoints[i].Name)
+		}
+		weight, err := nodeWeight(endpoints[i])
+		if err != nil {
+			return nil, err
+		}
+		opts := []nodepool.NodeConfigOption{nodepool.WithWeight(weight)}
+
+		nodeTLS, err := nodeTLS(endpoints[i], cfg.Discovery.TLS)
+		if err != nil {
+			return nil, err
+		}
+		if nodeTLS != nil {
+			if nodeTLS.InsecureSkipVerify {
+				c.logger.Warnf("the certificate of minio node %s is not verified", endpoints[i].Name)
+			}
+			opts = append(opts, nodepool.WithTLS(*nodeTLS))
+		}
+		nodeConfigs[i] = nodepool.NewNodeConfig(
+			endpoints[i].Address,
+			creds.AccessKey,
+			creds.SecretKey,
+			opts...,
+		)
+	}
+
+	return nodepool.NewNodePool(
+		nodepool.WithNodeConfigs(nodeConfigs...),
+		nodepool.WithLogger(c.logger),
+		nodepool.WithHealthCheckRetries(cfg.NodePool.HealthCheckRetries),
+		nodepool.WithHealthCheckInterval(cfg.NodePool.HealthCheckInterval),
+		nodepool.WithHealthCheckTimeout(cfg.NodePool.HealthCheckTimeout),
+		nodepool.WithHealthCheckPeriod(cfg.NodePool.HealthCheckPeriod),
+		nodepool.WithReplicationFactor(cfg.NodePool.ReplicationFactor),
+		nodepool.WithVirtualNodes(cfg.NodePool.VirtualNodes),
+		nodepool.WithCircuitBreaker(cfg.NodePool.CircuitBreakerThreshold, cfg.NodePool.CircuitBreakerCooldown),
+		nodepool.WithStateFile(cfg.NodePool.StateFile),
+		nodepool.WithMaxConcurrentRequests(cfg.Limits.NodeMaxConcurrentRequests),
+		nodepool.WithBuckets(cfg.Gateway.Region, cfg.Gateway.Bucket),
+		nodepool.WithMetrics(c.metrics),
+	), nil
+}
+
+// nodeWeight returns the weight of the node from the endpoint weight label, or 1.
+func nodeWeight(endpoint discovery.Endpoint) (int, error) {
+	v, ok := endpoint.Labels[discovery.WeightLabel]
+	if !ok {
+		return 1, nil
+	}
+
+	weight, err := strconv.Atoi(v)
+	if err != nil || weight < 1 {
+		return 0, errors.Wrapf(errNodeWeightNotValid, "label %s=%s of node %s", discovery.WeightLabel, v, endpoint.Name)
+	}
+
+	return weight, nil
+}
+
+// nodeTLS returns the TLS of the node, from the defaults overridden by the
+// endpoint TLS labels, or nil if it's disabled.
+func nodeTLS(endpoint discovery.Endpoint, defaults config.NodeTLSConfig) (*nodepool.NodeTLS, error) {
+	enabled := defaults.Enabled
+	nodeTLS := &nodepool.NodeTLS{
+		CAFile:             defaults.CAFile,
+		InsecureSkipVerify: defaults.InsecureSkipVerify,
+	}
+
+	for label, override := range map[string]func(v string) error{
+		discovery.TLSLabel: func(v string) (err error) {
+			enabled, err = strconv.ParseBool(v)
+			return err
+		},
+		discovery.TLSInsecureSkipVerifyLabel: func(v string) (err error) {
+			nodeTLS.InsecureSkipVerify, err = strconv.ParseBool(v)
+			return err
+		},
+		discovery.TLSCAFileLabel: func(v string) error {
+			nodeTLS.CAFile = v
+			return nil
+		},
+		discovery.TLSServerNameLabel: func(v string) error {
+			nodeTLS.ServerName = v
+			return nil
+		},
+	} {
+		v, ok := endpoint.Labels[label]
+		if !ok {
+			continue
+		}
+		if err := override(v); err != nil {
+			return nil, errors.Wrapf(errNodeTLSNotValid, "label %s=%s of node %s", label, v, endpoint.Name)
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	return nodeTLS, nil
+}
+
+// buildCertReloader returns the reloader of the TLS certificate of the server,
+// and of the client CAs if any.
+func (c *Command) buildCertReloader(cfg *config.Config) (*certs.Reloader, error) {
+	opts := []certs.Option{
+		certs.WithLogger(c.logger),
+		certs.WithReloadInterval(cfg.Server.TLS.ReloadInterval),
+	}
+	if cfg.Server.TLS.ClientCAFile != "" {
+		opts = append(opts, certs.WithClientCA(cfg.Server.TLS.ClientCAFile, cfg.Server.TLS.RequireClientCert))
+	}
+
+	reloader, err := certs.NewReloader(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading the server tls certificate")
+	}
+
+	return reloader, nil
+}
+
+// gatewayLimits returns the limits of the requests of the configuration.
+func gatewayLimits(cfg *config.Config) gateway.Limits {
+	return gateway.Limits{
+		ClientRate:                cfg.Limits.ClientRate,
+		ClientBurst:               cfg.Limits.ClientBurst,
+		NodeMaxConcurrentRequests: cfg.Limits.NodeMaxConcurrentRequests,
+	}
+}
+
+// gatewayQuotas returns the storage quotas of the configuration.
+func gatewayQuotas(cfg *config.Config) []gateway.Quota {
+	quotas := make([]gateway.Quota, len(cfg.Quotas.Prefixes))
+	for i, q := range cfg.Quotas.Prefixes {
+		quotas[i] = gateway.Quota{Tenant: q.Tenant, Prefix: q.Prefix, MaxBytes: q.MaxBytes, MaxObjects: q.MaxObjects}
+	}
+
+	return quotas
+}
+
+// buildAuthenticator returns the authenticator of the object routes, or nil if
+// the authentication is disabled.
+func buildAuthenticator(cfg *config.Config) *auth.Authenticator {
+	if !cfg.Auth.Enabled {
+		return nil
+	}
+
+	opts := []auth.Option{
+		auth.WithKeys(cfg.Auth.Keys...),
+		auth.WithClockSkew(cfg.Auth.ClockSkew),
+	}
+	if jwt := cfg.Auth.JWT; jwt.Enabled {
+		source := auth.JWKSFile(jwt.JWKSFile)
+		if jwt.JWKSURL != "" {
+			source = auth.JWKSURL(jwt.JWKSURL, http.DefaultClient)
+		}
+		opts = append(opts, auth.WithJWT(source,
+			auth.WithIssuer(jwt.Issuer),
+			auth.WithAudience(jwt.Audience),
+			auth.WithRoles(jwt.RolesClaim, jwt.Roles),
+			auth.WithJWKSRefreshInterval(jwt.JWKSRefreshInterval),
+			auth.WithTenantClaim(jwt.TenantClaim),
+		))
+	}
+
+	if len(cfg.Auth.ClientCertificates) > 0 {
+		opts = append(opts, auth.WithClientCertificates(cfg.Auth.ClientCertificates))
+	}
+	if cfg.Auth.Presign.Enabled {
+		opts = append(opts, auth.WithPresign(cfg.Auth.Presign.Secret, cfg.Auth.Presign.MaxExpiry))
+	}
+
+	return auth.NewAuthenticator(opts...)
+}
+
+func (c *Command) buildCredentialsResolver(reader credentials.FileReader, cfg *config.Config) *credentials.Resolver {
+	opts := []credentials.Option{
+		credentials.WithFileReader(reader),
+		credentials.WithAccessKeyEnvVars(cfg.Discovery.AccessKeyEnvVars...),
+		credentials.WithSecretKeyEnvVars(cfg.Discovery.SecretKeyEnvVars...),
+	}
+
+	for node, creds := range cfg.Discovery.NodeCredentials {
+		opts = append(opts, credentials.WithOverride(node, creds))
+	}
+
+	return credentials.NewResolver(opts...)
+}
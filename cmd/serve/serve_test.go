@@ -0,0 +1,154 @@
+package serve
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/internal/config"
+	"github.com/maxgio92/homework-object-storage/internal/dockertest"
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+	"github.com/maxgio92/homework-object-storage/pkg/discovery"
+)
+
+// nodeProxy forwards the connections to a MinIO node, so that the node can
+// leave and join again at the same address.
+type nodeProxy struct {
+	addr string
+
+	ln    net.Listener
+	conns []net.Conn
+	mu    sync.Mutex
+}
+
+func newNodeProxy(t *testing.T, target string) *nodeProxy {
+	t.Helper()
+
+	p := &nodeProxy{addr: "127.0.0.1:0"}
+	p.start(t, target)
+	p.addr = p.ln.Addr().String()
+	t.Cleanup(p.stop)
+
+	return p
+}
+
+// start accepts the connections, forwarding them to the target.
+func (p *nodeProxy) start(t *testing.T, target string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.ln = ln
+	p.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, conn, upstream)
+			p.mu.Unlock()
+
+			go func() { io.Copy(upstream, conn); upstream.Close() }()
+			go func() { io.Copy(conn, upstream); conn.Close() }()
+		}
+	}()
+}
+
+// stop closes the listener and the connections forwarded.
+func (p *nodeProxy) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ln.Close()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+func TestBuildNodePoolHealthChecks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	node := miniotest.NewServer()
+	defer node.Close()
+	proxy := newNodeProxy(t, node.Endpoint())
+
+	_, port, err := net.SplitHostPort(proxy.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemon := dockertest.NewServer(dockertest.Container{
+		ID: "bbbbbbbbbbbb0001", Name: "node-1",
+		Labels: map[string]string{"name": "MinIO", discovery.DefaultPortLabel: port},
+		Env:    []string{"MINIO_ROOT_USER=" + miniotest.AccessKey, "MINIO_ROOT_PASSWORD=" + miniotest.SecretKey},
+		Networks: map[string]*network.EndpointSettings{
+			"app": {IPAddress: "127.0.0.1"},
+		},
+	})
+	defer daemon.Close()
+
+	dockerClient, err := daemon.DockerClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Command{logger: logger, dockerClient: dockerClient}
+
+	// The node pool is built from the default configuration, with the period
+	// of the health checks shortened.
+	cfg := config.Default()
+	cfg.NodePool.HealthCheckRetries = 1
+	cfg.NodePool.HealthCheckPeriod = 10 * time.Millisecond
+
+	pool, err := c.buildNodePool(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pool.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if !node.BucketExists(cfg.Gateway.Bucket) {
+		t.Fatalf("got bucket %s not provisioned on init", cfg.Gateway.Bucket)
+	}
+
+	// The node leaves, and joins again with its storage lost.
+	proxy.stop()
+	waitFor(t, "node unhealthy", func() bool { return pool.HealthyNodes() == 0 })
+
+	restarted := miniotest.NewServer()
+	defer restarted.Close()
+	proxy.start(t, restarted.Endpoint())
+
+	waitFor(t, "bucket provisioned on rejoin", func() bool { return restarted.BucketExists(cfg.Gateway.Bucket) })
+}
+
+// waitFor waits up to a second for the condition to hold.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,709 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+	"github.com/maxgio92/homework-object-storage/pkg/cache"
+	"github.com/maxgio92/homework-object-storage/pkg/credentials"
+	"github.com/maxgio92/homework-object-storage/pkg/tracing"
+)
+
+var (
+	ErrFormatNotSupported = errors.New("config file format not supported")
+	ErrNotValid           = errors.New("config not valid")
+)
+
+// bucketNameRegex matches the S3 bucket naming rules.
+var bucketNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// tenantRegex matches the tenants, which suffix the gateway bucket name.
+var tenantRegex = regexp.MustCompile(`^[0-9a-z]+$`)
+
+// quotaPrefixRegex matches the prefixes of the object keys.
+var quotaPrefixRegex = regexp.MustCompile(`^[0-9a-z]{0,32}$`)
+
+// Config is the configuration of the gateway.
+type Config struct {
+	LogLevel string `yaml:"logLevel" toml:"logLevel" env:"LOG_LEVEL"`
+
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Discovery DiscoveryConfig `yaml:"discovery" toml:"discovery"`
+	NodePool  NodePoolConfig  `yaml:"nodePool" toml:"nodePool"`
+	Gateway   GatewayConfig   `yaml:"gateway" toml:"gateway"`
+	Admin     AdminConfig     `yaml:"admin" toml:"admin"`
+	Metrics   MetricsConfig   `yaml:"metrics" toml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+	AccessLog AccessLogConfig `yaml:"accessLog" toml:"accessLog"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Limits    LimitsConfig    `yaml:"limits" toml:"limits"`
+	Quotas    QuotasConfig    `yaml:"quotas" toml:"quotas"`
+	Cache     CacheConfig     `yaml:"cache" toml:"cache"`
+	Peers     PeersConfig     `yaml:"peers" toml:"peers"`
+}
+
+// ServerConfig is the configuration of the gateway HTTP server.
+type ServerConfig struct {
+	ListenAddress           string        `yaml:"listenAddress" toml:"listenAddress" env:"SERVER_LISTEN_ADDRESS"`
+	ReadTimeout             time.Duration `yaml:"readTimeout" toml:"readTimeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout            time.Duration `yaml:"writeTimeout" toml:"writeTimeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout             time.Duration `yaml:"idleTimeout" toml:"idleTimeout" env:"SERVER_IDLE_TIMEOUT"`
+	GracefulShutdownTimeout time.Duration `yaml:"gracefulShutdownTimeout" toml:"gracefulShutdownTimeout" env:"SERVER_GRACEFUL_SHUTDOWN_TIMEOUT"`
+
+	TLS TLSConfig `yaml:"tls" toml:"tls"`
+}
+
+// TLSConfig is the configuration of the TLS of the gateway listener. The
+// gateway serves in cleartext when CertFile is empty.
+type TLSConfig struct {
+	// CertFile and KeyFile are reloaded when they change, e.g. on renewals.
+	CertFile string `yaml:"certFile" toml:"certFile" env:"SERVER_TLS_CERT_FILE"`
+	KeyFile  string `yaml:"keyFile" toml:"keyFile" env:"SERVER_TLS_KEY_FILE"`
+
+	// ClientCAFile is the CA bundle the client certificates are verified
+	// against. They're not requested when empty, and required only if
+	// RequireClientCert is true.
+	ClientCAFile      string `yaml:"clientCAFile" toml:"clientCAFile" env:"SERVER_TLS_CLIENT_CA_FILE"`
+	RequireClientCert bool   `yaml:"requireClientCert" toml:"requireClientCert" env:"SERVER_TLS_REQUIRE_CLIENT_CERT"`
+
+	// ReloadInterval is the interval the files are checked for changes at.
+	ReloadInterval time.Duration `yaml:"reloadInterval" toml:"reloadInterval" env:"SERVER_TLS_RELOAD_INTERVAL"`
+}
+
+// DiscoveryConfig is the configuration of the MinIO nodes discovery.
+type DiscoveryConfig struct {
+	// Network is the Docker network the MinIO containers are reachable at.
+	// When empty, the network shared with the gateway container is used.
+	Network string `yaml:"network" toml:"network" env:"DISCOVERY_NETWORK"`
+
+	LabelSelector []string `yaml:"labelSelector" toml:"labelSelector" env:"DISCOVERY_LABEL_SELECTOR"`
+
+	// Port is the MinIO port. When zero, it's resolved for each container.
+	Port uint16 `yaml:"port" toml:"port" env:"DISCOVERY_PORT"`
+
+	AccessKeyEnvVars []string `yaml:"accessKeyEnvVars" toml:"accessKeyEnvVars" env:"DISCOVERY_ACCESS_KEY_ENV_VARS"`
+	SecretKeyEnvVars []string `yaml:"secretKeyEnvVars" toml:"secretKeyEnvVars" env:"DISCOVERY_SECRET_KEY_ENV_VARS"`
+
+	// NodeCredentials are the per-node credentials overrides, by container
+	// name, ID or address.
+	NodeCredentials map[string]credentials.Credentials `yaml:"nodeCredentials" toml:"nodeCredentials"`
+
+	// TLS is the default TLS of the connections to the MinIO nodes, overridden
+	// by the container labels of each.
+	TLS NodeTLSConfig `yaml:"tls" toml:"tls"`
+}
+
+// NodeTLSConfig is the configuration of the TLS of the connections to the MinIO nodes.
+type NodeTLSConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"DISCOVERY_TLS_ENABLED"`
+
+	// CAFile is the CA bundle the node certificates are verified against. The
+	// system roots are used when empty.
+	CAFile string `yaml:"caFile" toml:"caFile" env:"DISCOVERY_TLS_CA_FILE"`
+
+	// InsecureSkipVerify disables the verification of the node certificates,
+	// e.g. in development.
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify" toml:"insecureSkipVerify" env:"DISCOVERY_TLS_INSECURE_SKIP_VERIFY"`
+}
+
+// NodePoolConfig is the configuration of the MinIO node pool.
+type NodePoolConfig struct {
+	HealthCheckRetries  int           `yaml:"healthCheckRetries" toml:"healthCheckRetries" env:"NODEPOOL_HEALTH_CHECK_RETRIES"`
+	HealthCheckInterval time.Duration `yaml:"healthCheckInterval" toml:"healthCheckInterval" env:"NODEPOOL_HEALTH_CHECK_INTERVAL"`
+	HealthCheckTimeout  time.Duration `yaml:"healthCheckTimeout" toml:"healthCheckTimeout" env:"NODEPOOL_HEALTH_CHECK_TIMEOUT"`
+
+	// HealthCheckPeriod is the period of the health checks after startup.
+	// Zero disables them.
+	HealthCheckPeriod time.Duration `yaml:"healthCheckPeriod" toml:"healthCheckPeriod" env:"NODEPOOL_HEALTH_CHECK_PERIOD"`
+
+	// ReplicationFactor is the number of nodes each object is stored on. The
+	// replicas are written on a best-effort basis, after the primary node.
+	ReplicationFactor int `yaml:"replicationFactor" toml:"replicationFactor" env:"NODEPOOL_REPLICATION_FACTOR"`
+
+	// VirtualNodes is the number of virtual nodes of each node on the ring,
+	// per weight unit.
+	VirtualNodes int `yaml:"virtualNodes" toml:"virtualNodes" env:"NODEPOOL_VIRTUAL_NODES"`
+
+	// CircuitBreakerThreshold is the number of consecutive failures which stop
+	// the requests to a node, for CircuitBreakerCooldown.
+	CircuitBreakerThreshold int           `yaml:"circuitBreakerThreshold" toml:"circuitBreakerThreshold" env:"NODEPOOL_CIRCUIT_BREAKER_THRESHOLD"`
+	CircuitBreakerCooldown  time.Duration `yaml:"circuitBreakerCooldown" toml:"circuitBreakerCooldown" env:"NODEPOOL_CIRCUIT_BREAKER_COOLDOWN"`
+
+	// StateFile is the file the cordoned, drained and removed nodes are
+	// persisted to. They're kept in memory only, when empty.
+	StateFile string `yaml:"stateFile" toml:"stateFile" env:"NODEPOOL_STATE_FILE"`
+}
+
+// GatewayConfig is the configuration of the gateway object storage.
+type GatewayConfig struct {
+	Bucket string `yaml:"bucket" toml:"bucket" env:"GATEWAY_BUCKET"`
+	Region string `yaml:"region" toml:"region" env:"GATEWAY_REGION"`
+
+	// MinHealthyNodes is the minimum number of healthy nodes for the gateway
+	// to be ready.
+	MinHealthyNodes int `yaml:"minHealthyNodes" toml:"minHealthyNodes" env:"GATEWAY_MIN_HEALTHY_NODES"`
+
+	// MaxObjectSize is the maximum size of the objects put, in bytes. The size
+	// is not limited when zero.
+	MaxObjectSize int64 `yaml:"maxObjectSize" toml:"maxObjectSize" env:"GATEWAY_MAX_OBJECT_SIZE"`
+}
+
+// AdminConfig is the configuration of the gateway admin API.
+type AdminConfig struct {
+	// Token is the bearer token of the admin API. The admin API is disabled
+	// when it's empty.
+	Token string `yaml:"token" toml:"token" env:"ADMIN_TOKEN"`
+}
+
+// MetricsConfig is the configuration of the Prometheus metrics.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled" env:"METRICS_ENABLED"`
+	Path    string `yaml:"path" toml:"path" env:"METRICS_PATH"`
+}
+
+// TracingConfig is the configuration of the OpenTelemetry tracing.
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"TRACING_ENABLED"`
+
+	// Endpoint is the host:port address of the OTLP over HTTP collector.
+	Endpoint string `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT"`
+	Insecure bool   `yaml:"insecure" toml:"insecure" env:"TRACING_INSECURE"`
+
+	// SampleRatio is the ratio of the traces sampled, when not propagated.
+	SampleRatio float64 `yaml:"sampleRatio" toml:"sampleRatio" env:"TRACING_SAMPLE_RATIO"`
+	ServiceName string  `yaml:"serviceName" toml:"serviceName" env:"TRACING_SERVICE_NAME"`
+}
+
+// LimitsConfig is the configuration of the rate and concurrency limits of the
+// requests. They can change at runtime with the admin API, until the next reload.
+type LimitsConfig struct {
+	// ClientRate is the number of requests per second of each client, either
+	// the authenticated principal or the IP address. The requests are not
+	// rate limited when zero.
+	ClientRate float64 `yaml:"clientRate" toml:"clientRate" env:"LIMITS_CLIENT_RATE"`
+
+	// ClientBurst is the number of requests each client can send at once.
+	ClientBurst int `yaml:"clientBurst" toml:"clientBurst" env:"LIMITS_CLIENT_BURST"`
+
+	// NodeMaxConcurrentRequests is the maximum number of requests in flight to
+	// each MinIO node. The requests are not limited when zero.
+	NodeMaxConcurrentRequests int `yaml:"nodeMaxConcurrentRequests" toml:"nodeMaxConcurrentRequests" env:"LIMITS_NODE_MAX_CONCURRENT_REQUESTS"`
+}
+
+// QuotasConfig is the configuration of the storage quotas of the object key
+// prefixes, e.g. of the tenants.
+type QuotasConfig struct {
+	// RefreshInterval is the interval the storage used by the objects of the
+	// quotas is listed from the nodes at.
+	RefreshInterval time.Duration `yaml:"refreshInterval" toml:"refreshInterval" env:"QUOTAS_REFRESH_INTERVAL"`
+
+	Prefixes []QuotaConfig `yaml:"prefixes" toml:"prefixes"`
+}
+
+// QuotaConfig is the storage quota of the objects with the key prefix. The
+// limits are disabled when zero.
+type QuotaConfig struct {
+	// Tenant is the tenant of the objects. The quota applies to the objects
+	// without tenant, when empty.
+	Tenant     string `yaml:"tenant" toml:"tenant"`
+	Prefix     string `yaml:"prefix" toml:"prefix"`
+	MaxBytes   int64  `yaml:"maxBytes" toml:"maxBytes"`
+	MaxObjects int64  `yaml:"maxObjects" toml:"maxObjects"`
+}
+
+// CacheConfig is the configuration of the in-memory cache of the objects read.
+type CacheConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"CACHE_ENABLED"`
+
+	// MaxBytes is the maximum size of the objects cached. The least recently
+	// read objects are evicted over it.
+	MaxBytes int64 `yaml:"maxBytes" toml:"maxBytes" env:"CACHE_MAX_BYTES"`
+
+	// TTL is the time the objects are served from the cache for, before
+	// they're revalidated with the nodes.
+	TTL time.Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL"`
+
+	// MaxObjectSize is the maximum size of each object cached.
+	MaxObjectSize int64 `yaml:"maxObjectSize" toml:"maxObjectSize" env:"CACHE_MAX_OBJECT_SIZE"`
+
+	Disk DiskCacheConfig `yaml:"disk" toml:"disk"`
+}
+
+// DiskCacheConfig is the configuration of the cache of the objects read on
+// disk, between the cache in memory and the nodes. The objects are cached on
+// disk when Dir is not empty.
+type DiskCacheConfig struct {
+	// Dir is the directory of the cached objects, which are recovered from it
+	// on restart.
+	Dir string `yaml:"dir" toml:"dir" env:"CACHE_DISK_DIR"`
+
+	// MaxBytes is the maximum size of the objects cached on disk. The objects
+	// are evicted over it, following Eviction.
+	MaxBytes int64 `yaml:"maxBytes" toml:"maxBytes" env:"CACHE_DISK_MAX_BYTES"`
+
+	// Eviction is the policy of eviction of the objects cached on disk, either
+	// lru, evicting the least recently read first, or lfu, evicting the least
+	// frequently read first.
+	Eviction string `yaml:"eviction" toml:"eviction" env:"CACHE_DISK_EVICTION"`
+
+	// MaxObjectSize is the maximum size of each object cached on disk. The
+	// size is not limited when zero.
+	MaxObjectSize int64 `yaml:"maxObjectSize" toml:"maxObjectSize" env:"CACHE_DISK_MAX_OBJECT_SIZE"`
+}
+
+// AccessLogConfig is the configuration of the access logs.
+type AccessLogConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"ACCESS_LOG_ENABLED"`
+
+	// SampleRatio is the ratio of the successful requests logged. The failed
+	// requests are always logged.
+	SampleRatio float64 `yaml:"sampleRatio" toml:"sampleRatio" env:"ACCESS_LOG_SAMPLE_RATIO"`
+}
+
+// AuthConfig is the configuration of the authentication of the object routes.
+type AuthConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"AUTH_ENABLED"`
+
+	// Keys are the API keys, with their policies.
+	Keys []auth.Key `yaml:"keys" toml:"keys"`
+
+	// ClockSkew is the maximum age of the HMAC-signed requests, and the leeway
+	// of the JWT time claims.
+	ClockSkew time.Duration `yaml:"clockSkew" toml:"clockSkew" env:"AUTH_CLOCK_SKEW"`
+
+	JWT     JWTConfig     `yaml:"jwt" toml:"jwt"`
+	Presign PresignConfig `yaml:"presign" toml:"presign"`
+
+	// ClientCertificates are the policies of the subjects of the TLS client
+	// certificates, by distinguished name, e.g. "CN=backup,O=Acme", or common
+	// name. The client certificates are verified with server.tls.clientCAFile.
+	ClientCertificates map[string]auth.Policy `yaml:"clientCertificates" toml:"clientCertificates"`
+}
+
+// PresignConfig is the configuration of the presigned URLs, which authorize
+// single object requests without credentials.
+type PresignConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"AUTH_PRESIGN_ENABLED"`
+
+	// Secret signs the presigned URLs. The URLs issued before it changes are
+	// no longer valid.
+	Secret string `yaml:"secret" toml:"secret" env:"AUTH_PRESIGN_SECRET"`
+
+	// MaxExpiry is the maximum time the presigned URLs are valid for.
+	MaxExpiry time.Duration `yaml:"maxExpiry" toml:"maxExpiry" env:"AUTH_PRESIGN_MAX_EXPIRY"`
+
+	// BaseURL is the base of the presigned URLs, e.g. the public URL of the
+	// gateway. It's the host of the presign requests when empty.
+	BaseURL string `yaml:"baseURL" toml:"baseURL" env:"AUTH_PRESIGN_BASE_URL"`
+}
+
+// JWTConfig is the configuration of the authentication with bearer JWTs,
+// e.g. OIDC tokens.
+type JWTConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"AUTH_JWT_ENABLED"`
+
+	// JWKSURL or JWKSFile is the JSON Web Key Set of the token signing keys.
+	JWKSURL             string        `yaml:"jwksURL" toml:"jwksURL" env:"AUTH_JWT_JWKS_URL"`
+	JWKSFile            string        `yaml:"jwksFile" toml:"jwksFile" env:"AUTH_JWT_JWKS_FILE"`
+	JWKSRefreshInterval time.Duration `yaml:"jwksRefreshInterval" toml:"jwksRefreshInterval" env:"AUTH_JWT_JWKS_REFRESH_INTERVAL"`
+
+	// Issuer and Audience are required in the tokens, when not empty.
+	Issuer   string `yaml:"issuer" toml:"issuer" env:"AUTH_JWT_ISSUER"`
+	Audience string `yaml:"audience" toml:"audience" env:"AUTH_JWT_AUDIENCE"`
+
+	// RolesClaim is the claim whose values are mapped to policies by Roles.
+	RolesClaim string                 `yaml:"rolesClaim" toml:"rolesClaim" env:"AUTH_JWT_ROLES_CLAIM"`
+	Roles      map[string]auth.Policy `yaml:"roles" toml:"roles"`
+
+	// TenantClaim is the string claim of the tenant of the token subject,
+	// required in the tokens when not empty.
+	TenantClaim string `yaml:"tenantClaim" toml:"tenantClaim" env:"AUTH_JWT_TENANT_CLAIM"`
+}
+
+// PeersConfig is the configuration of the peer gateways, discovered as Docker
+// containers by label, which share the ownership of the cached objects on a
+// hash ring. The reads of the objects owned by a peer are forwarded to it.
+type PeersConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"PEERS_ENABLED"`
+
+	LabelSelector []string `yaml:"labelSelector" toml:"labelSelector" env:"PEERS_LABEL_SELECTOR"`
+
+	// Port is the port of the peers. When zero, it's resolved for each
+	// container as the one of the MinIO nodes.
+	Port uint16 `yaml:"port" toml:"port" env:"PEERS_PORT"`
+
+	// Token is the bearer token of the peer routes, shared by the peers.
+	Token string `yaml:"token" toml:"token" env:"PEERS_TOKEN"`
+
+	// VirtualNodes is the number of virtual nodes of each peer on the ring.
+	VirtualNodes int `yaml:"virtualNodes" toml:"virtualNodes" env:"PEERS_VIRTUAL_NODES"`
+
+	// RefreshInterval is the interval the peers are rediscovered at, besides
+	// when the peer containers start and stop.
+	RefreshInterval time.Duration `yaml:"refreshInterval" toml:"refreshInterval" env:"PEERS_REFRESH_INTERVAL"`
+
+	// Timeout is the timeout of the requests to the peers, which the reads
+	// fall back from to the nodes.
+	Timeout time.Duration `yaml:"timeout" toml:"timeout" env:"PEERS_TIMEOUT"`
+
+	// CAFile is the CA bundle the peer certificates are verified against,
+	// when the gateway serves TLS. The system roots are used when empty.
+	CAFile string `yaml:"caFile" toml:"caFile" env:"PEERS_CA_FILE"`
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		LogLevel: defaultLogLevel,
+		Server: ServerConfig{
+			ListenAddress:           defaultServerListenAddress,
+			ReadTimeout:             defaultServerReadTimeout,
+			WriteTimeout:            defaultServerWriteTimeout,
+			IdleTimeout:             defaultServerIdleTimeout,
+			GracefulShutdownTimeout: defaultServerGracefulShutdownTimeout,
+			TLS: TLSConfig{
+				ReloadInterval: defaultServerTLSReloadInterval,
+			},
+		},
+		Discovery: DiscoveryConfig{
+			LabelSelector:    []string{fmt.Sprintf("name=%s", defaultDockerMinIoName)},
+			AccessKeyEnvVars: credentials.DefaultAccessKeyEnvVars,
+			SecretKeyEnvVars: credentials.DefaultSecretKeyEnvVars,
+		},
+		NodePool: NodePoolConfig{
+			HealthCheckRetries:      defaultHealthCheckRetries,
+			HealthCheckInterval:     defaultHealthCheckInterval,
+			HealthCheckTimeout:      defaultHealthCheckTimeout,
+			HealthCheckPeriod:       defaultHealthCheckPeriod,
+			ReplicationFactor:       defaultReplicationFactor,
+			VirtualNodes:            defaultVirtualNodes,
+			CircuitBreakerThreshold: defaultCircuitBreakerThreshold,
+			CircuitBreakerCooldown:  defaultCircuitBreakerCooldown,
+		},
+		Gateway: GatewayConfig{
+			Bucket:          defaultGatewayBucket,
+			Region:          defaultGatewayRegion,
+			MinHealthyNodes: defaultGatewayMinHealthyNodes,
+		},
+		Quotas: QuotasConfig{
+			RefreshInterval: defaultQuotasRefreshInterval,
+		},
+		Cache: CacheConfig{
+			MaxBytes:      defaultCacheMaxBytes,
+			TTL:           defaultCacheTTL,
+			MaxObjectSize: defaultCacheMaxObjectSize,
+			Disk: DiskCacheConfig{
+				MaxBytes: defaultCacheDiskMaxBytes,
+				Eviction: defaultCacheDiskEviction,
+			},
+		},
+		Peers: PeersConfig{
+			LabelSelector:   []string{defaultPeersLabel},
+			VirtualNodes:    defaultPeersVirtualNodes,
+			RefreshInterval: defaultPeersRefreshInterval,
+			Timeout:         defaultPeersTimeout,
+		},
+		Metrics: MetricsConfig{
+			Enabled: defaultMetricsEnabled,
+			Path:    defaultMetricsPath,
+		},
+		Tracing: TracingConfig{
+			SampleRatio: defaultTracingSampleRatio,
+			ServiceName: tracing.DefaultServiceName,
+		},
+		AccessLog: AccessLogConfig{
+			Enabled:     defaultAccessLogEnabled,
+			SampleRatio: defaultAccessLogSampleRatio,
+		},
+		Auth: AuthConfig{
+			ClockSkew: defaultAuthClockSkew,
+			JWT: JWTConfig{
+				JWKSRefreshInterval: defaultJWKSRefreshInterval,
+				RolesClaim:          defaultJWTRolesClaim,
+			},
+			Presign: PresignConfig{
+				MaxExpiry: defaultPresignMaxExpiry,
+			},
+		},
+	}
+}
+
+// LoadFile overrides the configuration with the one in the file at path.
+// The format is YAML or TOML, depending on the file extension.
+// Unknown settings are reported as errors.
+func (c *Config) LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "error reading config file")
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err = dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return errors.Wrap(err, "error decoding yaml config file")
+		}
+	case ".toml":
+		md, err := toml.Decode(string(b), c)
+		if err != nil {
+			return errors.Wrap(err, "error decoding toml config file")
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return errors.Errorf("unknown config settings: %v", undecoded)
+		}
+	default:
+		return errors.Wrap(ErrFormatNotSupported, path)
+	}
+
+	return nil
+}
+
+// Validate returns an error if the configuration is not valid.
+func (c *Config) Validate() error {
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		return errors.Wrap(ErrNotValid, err.Error())
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.ListenAddress); err != nil {
+		return errors.Wrapf(ErrNotValid, "server listen address: %s", err)
+	}
+	for name, d := range map[string]time.Duration{
+		"server read timeout":                c.Server.ReadTimeout,
+		"server write timeout":               c.Server.WriteTimeout,
+		"server idle timeout":                c.Server.IdleTimeout,
+		"server graceful shutdown timeout":   c.Server.GracefulShutdownTimeout,
+		"node pool health check interval":    c.NodePool.HealthCheckInterval,
+		"node pool health check timeout":     c.NodePool.HealthCheckTimeout,
+		"node pool circuit breaker cooldown": c.NodePool.CircuitBreakerCooldown,
+	} {
+		if d <= 0 {
+			return errors.Wrapf(ErrNotValid, "%s must be positive", name)
+		}
+	}
+
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		return errors.Wrap(ErrNotValid, "server tls requires both a cert file and a key file")
+	}
+	if c.Server.TLS.CertFile == "" && c.Server.TLS.ClientCAFile != "" {
+		return errors.Wrap(ErrNotValid, "server tls client ca file requires a cert file")
+	}
+	if c.Server.TLS.RequireClientCert && c.Server.TLS.ClientCAFile == "" {
+		return errors.Wrap(ErrNotValid, "server tls client certs are required without a client ca file")
+	}
+	if c.Server.TLS.CertFile != "" && c.Server.TLS.ReloadInterval <= 0 {
+		return errors.Wrap(ErrNotValid, "server tls reload interval must be positive")
+	}
+	if len(c.Auth.ClientCertificates) > 0 && c.Server.TLS.ClientCAFile == "" {
+		return errors.Wrap(ErrNotValid, "auth client certificates require a server tls client ca file")
+	}
+
+	if len(c.Discovery.LabelSelector) == 0 {
+		return errors.Wrap(ErrNotValid, "discovery label selector is empty")
+	}
+	if len(c.Discovery.AccessKeyEnvVars) == 0 || len(c.Discovery.SecretKeyEnvVars) == 0 {
+		return errors.Wrap(ErrNotValid, "discovery credentials environment variables are empty")
+	}
+
+	if c.NodePool.HealthCheckPeriod < 0 {
+		return errors.Wrap(ErrNotValid, "node pool health check period must not be negative")
+	}
+	if c.NodePool.HealthCheckRetries < 1 {
+		return errors.Wrap(ErrNotValid, "node pool health check retries must be at least 1")
+	}
+	if c.NodePool.ReplicationFactor < 1 {
+		return errors.Wrap(ErrNotValid, "node pool replication factor must be at least 1")
+	}
+	if c.NodePool.VirtualNodes < 1 {
+		return errors.Wrap(ErrNotValid, "node pool virtual nodes must be at least 1")
+	}
+	if c.NodePool.CircuitBreakerThreshold < 1 {
+		return errors.Wrap(ErrNotValid, "node pool circuit breaker threshold must be at least 1")
+	}
+
+	if !bucketNameRegex.MatchString(c.Gateway.Bucket) {
+		return errors.Wrapf(ErrNotValid, "gateway bucket name %q", c.Gateway.Bucket)
+	}
+	if c.Gateway.Region == "" {
+		return errors.Wrap(ErrNotValid, "gateway region is empty")
+	}
+	if c.Gateway.MinHealthyNodes < 0 {
+		return errors.Wrap(ErrNotValid, "gateway minimum healthy nodes must not be negative")
+	}
+
+	if c.Metrics.Enabled && !strings.HasPrefix(c.Metrics.Path, "/") {
+		return errors.Wrapf(ErrNotValid, "metrics path %q must be absolute", c.Metrics.Path)
+	}
+
+	if c.Tracing.Enabled && c.Tracing.Endpoint == "" {
+		return errors.Wrap(ErrNotValid, "tracing endpoint is empty")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return errors.Wrapf(ErrNotValid, "tracing sample ratio %v must be between 0 and 1", c.Tracing.SampleRatio)
+	}
+	if c.AccessLog.SampleRatio < 0 || c.AccessLog.SampleRatio > 1 {
+		return errors.Wrapf(ErrNotValid, "access log sample ratio %v must be between 0 and 1", c.AccessLog.SampleRatio)
+	}
+
+	if c.Limits.ClientRate < 0 {
+		return errors.Wrap(ErrNotValid, "limits client rate must not be negative")
+	}
+	if c.Limits.ClientRate > 0 && c.Limits.ClientBurst < 1 {
+		return errors.Wrap(ErrNotValid, "limits client burst must be at least 1")
+	}
+	if c.Limits.NodeMaxConcurrentRequests < 0 {
+		return errors.Wrap(ErrNotValid, "limits node max concurrent requests must not be negative")
+	}
+
+	if c.Gateway.MaxObjectSize < 0 {
+		return errors.Wrap(ErrNotValid, "gateway max object size must not be negative")
+	}
+	if err := c.Quotas.validate(); err != nil {
+		return err
+	}
+	if c.Cache.Enabled {
+		if c.Cache.MaxBytes < 1 || c.Cache.MaxObjectSize < 1 {
+			return errors.Wrap(ErrNotValid, "cache max bytes and max object size must be at least 1")
+		}
+		if c.Cache.TTL < 0 {
+			return errors.Wrap(ErrNotValid, "cache ttl must not be negative")
+		}
+	}
+	if c.Cache.Disk.Dir != "" {
+		if c.Cache.Disk.MaxBytes < 1 {
+			return errors.Wrap(ErrNotValid, "cache disk max bytes must be at least 1")
+		}
+		if c.Cache.Disk.MaxObjectSize < 0 {
+			return errors.Wrap(ErrNotValid, "cache disk max object size must not be negative")
+		}
+		switch cache.DiskEviction(c.Cache.Disk.Eviction) {
+		case cache.DiskEvictionLRU, cache.DiskEvictionLFU:
+		default:
+			return errors.Wrapf(ErrNotValid, "cache disk eviction %q is not supported", c.Cache.Disk.Eviction)
+		}
+	}
+	if err := c.Peers.validate(c.Cache); err != nil {
+		return err
+	}
+
+	return c.Auth.validate()
+}
+
+func (c *PeersConfig) validate(cache CacheConfig) error {
+	if !c.Enabled {
+		return nil
+	}
+	if !cache.Enabled && cache.Disk.Dir == "" {
+		return errors.Wrap(ErrNotValid, "peers require the cache")
+	}
+	if len(c.LabelSelector) == 0 {
+		return errors.Wrap(ErrNotValid, "peers label selector is empty")
+	}
+	if c.Token == "" {
+		return errors.Wrap(ErrNotValid, "peers token is empty")
+	}
+	if c.VirtualNodes < 1 {
+		return errors.Wrap(ErrNotValid, "peers virtual nodes must be at least 1")
+	}
+	if c.RefreshInterval <= 0 || c.Timeout <= 0 {
+		return errors.Wrap(ErrNotValid, "peers refresh interval and timeout must be positive")
+	}
+
+	return nil
+}
+
+func (c *AuthConfig) validate() error {
+	if c.Enabled && len(c.Keys) == 0 && !c.JWT.Enabled && len(c.ClientCertificates) == 0 {
+		return errors.Wrap(ErrNotValid, "auth is enabled without keys, jwt nor client certificates")
+	}
+	if c.JWT.Enabled {
+		if (c.JWT.JWKSURL == "") == (c.JWT.JWKSFile == "") {
+			return errors.Wrap(ErrNotValid, "auth jwt requires either a jwks url or a jwks file")
+		}
+		if c.JWT.JWKSRefreshInterval <= 0 {
+			return errors.Wrap(ErrNotValid, "auth jwt jwks refresh interval must be positive")
+		}
+	}
+	if c.ClockSkew <= 0 {
+		return errors.Wrap(ErrNotValid, "auth clock skew must be positive")
+	}
+	if c.Presign.Enabled {
+		if !c.Enabled {
+			return errors.Wrap(ErrNotValid, "auth presign requires auth to be enabled")
+		}
+		if c.Presign.Secret == "" {
+			return errors.Wrap(ErrNotValid, "auth presign secret missing")
+		}
+		if c.Presign.MaxExpiry <= 0 {
+			return errors.Wrap(ErrNotValid, "auth presign max expiry must be positive")
+		}
+	}
+
+	ids := make(map[string]struct{}, len(c.Keys))
+	for _, k := range c.Keys {
+		if k.ID == "" || k.Secret == "" {
+			return errors.Wrap(ErrNotValid, "auth key is missing id or secret")
+		}
+		if _, ok := ids[k.ID]; ok {
+			return errors.Wrapf(ErrNotValid, "auth key %s is duplicated", k.ID)
+		}
+		ids[k.ID] = struct{}{}
+		if k.Tenant != "" && !tenantRegex.MatchString(k.Tenant) {
+			return errors.Wrapf(ErrNotValid, "auth key %s tenant %q", k.ID, k.Tenant)
+		}
+
+		for _, a := range k.Policy.Actions {
+			if a != auth.ActionRead && a != auth.ActionWrite {
+				return errors.Wrapf(ErrNotValid, "auth key %s action %q", k.ID, a)
+			}
+		}
+	}
+	for subject, policy := range c.ClientCertificates {
+		for _, a := range policy.Actions {
+			if a != auth.ActionRead && a != auth.ActionWrite {
+				return errors.Wrapf(ErrNotValid, "auth client certificate %s action %q", subject, a)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *QuotasConfig) validate() error {
+	if len(c.Prefixes) > 0 && c.RefreshInterval <= 0 {
+		return errors.Wrap(ErrNotValid, "quotas refresh interval must be positive")
+	}
+
+	prefixes := make(map[QuotaConfig]bool, len(c.Prefixes))
+	for _, q := range c.Prefixes {
+		if q.Tenant != "" && !tenantRegex.MatchString(q.Tenant) {
+			return errors.Wrapf(ErrNotValid, "quota tenant %q", q.Tenant)
+		}
+		if !quotaPrefixRegex.MatchString(q.Prefix) {
+			return errors.Wrapf(ErrNotValid, "quota prefix %q is not a valid object key prefix", q.Prefix)
+		}
+		id := QuotaConfig{Tenant: q.Tenant, Prefix: q.Prefix}
+		if prefixes[id] {
+			return errors.Wrapf(ErrNotValid, "quota prefix %q of tenant %q is duplicated", q.Prefix, q.Tenant)
+		}
+		prefixes[id] = true
+		if q.MaxBytes < 0 || q.MaxObjects < 0 {
+			return errors.Wrapf(ErrNotValid, "quota limits of prefix %q must not be negative", q.Prefix)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+	"github.com/maxgio92/homework-object-storage/pkg/credentials"
+)
+
+const yamlConfig = `
+logLevel: info
+server:
+  listenAddress: 0.0.0.0:3000
+  readTimeout: 30s
+discovery:
+  network: amazin-object-storage
+  labelSelector: [app=minio]
+  nodeCredentials:
+    node-1:
+      accessKey: ring
+      secretKey: treepotato
+nodePool:
+  healthCheckRetries: 3
+gateway:
+  bucket: objects
+`
+
+const tomlConfig = `
+logLevel = "info"
+
+[server]
+listenAddress = "0.0.0.0:3000"
+readTimeout = "30s"
+
+[discovery]
+network = "amazin-object-storage"
+labelSelector = ["app=minio"]
+
+[discovery.nodeCredentials.node-1]
+accessKey = "ring"
+secretKey = "treepotato"
+
+[nodePool]
+healthCheckRetries = 3
+
+[gateway]
+bucket = "objects"
+`
+
+func TestConfigDefault(t *testing.T) {
+	cfg := Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("got default config not valid: %v", err)
+	}
+	// The health checks after startup are on by default.
+	if got := cfg.NodePool.HealthCheckPeriod; got != defaultHealthCheckPeriod {
+		t.Errorf("got health check period %s, want %s", got, defaultHealthCheckPeriod)
+	}
+}
+
+func TestConfigLoadFile(t *testing.T) {
+	want := Default()
+	want.LogLevel = "info"
+	want.Server.ListenAddress = "0.0.0.0:3000"
+	want.Server.ReadTimeout = 30 * time.Second
+	want.Discovery.Network = "amazin-object-storage"
+	want.Discovery.LabelSelector = []string{"app=minio"}
+	want.Discovery.NodeCredentials = map[string]credentials.Credentials{
+		"node-1": {AccessKey: "ring", SecretKey: "treepotato"},
+	}
+	want.NodePool.HealthCheckRetries = 3
+	want.Gateway.Bucket = "objects"
+
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+		want    *Config
+		wantErr error
+	}{
+		{name: "with yaml file", file: "config.yaml", content: yamlConfig, want: want},
+		{name: "with toml file", file: "config.toml", content: tomlConfig, want: want},
+		{name: "with empty yaml file", file: "config.yml", content: "", want: Default()},
+		{name: "with unknown format", file: "config.json", content: "{}", wantErr: ErrFormatNotSupported},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			got := Default()
+			err := got.LoadFile(path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigLoadFileUnknownSettings(t *testing.T) {
+	for file, content := range map[string]string{
+		"config.yaml": "server:\n  listenAdress: 0.0.0.0:3000\n",
+		"config.toml": "[server]\nlistenAdress = \"0.0.0.0:3000\"\n",
+	} {
+		path := filepath.Join(t.TempDir(), file)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := Default().LoadFile(path); err == nil {
+			t.Errorf("%s: got no error, want unknown setting error", file)
+		}
+	}
+}
+
+func TestConfigLoadEnv(t *testing.T) {
+	env := map[string]string{
+		"OSG_LOG_LEVEL":                     "warn",
+		"OSG_SERVER_WRITE_TIMEOUT":          "1m",
+		"OSG_DISCOVERY_LABEL_SELECTOR":      "app=minio, tier=storage",
+		"OSG_DISCOVERY_PORT":                "9000",
+		"OSG_NODEPOOL_HEALTH_CHECK_RETRIES": "5",
+		"OSG_GATEWAY_REGION":                "eu-west-1",
+		"OSG_TRACING_SAMPLE_RATIO":          "0.25",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	want := Default()
+	want.LogLevel = "warn"
+	want.Server.WriteTimeout = time.Minute
+	want.Discovery.LabelSelector = []string{"app=minio", "tier=storage"}
+	want.Discovery.Port = 9000
+	want.NodePool.HealthCheckRetries = 5
+	want.Gateway.Region = "eu-west-1"
+	want.Tracing.SampleRatio = 0.25
+
+	got := Default()
+	if err := got.LoadEnv(lookup); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	env["OSG_DISCOVERY_PORT"] = "minio"
+	if err := Default().LoadEnv(lookup); err == nil {
+		t.Error("got no error, want parse error")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(c *Config)
+		want   error
+	}{
+		{name: "with defaults", modify: func(c *Config) {}, want: nil},
+		{name: "with log level not valid", modify: func(c *Config) { c.LogLevel = "loud" }, want: ErrNotValid},
+		{name: "with listen address not valid", modify: func(c *Config) { c.Server.ListenAddress = "3000" }, want: ErrNotValid},
+		{name: "with zero timeout", modify: func(c *Config) { c.Server.ReadTimeout = 0 }, want: ErrNotValid},
+		{name: "with empty label selector", modify: func(c *Config) { c.Discovery.LabelSelector = nil }, want: ErrNotValid},
+		{name: "with zero retries", modify: func(c *Config) { c.NodePool.HealthCheckRetries = 0 }, want: ErrNotValid},
+		{name: "with zero replication factor", modify: func(c *Config) { c.NodePool.ReplicationFactor = 0 }, want: ErrNotValid},
+		{name: "with zero virtual nodes", modify: func(c *Config) { c.NodePool.VirtualNodes = 0 }, want: ErrNotValid},
+		{name: "with zero circuit breaker threshold", modify: func(c *Config) { c.NodePool.CircuitBreakerThreshold = 0 }, want: ErrNotValid},
+		{name: "with metrics path not valid", modify: func(c *Config) { c.Metrics.Path = "metrics" }, want: ErrNotValid},
+		{name: "with tracing endpoint missing", modify: func(c *Config) { c.Tracing.Enabled = true }, want: ErrNotValid},
+		{name: "with tracing sample ratio not valid", modify: func(c *Config) { c.Tracing.SampleRatio = 2 }, want: ErrNotValid},
+		{name: "with access log sample ratio not valid", modify: func(c *Config) { c.AccessLog.SampleRatio = -1 }, want: ErrNotValid},
+		{name: "with negative health check period", modify: func(c *Config) { c.NodePool.HealthCheckPeriod = -time.Second }, want: ErrNotValid},
+		{name: "with negative min healthy nodes", modify: func(c *Config) { c.Gateway.MinHealthyNodes = -1 }, want: ErrNotValid},
+		{name: "with bucket not valid", modify: func(c *Config) { c.Gateway.Bucket = "My_Bucket" }, want: ErrNotValid},
+		{name: "with auth enabled without keys", modify: func(c *Config) { c.Auth.Enabled = true }, want: ErrNotValid},
+		{name: "with auth key without secret", modify: func(c *Config) { c.Auth.Keys = []auth.Key{{ID: "reader"}} }, want: ErrNotValid},
+		{name: "with auth key action not valid", modify: func(c *Config) {
+			c.Auth.Keys = []auth.Key{{ID: "reader", Secret: "secret", Policy: auth.Policy{Actions: []auth.Action{"delete"}}}}
+		}, want: ErrNotValid},
+		{name: "with negative gateway max object size", modify: func(c *Config) {
+			c.Gateway.MaxObjectSize = -1
+		}, want: ErrNotValid},
+		{name: "with quotas", modify: func(c *Config) {
+			c.Quotas.Prefixes = []QuotaConfig{{Prefix: "", MaxBytes: 1 << 30}, {Prefix: "tenant1", MaxObjects: 100}}
+		}},
+		{name: "with quota prefix not valid", modify: func(c *Config) {
+			c.Quotas.Prefixes = []QuotaConfig{{Prefix: "Tenant-1", MaxBytes: 1}}
+		}, want: ErrNotValid},
+		{name: "with quotas of tenants", modify: func(c *Config) {
+			c.Quotas.Prefixes = []QuotaConfig{{Prefix: "a", MaxBytes: 1}, {Tenant: "acme", Prefix: "a", MaxBytes: 1}}
+		}},
+		{name: "with quota tenant not valid", modify: func(c *Config) {
+			c.Quotas.Prefixes = []QuotaConfig{{Tenant: "Acme", MaxBytes: 1}}
+		}, want: ErrNotValid},
+		{name: "with quota prefix duplicated", modify: func(c *Config) {
+			c.Quotas.Prefixes = []QuotaConfig{{Prefix: "a", MaxBytes: 1}, {Prefix: "a", MaxObjects: 1}}
+		}, want: ErrNotValid},
+		{name: "with quotas without refresh interval", modify: func(c *Config) {
+			c.Quotas.Prefixes = []QuotaConfig{{Prefix: "a", MaxBytes: 1}}
+			c.Quotas.RefreshInterval = 0
+		}, want: ErrNotValid},
+		{name: "with limits client rate without burst", modify: func(c *Config) {
+			c.Limits.ClientRate = 10
+		}, want: ErrNotValid},
+		{name: "with limits", modify: func(c *Config) {
+			c.Limits = LimitsConfig{ClientRate: 10, ClientBurst: 20, NodeMaxConcurrentRequests: 64}
+		}},
+		{name: "with cache without max bytes", modify: func(c *Config) {
+			c.Cache.Enabled = true
+			c.Cache.MaxBytes = 0
+		}, want: ErrNotValid},
+		{name: "with disk cache without max bytes", modify: func(c *Config) {
+			c.Cache.Disk = DiskCacheConfig{Dir: "/var/cache/gateway", Eviction: "lru"}
+		}, want: ErrNotValid},
+		{name: "with disk cache eviction not supported", modify: func(c *Config) {
+			c.Cache.Disk = DiskCacheConfig{Dir: "/var/cache/gateway", MaxBytes: 1, Eviction: "fifo"}
+		}, want: ErrNotValid},
+		{name: "with disk cache", modify: func(c *Config) {
+			c.Cache.Disk = DiskCacheConfig{Dir: "/var/cache/gateway", MaxBytes: 1, Eviction: "lfu"}
+		}},
+		{name: "with peers without cache", modify: func(c *Config) {
+			c.Peers.Enabled = true
+			c.Peers.Token = "secret"
+		}, want: ErrNotValid},
+		{name: "with peers without token", modify: func(c *Config) {
+			c.Cache.Enabled = true
+			c.Peers.Enabled = true
+		}, want: ErrNotValid},
+		{name: "with peers", modify: func(c *Config) {
+			c.Cache.Enabled = true
+			c.Peers.Enabled = true
+			c.Peers.Token = "secret"
+		}},
+		{name: "with cache", modify: func(c *Config) {
+			c.Cache = CacheConfig{Enabled: true, MaxBytes: 1024, TTL: time.Minute, MaxObjectSize: 64}
+		}},
+		{name: "with server tls cert without key", modify: func(c *Config) {
+			c.Server.TLS.CertFile = "server.crt"
+		}, want: ErrNotValid},
+		{name: "with server tls client certs required without ca", modify: func(c *Config) {
+			c.Server.TLS.CertFile = "server.crt"
+			c.Server.TLS.KeyFile = "server.key"
+			c.Server.TLS.RequireClientCert = true
+		}, want: ErrNotValid},
+		{name: "with auth client certificates without ca", modify: func(c *Config) {
+			c.Auth.Enabled = true
+			c.Auth.ClientCertificates = map[string]auth.Policy{"backup": {Actions: []auth.Action{auth.ActionRead}}}
+		}, want: ErrNotValid},
+		{name: "with auth client certificates", modify: func(c *Config) {
+			c.Server.TLS = TLSConfig{CertFile: "server.crt", KeyFile: "server.key", ClientCAFile: "ca.crt",
+				RequireClientCert: true, ReloadInterval: time.Second}
+			c.Auth.Enabled = true
+			c.Auth.ClientCertificates = map[string]auth.Policy{"backup": {Actions: []auth.Action{auth.ActionRead}}}
+		}},
+		{name: "with auth presign without secret", modify: func(c *Config) {
+			c.Auth.Enabled = true
+			c.Auth.Keys = []auth.Key{{ID: "reader", Secret: "s3cr3t"}}
+			c.Auth.Presign.Enabled = true
+		}, want: ErrNotValid},
+		{name: "with auth presign without auth", modify: func(c *Config) {
+			c.Auth.Presign.Enabled = true
+			c.Auth.Presign.Secret = "s3cr3t"
+		}, want: ErrNotValid},
+		{name: "with auth jwt without jwks", modify: func(c *Config) {
+			c.Auth.Enabled = true
+			c.Auth.JWT.Enabled = true
+		}, want: ErrNotValid},
+		{name: "with auth jwt", modify: func(c *Config) {
+			c.Auth.Enabled = true
+			c.Auth.JWT.Enabled = true
+			c.Auth.JWT.JWKSURL = "https://issuer.example.com/.well-known/jwks.json"
+		}},
+		{name: "with auth keys", modify: func(c *Config) {
+			c.Auth.Enabled = true
+			c.Auth.Keys = []auth.Key{{ID: "reader", Secret: "secret", Policy: auth.Policy{Actions: []auth.Action{auth.ActionRead}}}}
+		}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.modify(c)
+			if err := c.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want error %v", err, tt.want)
+			}
+		})
+	}
+}
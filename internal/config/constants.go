@@ -0,0 +1,66 @@
+package config
+
+import (
+	"time"
+
+	"github.com/maxgio92/homework-object-storage/pkg/cache"
+)
+
+const (
+	// EnvPrefix is the prefix of the environment variables overriding the configuration.
+	EnvPrefix = "OSG_"
+
+	defaultLogLevel = "debug"
+
+	defaultServerListenAddress           = "127.0.0.1:3000"
+	defaultServerIdleTimeout             = 15 * time.Second
+	defaultServerReadTimeout             = 15 * time.Second
+	defaultServerWriteTimeout            = 15 * time.Second
+	defaultServerGracefulShutdownTimeout = 30 * time.Second
+	defaultServerTLSReloadInterval       = 10 * time.Second
+
+	defaultDockerMinIoName = "MinIO"
+
+	defaultHealthCheckRetries  = 20
+	defaultHealthCheckInterval = 1 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultHealthCheckPeriod   = 10 * time.Second
+	defaultReplicationFactor   = 1
+	defaultVirtualNodes        = 1
+
+	defaultCircuitBreakerThreshold = 5
+	defaultCircuitBreakerCooldown  = 30 * time.Second
+
+	defaultGatewayBucket = "default"
+	defaultGatewayRegion = "us-east-1"
+
+	defaultGatewayMinHealthyNodes = 1
+
+	defaultQuotasRefreshInterval = 1 * time.Minute
+
+	defaultCacheMaxBytes      = 64 << 20
+	defaultCacheTTL           = 30 * time.Second
+	defaultCacheMaxObjectSize = 1 << 20
+	defaultCacheDiskMaxBytes  = 1 << 30
+	defaultCacheDiskEviction  = string(cache.DiskEvictionLRU)
+
+	defaultPeersLabel           = "homework-object-storage.gateway"
+	defaultPeersVirtualNodes    = 64
+	defaultPeersRefreshInterval = 10 * time.Second
+	defaultPeersTimeout         = 5 * time.Second
+
+	defaultMetricsEnabled = true
+	defaultMetricsPath    = "/metrics"
+
+	defaultTracingSampleRatio = 1
+
+	defaultAccessLogEnabled     = true
+	defaultAccessLogSampleRatio = 1
+
+	defaultAuthClockSkew = 5 * time.Minute
+
+	defaultJWKSRefreshInterval = 1 * time.Hour
+	defaultJWTRolesClaim       = "scope"
+
+	defaultPresignMaxExpiry = 7 * 24 * time.Hour
+)
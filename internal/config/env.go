@@ -0,0 +1,108 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LookupEnvFunc retrieves the value of the environment variable named by the key.
+type LookupEnvFunc func(key string) (string, bool)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// LoadEnv overrides the configuration with the environment variables named as
+// the env tag of the settings, prefixed with EnvPrefix.
+// List values are comma-separated.
+func (c *Config) LoadEnv(lookup LookupEnvFunc) error {
+	return loadEnv(reflect.ValueOf(c).Elem(), lookup)
+}
+
+func loadEnv(v reflect.Value, lookup LookupEnvFunc) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		sf := v.Type().Field(i)
+
+		if field.Kind() == reflect.Struct {
+			if err := loadEnv(field, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name, ok := sf.Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		name = EnvPrefix + name
+
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(field, value); err != nil {
+			return errors.Wrapf(err, "error parsing %s", name)
+		}
+	}
+
+	return nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return errors.Errorf("type %s not supported", field.Type())
+		}
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return errors.Errorf("type %s not supported", field.Type())
+	}
+
+	return nil
+}
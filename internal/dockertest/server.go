@@ -0,0 +1,364 @@
+// Package dockertest provides a fake Docker Engine API server, to test Docker
+// clients offline.
+package dockertest
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	docker "github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+const (
+	StatusRunning = "running"
+	StatusExited  = "exited"
+
+	// apiVersion is the Docker Engine API version served.
+	apiVersion = "1.43"
+)
+
+var (
+	containerListPath    = regexp.MustCompile(`^(/v[0-9.]+)?/containers/json$`)
+	containerInspectPath = regexp.MustCompile(`^(/v[0-9.]+)?/containers/([^/]+)/json$`)
+	containerArchivePath = regexp.MustCompile(`^(/v[0-9.]+)?/containers/([^/]+)/archive$`)
+	eventsPath           = regexp.MustCompile(`^(/v[0-9.]+)?/events$`)
+)
+
+// Container is a container served by the Server.
+type Container struct {
+	ID     string
+	Name   string
+	Labels map[string]string
+	Env    []string
+
+	// Status is the container status. Defaults to running.
+	Status string
+
+	// Ports are the published ports.
+	Ports []types.Port
+
+	// ExposedPorts are the exposed ports, in the <port>/<protocol> form.
+	ExposedPorts []string
+
+	Networks map[string]*network.EndpointSettings
+
+	// Files are the file contents in the container filesystem, by path.
+	Files map[string]string
+}
+
+// Server is a fake Docker Engine API server, serving the container list,
+// inspect, archive and events endpoints.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.RWMutex
+	containers  []Container
+	subscribers map[*subscriber]struct{}
+}
+
+// subscriber is an events stream.
+type subscriber struct {
+	ch   chan events.Message
+	done chan struct{}
+}
+
+// NewServer starts and returns a new Server serving the containers.
+// The caller should call Close when finished, to shut it down.
+func NewServer(containers ...Container) *Server {
+	s := new(Server)
+	s.subscribers = make(map[*subscriber]struct{})
+	for _, c := range containers {
+		s.containers = append(s.containers, withDefaults(c))
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// DockerClient returns a new Docker client for the Server.
+func (s *Server) DockerClient() (*docker.Client, error) {
+	return docker.NewClientWithOpts(
+		docker.WithHost("tcp://"+s.Listener.Addr().String()),
+		docker.WithHTTPClient(s.Client()),
+		docker.WithVersion(apiVersion),
+	)
+}
+
+// Close closes the event streams and shuts down the Server.
+func (s *Server) Close() {
+	s.mu.Lock()
+	for sub := range s.subscribers {
+		close(sub.done)
+		delete(s.subscribers, sub)
+	}
+	s.mu.Unlock()
+
+	s.Server.Close()
+}
+
+// Start adds the container to the Server, and emits its start event.
+func (s *Server) Start(c Container) {
+	c = withDefaults(c)
+
+	s.mu.Lock()
+	s.containers = append(s.containers, c)
+	s.mu.Unlock()
+
+	s.Emit(containerEvent("start", c))
+}
+
+// Stop removes the container with the specified ID from the Server, and emits
+// its die event.
+func (s *Server) Stop(id string) {
+	s.mu.Lock()
+	var stopped *Container
+	for i, c := range s.containers {
+		if c.ID == id {
+			stopped = &c
+			s.containers = append(s.containers[:i], s.containers[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if stopped != nil {
+		s.Emit(containerEvent("die", *stopped))
+	}
+}
+
+// Emit sends the event to the subscribed event streams.
+func (s *Server) Emit(msg events.Message) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for sub := range s.subscribers {
+		select {
+		case sub.ch <- msg:
+		case <-sub.done:
+		}
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch p := r.URL.Path; {
+	case containerListPath.MatchString(p):
+		s.list(w, r)
+	case containerInspectPath.MatchString(p):
+		s.inspect(w, containerInspectPath.FindStringSubmatch(p)[2])
+	case containerArchivePath.MatchString(p):
+		s.archive(w, containerArchivePath.FindStringSubmatch(p)[2], r.URL.Query().Get("path"))
+	case eventsPath.MatchString(p):
+		s.events(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []types.Container{}
+	for _, c := range s.containers {
+		if !args.MatchKVList("label", c.Labels) || !args.ExactMatch("status", c.Status) {
+			continue
+		}
+		if args.Contains("network") {
+			found := false
+			for name := range c.Networks {
+				found = found || args.ExactMatch("network", name)
+			}
+			if !found {
+				continue
+			}
+		}
+		list = append(list, types.Container{
+			ID:              c.ID,
+			Names:           []string{"/" + c.Name},
+			Labels:          c.Labels,
+			State:           c.Status,
+			Ports:           c.Ports,
+			NetworkSettings: &types.SummaryNetworkSettings{Networks: c.Networks},
+		})
+	}
+
+	writeJSON(w, list)
+}
+
+func (s *Server) inspect(w http.ResponseWriter, id string) {
+	c := s.lookup(id)
+	if c == nil {
+		writeError(w, http.StatusNotFound, "No such container: "+id)
+		return
+	}
+
+	exposed := nat.PortSet{}
+	for _, p := range c.ExposedPorts {
+		exposed[nat.Port(p)] = struct{}{}
+	}
+
+	writeJSON(w, types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    c.ID,
+			Name:  "/" + c.Name,
+			State: &types.ContainerState{Status: c.Status, Running: c.Status == StatusRunning},
+		},
+		Config: &container.Config{
+			Env:          c.Env,
+			Labels:       c.Labels,
+			ExposedPorts: exposed,
+		},
+		NetworkSettings: &types.NetworkSettings{Networks: c.Networks},
+	})
+}
+
+func (s *Server) archive(w http.ResponseWriter, id, filePath string) {
+	c := s.lookup(id)
+	if c == nil {
+		writeError(w, http.StatusNotFound, "No such container: "+id)
+		return
+	}
+	content, ok := c.Files[filePath]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Could not find the file "+filePath+" in container "+id)
+		return
+	}
+
+	name := path.Base(filePath)
+	stat, _ := json.Marshal(types.ContainerPathStat{Name: name, Size: int64(len(content)), Mode: 0o644})
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write([]byte(content))
+	tw.Close()
+
+	w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Write(buf.Bytes())
+}
+
+// events streams the events emitted after the request, until the client goes
+// away or the Server is closed.
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sub := &subscriber{ch: make(chan events.Message), done: make(chan struct{})}
+	s.mu.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.mu.Unlock()
+
+	ctx := r.Context()
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[sub]; ok {
+			delete(s.subscribers, sub)
+			close(sub.done)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-sub.done:
+			return
+		case msg := <-sub.ch:
+			if !match(args, msg) {
+				continue
+			}
+			enc.Encode(msg)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func (s *Server) lookup(id string) *Container {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.containers {
+		if c.Name == id || strings.HasPrefix(c.ID, id) {
+			return &c
+		}
+	}
+
+	return nil
+}
+
+func match(args filters.Args, msg events.Message) bool {
+	return args.ExactMatch("type", string(msg.Type)) &&
+		args.ExactMatch("event", msg.Action) &&
+		args.MatchKVList("label", msg.Actor.Attributes)
+}
+
+func containerEvent(action string, c Container) events.Message {
+	// As the Docker daemon does, the name attribute takes precedence over labels.
+	attributes := map[string]string{}
+	for k, v := range c.Labels {
+		attributes[k] = v
+	}
+	attributes["name"] = c.Name
+
+	now := time.Now()
+
+	return events.Message{
+		Type:     events.ContainerEventType,
+		Action:   action,
+		Actor:    events.Actor{ID: c.ID, Attributes: attributes},
+		Scope:    "local",
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	}
+}
+
+func withDefaults(c Container) Container {
+	if c.Status == "" {
+		c.Status = StatusRunning
+	}
+
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
@@ -0,0 +1,553 @@
+// Package miniotest provides a fake in-memory MinIO (S3 API) server, to test
+// MinIO clients offline.
+package miniotest
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Operations served, as counted by Server.Calls.
+	OpListBuckets       = "ListBuckets"
+	OpGetBucketLocation = "GetBucketLocation"
+	OpBucketExists      = "BucketExists"
+	OpMakeBucket        = "MakeBucket"
+	OpRemoveBucket      = "RemoveBucket"
+	OpListObjects       = "ListObjects"
+	OpGetObject         = "GetObject"
+	OpStatObject        = "StatObject"
+	OpPutObject         = "PutObject"
+	OpRemoveObject      = "RemoveObject"
+
+	// AccessKey and SecretKey are conventional credentials for the Server,
+	// which doesn't verify the request signatures.
+	AccessKey = "minioadmin"
+	SecretKey = "minioadmin"
+
+	streamingPayload = "STREAMING-"
+	s3Namespace      = "http://s3.amazonaws.com/doc/2006-03-01/"
+)
+
+// Object is an object stored by the Server.
+type Object struct {
+	Data         []byte
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// Server is a fake MinIO server, storing buckets and objects in memory.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.RWMutex
+	buckets map[string]map[string]*Object
+	calls   map[string]int
+
+	// failStatus is the status code all the requests fail with, when not zero.
+	failStatus int
+
+	// latency is the delay of the responses.
+	latency time.Duration
+
+	// denied are the bucket operations denied with AccessDenied.
+	denied map[string]bool
+}
+
+// NewServer starts and returns a new Server, with the buckets.
+func NewServer(buckets ...string) *Server {
+	s := newServer(buckets...)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// NewTLSServer starts and returns a new Server with TLS, with the buckets.
+// Its certificate is returned by Certificate.
+func NewTLSServer(buckets ...string) *Server {
+	s := newServer(buckets...)
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	// The handshakes of the TCP health checks fail, and are not logged.
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.StartTLS()
+
+	return s
+}
+
+func newServer(buckets ...string) *Server {
+	s := &Server{
+		buckets: make(map[string]map[string]*Object, len(buckets)),
+		calls:   make(map[string]int),
+		denied:  make(map[string]bool),
+	}
+	for _, b := range buckets {
+		s.buckets[b] = make(map[string]*Object)
+	}
+
+	return s
+}
+
+// Endpoint returns the host:port address of the Server.
+func (s *Server) Endpoint() string {
+	return strings.TrimPrefix(strings.TrimPrefix(s.URL, "http://"), "https://")
+}
+
+// PutObject stores the object.
+func (s *Server) PutObject(bucket, key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = make(map[string]*Object)
+	}
+	s.buckets[bucket][key] = newObject(data, "application/octet-stream")
+}
+
+// Object returns the object, and whether it exists.
+func (s *Server) Object(bucket, key string) (Object, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.buckets[bucket][key]
+	if !ok {
+		return Object{}, false
+	}
+
+	return *obj, true
+}
+
+// BucketExists returns whether the bucket exists.
+func (s *Server) BucketExists(bucket string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.buckets[bucket]
+
+	return ok
+}
+
+// Calls returns the number of requests served for the operation.
+func (s *Server) Calls(op string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.calls[op]
+}
+
+// Fail makes all the requests fail with the status code. Zero restores the service.
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failStatus = status
+}
+
+// Deny makes the requests of the bucket operation, i.e. OpMakeBucket or
+// OpRemoveBucket, fail with AccessDenied, which is not retried, or restores it.
+func (s *Server) Deny(op string, denied bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.denied[op] = denied
+}
+
+// SetLatency delays the responses by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = d
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	failStatus, latency := s.failStatus, s.latency
+	s.mu.RUnlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if failStatus != 0 {
+		writeError(w, r, failStatus, "InternalError", "We encountered an internal error, please try again.", "", "")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		s.listBuckets(w)
+	case key == "" && r.Method == http.MethodGet && query.Has("location"):
+		s.getBucketLocation(w, r, bucket)
+	case key == "" && r.Method == http.MethodHead:
+		s.headBucket(w, r, bucket)
+	case key == "" && r.Method == http.MethodPut:
+		s.makeBucket(w, r, bucket)
+	case key == "" && r.Method == http.MethodDelete:
+		s.removeBucket(w, r, bucket)
+	case key == "" && r.Method == http.MethodGet:
+		s.listObjects(w, r, bucket, query)
+	case key != "" && r.Method == http.MethodGet:
+		s.getObject(w, r, bucket, key, true)
+	case key != "" && r.Method == http.MethodHead:
+		s.getObject(w, r, bucket, key, false)
+	case key != "" && r.Method == http.MethodPut:
+		s.putObject(w, r, bucket, key)
+	case key != "" && r.Method == http.MethodDelete:
+		s.removeObject(w, r, bucket, key)
+	default:
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented",
+			"A header you provided implies functionality that is not implemented", bucket, key)
+	}
+}
+
+func (s *Server) count(op string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[op]++
+}
+
+// deny writes the AccessDenied error response and returns true, if the
+// operation is denied.
+func (s *Server) deny(w http.ResponseWriter, r *http.Request, op, bucket string) bool {
+	s.mu.RLock()
+	denied := s.denied[op]
+	s.mu.RUnlock()
+
+	if denied {
+		writeError(w, r, http.StatusForbidden, "AccessDenied", "Access Denied.", bucket, "")
+	}
+
+	return denied
+}
+
+func (s *Server) listBuckets(w http.ResponseWriter) {
+	s.count(OpListBuckets)
+
+	type bucketInfo struct {
+		Name         string
+		CreationDate string
+	}
+	result := struct {
+		XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+		Xmlns   string       `xml:"xmlns,attr"`
+		Buckets []bucketInfo `xml:"Buckets>Bucket"`
+	}{Xmlns: s3Namespace}
+
+	s.mu.RLock()
+	for name := range s.buckets {
+		result.Buckets = append(result.Buckets, bucketInfo{Name: name, CreationDate: time.Now().UTC().Format(time.RFC3339)})
+	}
+	s.mu.RUnlock()
+	sort.Slice(result.Buckets, func(i, j int) bool { return result.Buckets[i].Name < result.Buckets[j].Name })
+
+	writeXML(w, http.StatusOK, result)
+}
+
+func (s *Server) getBucketLocation(w http.ResponseWriter, r *http.Request, bucket string) {
+	s.count(OpGetBucketLocation)
+
+	if !s.BucketExists(bucket) {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist", bucket, "")
+		return
+	}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"LocationConstraint"`
+		Xmlns   string   `xml:"xmlns,attr"`
+	}{Xmlns: s3Namespace})
+}
+
+func (s *Server) headBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	s.count(OpBucketExists)
+
+	if !s.BucketExists(bucket) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) makeBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	s.count(OpMakeBucket)
+	if s.deny(w, r, OpMakeBucket, bucket) {
+		return
+	}
+
+	s.mu.Lock()
+	_, exists := s.buckets[bucket]
+	if !exists {
+		s.buckets[bucket] = make(map[string]*Object)
+	}
+	s.mu.Unlock()
+
+	if exists {
+		writeError(w, r, http.StatusConflict, "BucketAlreadyOwnedByYou",
+			"Your previous request to create the named bucket succeeded and you already own it.", bucket, "")
+		return
+	}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) removeBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	s.count(OpRemoveBucket)
+	if s.deny(w, r, OpRemoveBucket, bucket) {
+		return
+	}
+
+	s.mu.Lock()
+	objects, exists := s.buckets[bucket]
+	empty := len(objects) == 0
+	if exists && empty {
+		delete(s.buckets, bucket)
+	}
+	s.mu.Unlock()
+
+	switch {
+	case !exists:
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist", bucket, "")
+	case !empty:
+		writeError(w, r, http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty", bucket, "")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string, query url.Values) {
+	s.count(OpListObjects)
+
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+	result := struct {
+		XMLName     xml.Name  `xml:"ListBucketResult"`
+		Xmlns       string    `xml:"xmlns,attr"`
+		Name        string    `xml:"Name"`
+		Prefix      string    `xml:"Prefix"`
+		KeyCount    int       `xml:"KeyCount"`
+		MaxKeys     int       `xml:"MaxKeys"`
+		IsTruncated bool      `xml:"IsTruncated"`
+		Contents    []content `xml:"Contents"`
+	}{Xmlns: s3Namespace, Name: bucket, Prefix: query.Get("prefix"), MaxKeys: 1000}
+
+	s.mu.RLock()
+	objects, exists := s.buckets[bucket]
+	for key, obj := range objects {
+		if !strings.HasPrefix(key, result.Prefix) {
+			continue
+		}
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: obj.LastModified.UTC().Format(time.RFC3339),
+			ETag:         obj.ETag,
+			Size:         int64(len(obj.Data)),
+			StorageClass: "STANDARD",
+		})
+	}
+	s.mu.RUnlock()
+
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist", bucket, "")
+		return
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+
+	writeXML(w, http.StatusOK, result)
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string, withBody bool) {
+	if withBody {
+		s.count(OpGetObject)
+	} else {
+		s.count(OpStatObject)
+	}
+
+	s.mu.RLock()
+	objects, exists := s.buckets[bucket]
+	obj, found := objects[key]
+	s.mu.RUnlock()
+
+	switch {
+	case !exists:
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist", bucket, key)
+		return
+	case !found:
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.", bucket, key)
+		return
+	}
+
+	w.Header().Set("ETag", obj.ETag)
+	w.Header().Set("Last-Modified", obj.LastModified.UTC().Format(http.TimeFormat))
+	if match := r.Header.Get("If-None-Match"); match != "" && match == obj.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(obj.Data)))
+	w.WriteHeader(http.StatusOK)
+	if withBody {
+		w.Write(obj.Data)
+	}
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	s.count(OpPutObject)
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), streamingPayload) {
+		body = newChunkedReader(r.Body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error(), bucket, key)
+		return
+	}
+
+	obj := newObject(data, r.Header.Get("Content-Type"))
+
+	s.mu.Lock()
+	objects, exists := s.buckets[bucket]
+	if exists {
+		objects[key] = obj
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist", bucket, key)
+		return
+	}
+	w.Header().Set("ETag", obj.ETag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) removeObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	s.count(OpRemoveObject)
+
+	s.mu.Lock()
+	objects, exists := s.buckets[bucket]
+	delete(objects, key)
+	s.mu.Unlock()
+
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist", bucket, key)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newObject(data []byte, contentType string) *Object {
+	sum := md5.Sum(data)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return &Object{
+		Data:         data,
+		ContentType:  contentType,
+		ETag:         fmt.Sprintf("%q", hex.EncodeToString(sum[:])),
+		LastModified: time.Now().Truncate(time.Second),
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message, bucket, key string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	writeXML(w, status, struct {
+		XMLName    xml.Name `xml:"Error"`
+		Code       string   `xml:"Code"`
+		Message    string   `xml:"Message"`
+		BucketName string   `xml:"BucketName,omitempty"`
+		Key        string   `xml:"Key,omitempty"`
+		Resource   string   `xml:"Resource"`
+	}{Code: code, Message: message, BucketName: bucket, Key: key, Resource: r.URL.Path})
+}
+
+// chunkedReader decodes the aws-chunked content encoding of streaming signed
+// payloads, discarding the chunk signatures and the trailers.
+type chunkedReader struct {
+	r    *bufio.Reader
+	left int64
+	done bool
+}
+
+func newChunkedReader(r io.Reader) *chunkedReader {
+	return &chunkedReader{r: bufio.NewReader(r)}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.left == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > c.left {
+		p = p[:c.left]
+	}
+	n, err := c.r.Read(p)
+	c.left -= int64(n)
+	if c.left == 0 && err == nil {
+		// Discard the chunk trailing CRLF.
+		_, err = c.r.Discard(2)
+	}
+
+	return n, err
+}
+
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+	c.left, err = strconv.ParseInt(size, 16, 64)
+	if err != nil {
+		return fmt.Errorf("malformed chunk size %q: %w", size, err)
+	}
+	if c.left == 0 {
+		c.done = true
+		_, err = io.Copy(io.Discard, c.r)
+	}
+
+	return err
+}
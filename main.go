@@ -2,12 +2,23 @@ package main
 
 import (
 	"fmt"
-	"github.com/maxgio92/homework-object-storage/cmd/serve"
 	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/maxgio92/homework-object-storage/cmd/node"
+	"github.com/maxgio92/homework-object-storage/cmd/serve"
 )
 
 func main() {
-	cmd := serve.NewCmd()
+	cmd := &cobra.Command{
+		Use:               "object-storage-gateway",
+		Short:             "Object Storage Gateway",
+		DisableAutoGenTag: true,
+		SilenceUsage:      true,
+		SilenceErrors:     true,
+	}
+	cmd.AddCommand(serve.NewCmd(), node.NewCmd())
 
 	err := cmd.Execute()
 	if err != nil {
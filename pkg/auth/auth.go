@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// APIKeyHeader is the header of the static API keys.
+	APIKeyHeader = "X-API-Key"
+
+	defaultClockSkew = 5 * time.Minute
+)
+
+var (
+	ErrCredentialsMissing  = errors.New("credentials missing")
+	ErrCredentialsNotValid = errors.New("credentials not valid")
+	ErrForbidden           = errors.New("forbidden")
+)
+
+// Action is an operation on an object.
+type Action string
+
+const (
+	ActionRead  Action = "read"
+	ActionWrite Action = "write"
+)
+
+// Policy is what a key is allowed to do.
+type Policy struct {
+	// Actions are the actions allowed.
+	Actions []Action `yaml:"actions" toml:"actions"`
+
+	// Prefixes restrict the actions to the object keys with one of the
+	// prefixes. Every object key is allowed, when empty.
+	Prefixes []string `yaml:"prefixes" toml:"prefixes"`
+}
+
+// Allows returns whether the policy allows the action on the object key.
+func (p Policy) Allows(action Action, objectKey string) bool {
+	allowed := false
+	for _, a := range p.Actions {
+		if a == action {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+	if len(p.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range p.Prefixes {
+		if strings.HasPrefix(objectKey, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Key is an API key. It authenticates the requests either sent as is, or
+// used to sign them with HMAC.
+type Key struct {
+	ID     string `yaml:"id" toml:"id"`
+	Secret string `yaml:"secret" toml:"secret"`
+	Policy Policy `yaml:"policy" toml:"policy"`
+
+	// Tenant is the tenant of the key, whose objects only it can access.
+	Tenant string `yaml:"tenant" toml:"tenant"`
+}
+
+// Principal is the authenticated identity of a request.
+type Principal struct {
+	ID string
+
+	// Tenant is the tenant of the principal, whose objects only it can access.
+	// The principal can access the objects of any tenant when empty.
+	Tenant string
+
+	// Policies are what the principal is allowed to do, by any of them.
+	Policies []Policy
+}
+
+// Allows returns whether any policy of the principal allows the action on the object key.
+func (p *Principal) Allows(action Action, objectKey string) bool {
+	for _, policy := range p.Policies {
+		if policy.Allows(action, objectKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticator authenticates the requests.
+type Authenticator struct {
+	// keys are the API keys, by ID.
+	keys map[string]Key
+
+	// clockSkew is the maximum difference between the date of the signed
+	// requests and the current time.
+	clockSkew time.Duration
+
+	// jwt verifies the bearer tokens. The bearer tokens are not accepted when nil.
+	jwt *jwtVerifier
+
+	// presigner signs and verifies the presigned URLs. The presigned URLs are
+	// not accepted when nil.
+	presigner *presigner
+
+	// certSubjects are the policies of the client certificate subjects. The
+	// client certificates are not accepted when empty.
+	certSubjects map[string]Policy
+
+	now func() time.Time
+}
+
+type Option func(a *Authenticator)
+
+func WithKeys(keys ...Key) Option {
+	return func(a *Authenticator) {
+		for _, k := range keys {
+			a.keys[k.ID] = k
+		}
+	}
+}
+
+// WithClockSkew sets the maximum difference between the date of the signed
+// requests and the current time, past which the signatures are expired.
+func WithClockSkew(skew time.Duration) Option {
+	return func(a *Authenticator) {
+		a.clockSkew = skew
+	}
+}
+
+func NewAuthenticator(opts ...Option) *Authenticator {
+	a := new(Authenticator)
+	a.keys = make(map[string]Key)
+	a.clockSkew = defaultClockSkew
+	a.now = time.Now
+
+	for _, f := range opts {
+		f(a)
+	}
+
+	return a
+}
+
+// Authenticate returns the principal of the request, authenticated with either
+// a presigned URL, a static API key, an HMAC signature, a bearer JWT, or a TLS
+// client certificate, in case no other credentials are sent. The body of the
+// signed requests is replaced with one which fails reading, if it doesn't
+// match the signed hash.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if isPresigned(r) {
+		return a.authenticatePresigned(r)
+	}
+	auth := r.Header.Get("Authorization")
+	if params, ok := strings.CutPrefix(auth, hmacScheme+" "); ok {
+		return a.authenticateHMAC(r, params)
+	}
+	if token, ok := strings.CutPrefix(auth, bearerScheme+" "); ok && a.jwt != nil {
+		return a.authenticateJWT(r.Context(), token)
+	}
+	if secret := r.Header.Get(APIKeyHeader); secret != "" {
+		return a.authenticateAPIKey(secret)
+	}
+	if len(a.certSubjects) > 0 && hasClientCertificate(r) {
+		return a.authenticateClientCertificate(r)
+	}
+
+	return nil, ErrCredentialsMissing
+}
+
+// authenticateAPIKey returns the principal of the key with the secret.
+func (a *Authenticator) authenticateAPIKey(secret string) (*Principal, error) {
+	var found *Key
+	// Every key is compared, so that the time doesn't tell which ones match.
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k.Secret), []byte(secret)) == 1 {
+			k := k
+			found = &k
+		}
+	}
+	if found == nil {
+		return nil, ErrCredentialsNotValid
+	}
+
+	return &Principal{ID: found.ID, Tenant: found.Tenant, Policies: []Policy{found.Policy}}, nil
+}
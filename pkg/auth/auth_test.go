@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	readOnly := Policy{Actions: []Action{ActionRead}}
+	prefixed := Policy{Actions: []Action{ActionRead, ActionWrite}, Prefixes: []string{"logs-", "tmp"}}
+
+	testCases := []struct {
+		name   string
+		policy Policy
+		action Action
+		key    string
+		want   bool
+	}{
+		{name: "with read allowed", policy: readOnly, action: ActionRead, key: "foo", want: true},
+		{name: "with write not allowed", policy: readOnly, action: ActionWrite, key: "foo", want: false},
+		{name: "with no actions", policy: Policy{}, action: ActionRead, key: "foo", want: false},
+		{name: "with key prefix allowed", policy: prefixed, action: ActionWrite, key: "logs-1", want: true},
+		{name: "with key prefix not allowed", policy: prefixed, action: ActionWrite, key: "foo", want: false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allows(tt.action, tt.key); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorAuthenticate(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	key := Key{ID: "reader", Secret: "s3cr3t", Policy: Policy{Actions: []Action{ActionRead}}}
+	body := []byte("hello world")
+
+	newRequest := func(body []byte) *http.Request {
+		return httptest.NewRequest(http.MethodPut, "/object/foo", bytes.NewReader(body))
+	}
+
+	testCases := []struct {
+		name    string
+		request func() *http.Request
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "without credentials",
+			request: func() *http.Request { return newRequest(nil) },
+			wantErr: ErrCredentialsMissing,
+		},
+		{
+			name: "with api key",
+			request: func() *http.Request {
+				r := newRequest(nil)
+				r.Header.Set(APIKeyHeader, key.Secret)
+				return r
+			},
+			want: key.ID,
+		},
+		{
+			name: "with wrong api key",
+			request: func() *http.Request {
+				r := newRequest(nil)
+				r.Header.Set(APIKeyHeader, "wrong")
+				return r
+			},
+			wantErr: ErrCredentialsNotValid,
+		},
+		{
+			name: "with signature",
+			request: func() *http.Request {
+				r := newRequest(body)
+				Sign(r, key.ID, key.Secret, body, now.Add(-time.Minute))
+				return r
+			},
+			want: key.ID,
+		},
+		{
+			name: "with signature of unknown key",
+			request: func() *http.Request {
+				r := newRequest(body)
+				Sign(r, "writer", key.Secret, body, now)
+				return r
+			},
+			wantErr: ErrCredentialsNotValid,
+		},
+		{
+			name: "with signature of wrong secret",
+			request: func() *http.Request {
+				r := newRequest(body)
+				Sign(r, key.ID, "wrong", body, now)
+				return r
+			},
+			wantErr: ErrCredentialsNotValid,
+		},
+		{
+			name: "with signature of other path",
+			request: func() *http.Request {
+				r := newRequest(body)
+				Sign(r, key.ID, key.Secret, body, now)
+				r.URL.Path = "/object/bar"
+				return r
+			},
+			wantErr: ErrCredentialsNotValid,
+		},
+		{
+			name: "with signature of other query",
+			request: func() *http.Request {
+				r := newRequest(body)
+				r.URL.RawQuery = "b=2&a=1"
+				Sign(r, key.ID, key.Secret, body, now)
+				r.URL.RawQuery = "a=1&b=3"
+				return r
+			},
+			wantErr: ErrCredentialsNotValid,
+		},
+		{
+			name: "with signature of reordered query",
+			request: func() *http.Request {
+				r := newRequest(body)
+				r.URL.RawQuery = "b=2&a=1&a=0"
+				Sign(r, key.ID, key.Secret, body, now)
+				r.URL.RawQuery = "a=0&a=1&b=2"
+				return r
+			},
+			want: key.ID,
+		},
+		{
+			name: "with signature of other host",
+			request: func() *http.Request {
+				r := newRequest(body)
+				Sign(r, key.ID, key.Secret, body, now)
+				r.Host = "other.example.com"
+				return r
+			},
+			wantErr: ErrCredentialsNotValid,
+		},
+		{
+			name: "with signature expired",
+			request: func() *http.Request {
+				r := newRequest(body)
+				Sign(r, key.ID, key.Secret, body, now.Add(-time.Hour))
+				return r
+			},
+			wantErr: ErrSignatureExpired,
+		},
+	}
+
+	a := NewAuthenticator(WithKeys(key))
+	a.now = func() time.Time { return now }
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Authenticate(tt.request())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.ID != tt.want {
+				t.Errorf("got principal %s, want %s", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorContentHash(t *testing.T) {
+	now := time.Now()
+	key := Key{ID: "writer", Secret: "s3cr3t", Policy: Policy{Actions: []Action{ActionWrite}}}
+	a := NewAuthenticator(WithKeys(key))
+
+	testCases := []struct {
+		name    string
+		signed  []byte
+		sent    []byte
+		wantErr error
+	}{
+		{name: "with signed body", signed: []byte("hello"), sent: []byte("hello")},
+		{name: "with tampered body", signed: []byte("hello"), sent: []byte("hellO"), wantErr: ErrContentHashMismatch},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/object/foo", bytes.NewReader(tt.sent))
+			Sign(r, key.ID, key.Secret, tt.signed, now)
+
+			if _, err := a.Authenticate(r); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.ReadAll(r.Body); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v reading body, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorClientCertificate(t *testing.T) {
+	backup := Policy{Actions: []Action{ActionRead}}
+	a := NewAuthenticator(WithClientCertificates(map[string]Policy{
+		"backup":             backup,
+		"CN=uploader,O=Acme": {Actions: []Action{ActionWrite}},
+	}))
+
+	newRequest := func(subject *pkix.Name) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/object/foo", nil)
+		if subject != nil {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: *subject}}}}
+		}
+		return r
+	}
+
+	testCases := []struct {
+		name    string
+		subject *pkix.Name
+		want    string
+		wantErr error
+	}{
+		{name: "without client certificate", wantErr: ErrCredentialsMissing},
+		{name: "with common name", subject: &pkix.Name{CommonName: "backup", Organization: []string{"Acme"}}, want: "backup"},
+		{name: "with distinguished name", subject: &pkix.Name{CommonName: "uploader", Organization: []string{"Acme"}},
+			want: "CN=uploader,O=Acme"},
+		{name: "with subject not mapped", subject: &pkix.Name{CommonName: "uploader"}, wantErr: ErrCredentialsNotValid},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := a.Authenticate(newRequest(tt.subject))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && principal.ID != tt.want {
+				t.Errorf("got principal %q, want %q", principal.ID, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// WithClientCertificates enables the authentication with the verified TLS
+// client certificates, whose subjects are mapped to the policies. The subjects
+// are either distinguished names, e.g. "CN=backup,O=Acme", or common names.
+func WithClientCertificates(subjects map[string]Policy) Option {
+	return func(a *Authenticator) {
+		a.certSubjects = subjects
+	}
+}
+
+// hasClientCertificate returns whether the request is sent with a verified
+// client certificate.
+func hasClientCertificate(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0
+}
+
+// authenticateClientCertificate returns the principal of the subject of the
+// verified client certificate of the request.
+func (a *Authenticator) authenticateClientCertificate(r *http.Request) (*Principal, error) {
+	cert := r.TLS.VerifiedChains[0][0]
+	id, policy, ok := a.certSubjectPolicy(cert)
+	if !ok {
+		return nil, errors.Wrapf(ErrCredentialsNotValid, "client certificate subject %s not authorized", cert.Subject)
+	}
+
+	return &Principal{ID: id, Policies: []Policy{policy}}, nil
+}
+
+// certSubjectPolicy returns the ID and the policy of the subject of the
+// certificate, matched by distinguished name first, and by common name then.
+func (a *Authenticator) certSubjectPolicy(cert *x509.Certificate) (string, Policy, bool) {
+	if policy, ok := a.certSubjects[cert.Subject.String()]; ok {
+		return cert.Subject.String(), policy, true
+	}
+	if cn := cert.Subject.CommonName; cn != "" {
+		if policy, ok := a.certSubjects[cn]; ok {
+			return cn, policy, true
+		}
+	}
+
+	return "", Policy{}, false
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DateHeader is the header of the date the requests are signed at, in RFC 3339 format.
+	DateHeader = "X-Date"
+
+	// ContentSHA256Header is the header of the hex-encoded SHA-256 hash of the
+	// body of the signed requests.
+	ContentSHA256Header = "X-Content-SHA256"
+
+	hmacScheme = "HMAC-SHA256"
+
+	credentialParam = "Credential"
+	signatureParam  = "Signature"
+)
+
+var (
+	ErrSignatureExpired     = errors.New("signature expired")
+	ErrContentHashMismatch  = errors.New("content hash mismatch")
+	errSignatureNotValid    = errors.New("signature not valid")
+	errAuthorizationInvalid = errors.New("authorization header not valid")
+)
+
+// Sign signs the request with the key, as of the time specified as argument.
+// The body is the content of the request body, which is hashed and signed.
+//
+// The signature is the hex-encoded HMAC-SHA256, with the key secret, of the
+// method, the host, the escaped path, the canonical query, the date and the
+// content hash, separated by newlines. The canonical query is the query with
+// its parameters and their values sorted.
+// It's sent as:
+//
+//	Authorization: HMAC-SHA256 Credential=<key ID>, Signature=<signature>
+func Sign(r *http.Request, keyID, secret string, body []byte, now time.Time) {
+	sum := sha256.Sum256(body)
+	date := now.UTC().Format(time.RFC3339)
+	contentHash := hex.EncodeToString(sum[:])
+
+	r.Header.Set(DateHeader, date)
+	r.Header.Set(ContentSHA256Header, contentHash)
+	r.Header.Set("Authorization", hmacScheme+" "+credentialParam+"="+keyID+", "+signatureParam+"="+
+		signature(secret, r, date, contentHash))
+}
+
+// authenticateHMAC returns the principal of the key which signed the request.
+func (a *Authenticator) authenticateHMAC(r *http.Request, params string) (*Principal, error) {
+	var keyID, sig string
+	for _, param := range strings.Split(params, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			return nil, errors.Wrap(ErrCredentialsNotValid, errAuthorizationInvalid.Error())
+		}
+		switch name {
+		case credentialParam:
+			keyID = value
+		case signatureParam:
+			sig = value
+		}
+	}
+	if keyID == "" || sig == "" {
+		return nil, errors.Wrap(ErrCredentialsNotValid, errAuthorizationInvalid.Error())
+	}
+
+	key, ok := a.keys[keyID]
+	if !ok {
+		return nil, ErrCredentialsNotValid
+	}
+
+	date := r.Header.Get(DateHeader)
+	signedAt, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return nil, errors.Wrapf(ErrCredentialsNotValid, "%s header not valid", DateHeader)
+	}
+	if skew := a.now().Sub(signedAt); skew > a.clockSkew || skew < -a.clockSkew {
+		return nil, ErrSignatureExpired
+	}
+
+	contentHash := strings.ToLower(r.Header.Get(ContentSHA256Header))
+	want := signature(key.Secret, r, date, contentHash)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return nil, errors.Wrap(ErrCredentialsNotValid, errSignatureNotValid.Error())
+	}
+
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &verifyingReader{ReadCloser: r.Body, hash: sha256.New(), want: contentHash}
+	}
+
+	return &Principal{ID: key.ID, Tenant: key.Tenant, Policies: []Policy{key.Policy}}, nil
+}
+
+func signature(secret string, r *http.Request, date, contentHash string) string {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{r.Method, strings.ToLower(host), r.URL.EscapedPath(),
+		canonicalQuery(r.URL.Query()), date, contentHash}, "\n")))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalQuery encodes the query with its parameters sorted by name, and
+// the values of each parameter sorted.
+func canonicalQuery(query url.Values) string {
+	sorted := make(url.Values, len(query))
+	for name, values := range query {
+		values = append([]string(nil), values...)
+		sort.Strings(values)
+		sorted[name] = values
+	}
+
+	// Encode sorts the parameters by name.
+	return sorted.Encode()
+}
+
+// verifyingReader fails reading at the end of the body, if its hash doesn't
+// match the signed one.
+type verifyingReader struct {
+	io.ReadCloser
+
+	hash hash.Hash
+	want string
+}
+
+func (r *verifyingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.hash.Write(b[:n])
+	if err == io.EOF && hex.EncodeToString(r.hash.Sum(nil)) != r.want {
+		return n, ErrContentHashMismatch
+	}
+
+	return n, err
+}
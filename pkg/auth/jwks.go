@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultJWKSRefreshInterval = 1 * time.Hour
+
+	// jwksMinRefreshInterval is the minimum interval between the refreshes of
+	// the JWKS, the failed ones included, not to be flooded with tokens of
+	// random key IDs, nor to flood a failing source.
+	jwksMinRefreshInterval = 10 * time.Second
+
+	jwksFetchTimeout = 10 * time.Second
+	maxJWKSSize      = 1 << 20
+)
+
+var (
+	ErrKeyNotFound  = errors.New("signing key not found")
+	errJWKNotValid  = errors.New("json web key not valid")
+	errJWKSNotValid = errors.New("json web key set not valid")
+)
+
+// JWKSSource returns the content of a JSON Web Key Set.
+type JWKSSource func(ctx context.Context) ([]byte, error)
+
+// JWKSFile returns the source of the JWKS in the file at path.
+func JWKSFile(path string) JWKSSource {
+	return func(_ context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}
+}
+
+// JWKSURL returns the source of the JWKS served at url, fetched with client.
+func JWKSURL(url string, client *http.Client) JWKSSource {
+	return func(ctx context.Context) ([]byte, error) {
+		ctx, cancel := context.WithTimeout(ctx, jwksFetchTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("error fetching jwks: %s", res.Status)
+		}
+
+		return io.ReadAll(io.LimitReader(res.Body, maxJWKSSize))
+	}
+}
+
+// jwks is a cache of the public keys of a JWKS, by key ID. The keys are
+// refreshed every refresh interval and on unknown key IDs, to follow the
+// rotations of the signing keys. The keys are refreshed one fetch at a time,
+// and the cached keys are served while it's in flight.
+type jwks struct {
+	source          JWKSSource
+	refreshInterval time.Duration
+
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	refreshing  *jwksRefresh
+	mu          sync.Mutex
+}
+
+// jwksRefresh is a refresh of the keys in flight, whose err is set when done
+// is closed.
+type jwksRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// key returns the public key with the ID, as of now.
+func (s *jwks) key(ctx context.Context, kid string, now time.Time) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	key, ok := s.keys[kid]
+	// The keys are refreshed when stale or on unknown key IDs, at most once
+	// every minimum refresh interval, and the refresh in flight is joined.
+	due := (!ok || now.Sub(s.fetchedAt) > s.refreshInterval) && now.Sub(s.attemptedAt) > jwksMinRefreshInterval
+	if !due && s.refreshing == nil {
+		s.mu.Unlock()
+		if !ok {
+			return nil, errors.Wrapf(ErrKeyNotFound, "key id %q", kid)
+		}
+		return key, nil
+	}
+	refresh := s.refresh(ctx, now)
+	s.mu.Unlock()
+
+	// The cached keys are used until the JWKS is refreshed, or available again.
+	if ok {
+		return key, nil
+	}
+
+	select {
+	case <-refresh.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if refresh.err != nil {
+		return nil, errors.Wrap(refresh.err, "error refreshing jwks")
+	}
+
+	s.mu.Lock()
+	key, ok = s.keys[kid]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errors.Wrapf(ErrKeyNotFound, "key id %q", kid)
+	}
+
+	return key, nil
+}
+
+// refresh fetches the keys in the background, unless they're being fetched
+// already, and returns the refresh in flight. It must be called with mu held.
+func (s *jwks) refresh(ctx context.Context, now time.Time) *jwksRefresh {
+	if s.refreshing != nil {
+		return s.refreshing
+	}
+	refresh := &jwksRefresh{done: make(chan struct{})}
+	s.refreshing = refresh
+	s.attemptedAt = now
+
+	// The refresh outlives the request which started it, and it's bounded by
+	// the timeout of the source.
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer close(refresh.done)
+
+		keys, err := s.fetch(ctx)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if err == nil {
+			s.keys = keys
+			s.fetchedAt = now
+		}
+		s.refreshing = nil
+		refresh.err = err
+	}()
+
+	return refresh
+}
+
+func (s *jwks) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	b, err := s.source(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJWKS(b)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+
+	// RSA public key parameters.
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC public key parameters.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns the signature public keys of the JWKS, by key ID.
+// The keys of types other than RSA and EC are ignored.
+func parseJWKS(b []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, errors.Wrap(errJWKSNotValid, err.Error())
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key crypto.PublicKey
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaPublicKey()
+		case "EC":
+			key, err = k.ecdsaPublicKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "key id %q", k.Kid)
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, errors.Wrap(errJWKNotValid, "rsa exponent too large")
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jsonWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, errors.Wrapf(errJWKNotValid, "curve %q not supported", k.Crv)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.Wrap(errJWKNotValid, "point not on curve")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.Wrap(errJWKNotValid, "parameter not valid base64url")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
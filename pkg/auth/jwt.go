@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	bearerScheme = "Bearer"
+
+	defaultRolesClaim = "scope"
+)
+
+var (
+	ErrTokenNotValid = errors.New("token not valid")
+	ErrTokenExpired  = errors.New("token expired")
+)
+
+// jwtSigningMethods are the signing methods of the accepted tokens: the
+// asymmetric ones, whose keys are published with JWKS.
+var jwtSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// jwtVerifier verifies the bearer JWTs, and maps their claims to policies.
+type jwtVerifier struct {
+	keys *jwks
+
+	issuer   string
+	audience string
+
+	// rolesClaim is the claim whose values are mapped to policies by roles.
+	// The claim is either a space-separated string, e.g. the OAuth2 scope, or
+	// an array of strings, e.g. the groups.
+	rolesClaim string
+	roles      map[string]Policy
+
+	// tenantClaim is the string claim of the tenant of the principals. The
+	// principals have no tenant when empty.
+	tenantClaim string
+}
+
+type JWTOption func(v *jwtVerifier)
+
+// WithIssuer requires the tokens to be issued by the issuer.
+func WithIssuer(issuer string) JWTOption {
+	return func(v *jwtVerifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithAudience requires the tokens to be issued for the audience.
+func WithAudience(audience string) JWTOption {
+	return func(v *jwtVerifier) {
+		v.audience = audience
+	}
+}
+
+// WithRoles maps the values of the claim to the policies of the principals.
+func WithRoles(claim string, roles map[string]Policy) JWTOption {
+	return func(v *jwtVerifier) {
+		if claim != "" {
+			v.rolesClaim = claim
+		}
+		v.roles = roles
+	}
+}
+
+// WithTenantClaim maps the value of the string claim to the tenant of the principals.
+func WithTenantClaim(claim string) JWTOption {
+	return func(v *jwtVerifier) {
+		v.tenantClaim = claim
+	}
+}
+
+// WithJWKSRefreshInterval sets the interval the JWKS is refreshed at. It's also
+// refreshed when a token is signed with an unknown key.
+func WithJWKSRefreshInterval(interval time.Duration) JWTOption {
+	return func(v *jwtVerifier) {
+		v.keys.refreshInterval = interval
+	}
+}
+
+// WithJWT enables the authentication with bearer JWTs, signed with the keys of
+// the JWKS source.
+func WithJWT(source JWKSSource, opts ...JWTOption) Option {
+	return func(a *Authenticator) {
+		v := &jwtVerifier{
+			keys:       &jwks{source: source, refreshInterval: defaultJWKSRefreshInterval},
+			rolesClaim: defaultRolesClaim,
+		}
+		for _, f := range opts {
+			f(v)
+		}
+		a.jwt = v
+	}
+}
+
+// authenticateJWT returns the principal of the token subject, with the
+// policies of the roles of its claims.
+func (a *Authenticator) authenticateJWT(ctx context.Context, token string) (*Principal, error) {
+	v := a.jwt
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtSigningMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(a.clockSkew),
+		jwt.WithTimeFunc(a.now),
+	}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.key(ctx, kid, a.now())
+	}, opts...)
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, ErrTokenExpired
+	case err != nil:
+		return nil, errors.Wrap(ErrTokenNotValid, err.Error())
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, errors.Wrap(ErrTokenNotValid, "subject missing")
+	}
+
+	principal := &Principal{ID: subject}
+	if v.tenantClaim != "" {
+		tenant, ok := claims[v.tenantClaim].(string)
+		if !ok || tenant == "" {
+			return nil, errors.Wrapf(ErrTokenNotValid, "%s claim missing", v.tenantClaim)
+		}
+		principal.Tenant = tenant
+	}
+	for _, role := range claimValues(claims[v.rolesClaim]) {
+		if policy, ok := v.roles[role]; ok {
+			principal.Policies = append(principal.Policies, policy)
+		}
+	}
+
+	return principal, nil
+}
+
+// claimValues returns the values of a space-separated string or string array claim.
+func claimValues(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return strings.Fields(c)
+	case []interface{}:
+		values := make([]string, 0, len(c))
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
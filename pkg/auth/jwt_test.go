@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// testJWKS returns the JWKS of the public keys, by key ID.
+func testJWKS(t *testing.T, keys map[string]interface{}) []byte {
+	t.Helper()
+
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	for kid, key := range keys {
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jsonWebKey{Kty: "RSA", Kid: kid, Use: "sig", N: encode(k.N), E: encode(big.NewInt(int64(k.E)))})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, jsonWebKey{Kty: "EC", Kid: kid, Crv: k.Params().Name, X: encode(k.X), Y: encode(k.Y)})
+		default:
+			t.Fatalf("key type %T not supported", key)
+		}
+	}
+
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func testToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestAuthenticatorAuthenticateJWT(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, testJWKS(t, map[string]interface{}{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	readers := Policy{Actions: []Action{ActionRead}}
+	writers := Policy{Actions: []Action{ActionWrite}, Prefixes: []string{"logs"}}
+
+	a := NewAuthenticator(WithJWT(JWKSFile(jwksFile),
+		WithIssuer("https://issuer.example.com"),
+		WithAudience("object-storage"),
+		WithRoles("groups", map[string]Policy{"readers": readers, "writers": writers}),
+		WithTenantClaim("tenant"),
+	))
+	a.now = func() time.Time { return now }
+
+	claims := func(modify func(c jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub":    "service-a",
+			"iss":    "https://issuer.example.com",
+			"aud":    "object-storage",
+			"exp":    now.Add(time.Hour).Unix(),
+			"groups": []string{"readers", "writers", "others"},
+			"tenant": "acme",
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+
+	testCases := []struct {
+		name         string
+		token        string
+		wantErr      error
+		wantPolicies []Policy
+	}{
+		{name: "with rsa token", token: testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil)),
+			wantPolicies: []Policy{readers, writers}},
+		{name: "with ec token", token: testToken(t, jwt.SigningMethodES256, "ec", ecKey, claims(nil)),
+			wantPolicies: []Policy{readers, writers}},
+		{name: "with space-separated roles", token: testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey,
+			claims(func(c jwt.MapClaims) { c["groups"] = "readers others" })), wantPolicies: []Policy{readers}},
+		{name: "with token expired", token: testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey,
+			claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() })), wantErr: ErrTokenExpired},
+		{name: "with token without expiration", token: testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey,
+			claims(func(c jwt.MapClaims) { delete(c, "exp") })), wantErr: ErrTokenNotValid},
+		{name: "with token signed by other key", token: testToken(t, jwt.SigningMethodRS256, "rsa", otherRSAKey, claims(nil)),
+			wantErr: ErrTokenNotValid},
+		{name: "with token of unknown key id", token: testToken(t, jwt.SigningMethodRS256, "other", otherRSAKey, claims(nil)),
+			wantErr: ErrTokenNotValid},
+		{name: "with token signed with hmac", token: testToken(t, jwt.SigningMethodHS256, "rsa", []byte("secret"), claims(nil)),
+			wantErr: ErrTokenNotValid},
+		{name: "with token of other issuer", token: testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey,
+			claims(func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" })), wantErr: ErrTokenNotValid},
+		{name: "with token of other audience", token: testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey,
+			claims(func(c jwt.MapClaims) { c["aud"] = "other" })), wantErr: ErrTokenNotValid},
+		{name: "with token without tenant", token: testToken(t, jwt.SigningMethodRS256, "rsa", rsaKey,
+			claims(func(c jwt.MapClaims) { delete(c, "tenant") })), wantErr: ErrTokenNotValid},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/object/foo", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+
+			got, err := a.Authenticate(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.ID != "service-a" || got.Tenant != "acme" {
+				t.Errorf("got principal %s of tenant %q, want service-a of acme", got.ID, got.Tenant)
+			}
+			if len(got.Policies) != len(tt.wantPolicies) {
+				t.Errorf("got policies %v, want %v", got.Policies, tt.wantPolicies)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorJWKSRotation(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu      sync.Mutex
+		keys    = map[string]interface{}{"old": &oldKey.PublicKey}
+		fetches int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		w.Write(testJWKS(t, keys))
+	}))
+	t.Cleanup(srv.Close)
+
+	getFetches := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches
+	}
+
+	a := NewAuthenticator(WithJWT(JWKSURL(srv.URL, srv.Client())))
+	a.now = func() time.Time { return now }
+
+	authenticate := func(kid string, key *rsa.PrivateKey) error {
+		r := httptest.NewRequest(http.MethodGet, "/object/foo", nil)
+		r.Header.Set("Authorization", "Bearer "+testToken(t, jwt.SigningMethodRS256, kid, key,
+			jwt.MapClaims{"sub": "service-a", "exp": now.Add(time.Hour).Unix()}))
+		_, err := a.Authenticate(r)
+		return err
+	}
+
+	if err := authenticate("old", oldKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticate("old", oldKey); err != nil {
+		t.Fatal(err)
+	}
+	if got := getFetches(); got != 1 {
+		t.Errorf("got %d jwks fetches, want the jwks cached", got)
+	}
+
+	// The signing key is rotated.
+	mu.Lock()
+	keys = map[string]interface{}{"old": &oldKey.PublicKey, "new": &newKey.PublicKey}
+	mu.Unlock()
+
+	if err := authenticate("new", newKey); !errors.Is(err, ErrTokenNotValid) {
+		t.Errorf("got error %v before the min refresh interval, want %v", err, ErrTokenNotValid)
+	}
+	now = now.Add(jwksMinRefreshInterval + time.Second)
+	if err := authenticate("new", newKey); err != nil {
+		t.Errorf("got error %v after rotation, want nil", err)
+	}
+	if got := getFetches(); got != 2 {
+		t.Errorf("got %d jwks fetches, want 2", got)
+	}
+}
+
+func TestJWKSRefreshInFlight(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu      sync.Mutex
+		kids    = []string{"old"}
+		fetches int
+		release = make(chan struct{})
+	)
+	source := func(ctx context.Context) ([]byte, error) {
+		mu.Lock()
+		fetches++
+		keys := make(map[string]interface{})
+		for _, kid := range kids {
+			keys[kid] = &key.PublicKey
+		}
+		first := fetches == 1
+		mu.Unlock()
+
+		if !first {
+			<-release
+		}
+		return testJWKS(t, keys), nil
+	}
+	s := &jwks{source: source, refreshInterval: time.Minute}
+
+	ctx := context.Background()
+	if _, err := s.key(ctx, "old", now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signing key is rotated, and the refresh is blocked meanwhile.
+	mu.Lock()
+	kids = []string{"old", "new"}
+	mu.Unlock()
+	now = now.Add(2 * time.Minute)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.key(ctx, "new", now)
+			errs <- err
+		}()
+	}
+
+	// The cached keys are served while the refresh is in flight.
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.key(ctx, "old", now)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got error %v of cached key, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("got cached key blocked by the refresh in flight")
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("got error %v of rotated key, want nil", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fetches != 2 {
+		t.Errorf("got %d jwks fetches, want 2", fetches)
+	}
+}
+
+func TestJWKSRefreshFailing(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	var fetches int
+	source := func(ctx context.Context) ([]byte, error) {
+		fetches++
+		return nil, errors.New("connection refused")
+	}
+	s := &jwks{source: source, refreshInterval: time.Minute}
+
+	// The failed refreshes are rate limited, as the successful ones.
+	ctx := context.Background()
+	for _, kid := range []string{"a", "b", "c"} {
+		if _, err := s.key(ctx, kid, now); err == nil {
+			t.Errorf("got no error of key %s with jwks failing, want one", kid)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("got %d jwks fetches within the min refresh interval, want 1", fetches)
+	}
+
+	now = now.Add(jwksMinRefreshInterval + time.Second)
+	if _, err := s.key(ctx, "a", now); err == nil {
+		t.Error("got no error with jwks failing, want one")
+	}
+	if fetches != 2 {
+		t.Errorf("got %d jwks fetches after the min refresh interval, want 2", fetches)
+	}
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// The query parameters of the presigned URLs.
+	ExpiresParam          = "X-Expires"
+	CredentialParam       = "X-Credential"
+	MaxContentLengthParam = "X-Max-Content-Length"
+	SignatureParam        = "X-Signature"
+
+	defaultPresignMaxExpiry = 7 * 24 * time.Hour
+)
+
+var (
+	ErrPresignDisabled       = errors.New("presigned urls disabled")
+	ErrPresignExpiryNotValid = errors.New("presigned url expiry not valid")
+	ErrURLExpired            = errors.New("presigned url expired")
+	ErrContentTooLarge       = errors.New("content too large")
+)
+
+// presigner signs and verifies the presigned URLs, with a secret of the gateway.
+type presigner struct {
+	secret    []byte
+	maxExpiry time.Duration
+}
+
+// WithPresign enables the presigned URLs, signed with the secret, which expire
+// at most after maxExpiry.
+func WithPresign(secret string, maxExpiry time.Duration) Option {
+	return func(a *Authenticator) {
+		a.presigner = &presigner{secret: []byte(secret), maxExpiry: maxExpiry}
+	}
+}
+
+// MaxPresignExpiry returns the maximum expiry of the presigned URLs, or zero
+// if they're disabled.
+func (a *Authenticator) MaxPresignExpiry() time.Duration {
+	if a.presigner == nil {
+		return 0
+	}
+
+	return a.presigner.maxExpiry
+}
+
+// ActionOf returns the action of the request with the method.
+func ActionOf(method string) Action {
+	if method == http.MethodGet || method == http.MethodHead {
+		return ActionRead
+	}
+
+	return ActionWrite
+}
+
+// Presign returns the query parameters of a URL which authorizes the requests
+// with the method to the path, issued by the principal, until it expires.
+// The content length of the requests is limited to maxContentLength, if positive.
+//
+// The signature is the hex-encoded HMAC-SHA256, with the presign secret, of the
+// method, the escaped path, the expiry unix time, the maximum content length and
+// the issuer, separated by newlines. The URLs don't depend on the nodes storing
+// the objects, and stay valid until they expire, even if the key of the issuer is removed.
+func (a *Authenticator) Presign(issuer, method, path string, expiry time.Duration,
+	maxContentLength int64) (url.Values, time.Time, error) {
+	if a.presigner == nil {
+		return nil, time.Time{}, ErrPresignDisabled
+	}
+	if expiry <= 0 || expiry > a.presigner.maxExpiry {
+		return nil, time.Time{}, errors.Wrapf(ErrPresignExpiryNotValid, "expiry must be between 0 and %s", a.presigner.maxExpiry)
+	}
+	if maxContentLength < 0 {
+		maxContentLength = 0
+	}
+
+	expiresAt := a.now().Add(expiry).Truncate(time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	maxLength := strconv.FormatInt(maxContentLength, 10)
+
+	query := url.Values{}
+	query.Set(ExpiresParam, expires)
+	query.Set(CredentialParam, issuer)
+	if maxContentLength > 0 {
+		query.Set(MaxContentLengthParam, maxLength)
+	}
+	query.Set(SignatureParam, a.presigner.signature(method, path, expires, maxLength, issuer))
+
+	return query, expiresAt, nil
+}
+
+// authenticatePresigned returns the principal of the presigned request, only
+// allowed the action of its method. The body of the request is replaced with
+// one which fails reading past the maximum content length, if any.
+func (a *Authenticator) authenticatePresigned(r *http.Request) (*Principal, error) {
+	if a.presigner == nil {
+		return nil, errors.Wrap(ErrCredentialsNotValid, ErrPresignDisabled.Error())
+	}
+
+	query := r.URL.Query()
+	expires := query.Get(ExpiresParam)
+	issuer := query.Get(CredentialParam)
+	sig := query.Get(SignatureParam)
+
+	maxLength := query.Get(MaxContentLengthParam)
+	if maxLength == "" {
+		maxLength = "0"
+	}
+	maxContentLength, err := strconv.ParseInt(maxLength, 10, 64)
+	if err != nil || maxContentLength < 0 {
+		return nil, errors.Wrapf(ErrCredentialsNotValid, "%s parameter not valid", MaxContentLengthParam)
+	}
+
+	want := a.presigner.signature(r.Method, r.URL.EscapedPath(), expires, maxLength, issuer)
+	if !hmac.Equal([]byte(strings.ToLower(sig)), []byte(want)) {
+		return nil, errors.Wrap(ErrCredentialsNotValid, errSignatureNotValid.Error())
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(ErrCredentialsNotValid, "%s parameter not valid", ExpiresParam)
+	}
+	if !a.now().Before(time.Unix(expiresAt, 0)) {
+		return nil, ErrURLExpired
+	}
+
+	if maxContentLength > 0 {
+		if r.ContentLength > maxContentLength {
+			return nil, ErrContentTooLarge
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &limitedReader{ReadCloser: r.Body, remaining: maxContentLength}
+		}
+	}
+
+	return &Principal{ID: issuer, Policies: []Policy{{Actions: []Action{ActionOf(r.Method)}}}}, nil
+}
+
+// isPresigned returns whether the request is authenticated by its URL.
+func isPresigned(r *http.Request) bool {
+	return r.URL.Query().Has(SignatureParam)
+}
+
+func (p *presigner) signature(method, path, expires, maxContentLength, issuer string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(strings.Join([]string{method, path, expires, maxContentLength, issuer}, "\n")))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// limitedReader fails reading past the remaining bytes, e.g. when the content
+// length of the request is unknown.
+type limitedReader struct {
+	io.ReadCloser
+
+	remaining int64
+}
+
+func (r *limitedReader) Read(b []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, ErrContentTooLarge
+	}
+	// One byte more than the remaining ones is read, to tell whether the content
+	// is exactly as large as the limit.
+	if int64(len(b)) > r.remaining+1 {
+		b = b[:r.remaining+1]
+	}
+	n, err := r.ReadCloser.Read(b)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n + int(r.remaining), ErrContentTooLarge
+	}
+
+	return n, err
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestAuthenticatorPresign(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	a := NewAuthenticator(WithPresign("s3cr3t", time.Hour))
+	a.now = func() time.Time { return now }
+
+	presign := func(method, path string, maxContentLength int64) string {
+		query, _, err := a.Presign("writer", method, path, 15*time.Minute, maxContentLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path + "?" + query.Encode()
+	}
+	tamper := func(target string, f func(u *url.URL)) string {
+		u, _ := url.Parse(target)
+		f(u)
+		return u.String()
+	}
+
+	testCases := []struct {
+		name    string
+		method  string
+		target  string
+		body    []byte
+		elapsed time.Duration
+		wantErr error
+	}{
+		{name: "with presigned get", method: http.MethodGet, target: presign(http.MethodGet, "/object/foo", 0)},
+		{name: "with presigned put", method: http.MethodPut, target: presign(http.MethodPut, "/object/foo", 5),
+			body: []byte("hello")},
+		{name: "with expired url", method: http.MethodGet, target: presign(http.MethodGet, "/object/foo", 0),
+			elapsed: 15 * time.Minute, wantErr: ErrURLExpired},
+		{name: "with other method", method: http.MethodPut, target: presign(http.MethodGet, "/object/foo", 0),
+			wantErr: ErrCredentialsNotValid},
+		{name: "with other path", method: http.MethodGet,
+			target:  tamper(presign(http.MethodGet, "/object/foo", 0), func(u *url.URL) { u.Path = "/object/bar" }),
+			wantErr: ErrCredentialsNotValid},
+		{name: "with removed content length limit", method: http.MethodPut, body: []byte("hello"),
+			target: tamper(presign(http.MethodPut, "/object/foo", 4), func(u *url.URL) {
+				query := u.Query()
+				query.Del(MaxContentLengthParam)
+				u.RawQuery = query.Encode()
+			}),
+			wantErr: ErrCredentialsNotValid},
+		{name: "with content too large", method: http.MethodPut, target: presign(http.MethodPut, "/object/foo", 4),
+			body: []byte("hello"), wantErr: ErrContentTooLarge},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, bytes.NewReader(tt.body))
+			a.now = func() time.Time { return now.Add(tt.elapsed) }
+			defer func() { a.now = func() time.Time { return now } }()
+
+			principal, err := a.Authenticate(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if principal.ID != "writer" {
+				t.Errorf("got principal %q, want %q", principal.ID, "writer")
+			}
+			if !principal.Allows(ActionOf(tt.method), "foo") {
+				t.Errorf("principal not allowed to %s", ActionOf(tt.method))
+			}
+		})
+	}
+}
+
+func TestAuthenticatorPresignLimits(t *testing.T) {
+	a := NewAuthenticator(WithPresign("s3cr3t", time.Hour))
+
+	if _, _, err := a.Presign("writer", http.MethodGet, "/object/foo", 2*time.Hour, 0); !errors.Is(err, ErrPresignExpiryNotValid) {
+		t.Errorf("got error %v presigning past the max expiry, want %v", err, ErrPresignExpiryNotValid)
+	}
+	if _, _, err := NewAuthenticator().Presign("writer", http.MethodGet, "/object/foo", time.Minute, 0); !errors.Is(err, ErrPresignDisabled) {
+		t.Errorf("got error %v presigning without secret, want %v", err, ErrPresignDisabled)
+	}
+
+	// The content length is unknown, e.g. with chunked uploads, and it's
+	// limited while reading the body.
+	query, _, err := a.Presign("writer", http.MethodPut, "/object/foo", time.Minute, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		body    string
+		wantErr error
+	}{
+		{body: "hell"},
+		{body: "hello", wantErr: ErrContentTooLarge},
+	} {
+		r := httptest.NewRequest(http.MethodPut, "/object/foo?"+query.Encode(), io.NopCloser(bytes.NewBufferString(tt.body)))
+		r.ContentLength = -1
+		if _, err := a.Authenticate(r); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(r.Body); !errors.Is(err, tt.wantErr) {
+			t.Errorf("got error %v reading body %q, want %v", err, tt.body, tt.wantErr)
+		}
+	}
+}
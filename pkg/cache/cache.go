@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxBytes      = 64 << 20
+	defaultTTL           = 30 * time.Second
+	defaultMaxObjectSize = 1 << 20
+)
+
+// Entry is the content of an object, with its ETag.
+type Entry struct {
+	ETag    string
+	Content []byte
+
+	// ValidatedAt is the time the entry was stored or last revalidated.
+	ValidatedAt time.Time
+}
+
+// Cache is a least recently used cache of objects, bounded by the size of
+// their content. The entries are fresh for the TTL since they're validated,
+// then they're to be revalidated, e.g. with a conditional request.
+// All the methods are safe to call on a nil Cache, which caches nothing.
+type Cache struct {
+	maxBytes      int64
+	ttl           time.Duration
+	maxObjectSize int64
+
+	// entries is the list of the cached entries, the most recently used first,
+	// indexed by key by elements.
+	entries  *list.List
+	elements map[string]*list.Element
+	size     int64
+	mu       sync.Mutex
+
+	now func() time.Time
+}
+
+type element struct {
+	key   string
+	entry Entry
+}
+
+type Option func(c *Cache)
+
+// WithMaxBytes sets the maximum size of the content of the entries.
+func WithMaxBytes(n int64) Option {
+	return func(c *Cache) {
+		c.maxBytes = n
+	}
+}
+
+// WithTTL sets the time the entries are fresh for, since they're validated.
+// The entries are revalidated on every lookup, when zero.
+func WithTTL(ttl time.Duration) Option {
+	return func(c *Cache) {
+		c.ttl = ttl
+	}
+}
+
+// WithMaxObjectSize sets the maximum size of the content of each entry. The
+// larger objects are not cached.
+func WithMaxObjectSize(n int64) Option {
+	return func(c *Cache) {
+		c.maxObjectSize = n
+	}
+}
+
+// New returns a new Cache.
+func New(opts ...Option) *Cache {
+	c := &Cache{
+		maxBytes:      defaultMaxBytes,
+		ttl:           defaultTTL,
+		maxObjectSize: defaultMaxObjectSize,
+		entries:       list.New(),
+		elements:      make(map[string]*list.Element),
+		now:           time.Now,
+	}
+
+	for _, f := range opts {
+		f(c)
+	}
+
+	return c
+}
+
+// Get returns the entry of the key, if any, and whether it's fresh.
+func (c *Cache) Get(key string) (entry Entry, fresh, ok bool) {
+	if c == nil {
+		return Entry{}, false, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.elements[key]
+	if !ok {
+		return Entry{}, false, false
+	}
+	c.entries.MoveToFront(e)
+	entry = e.Value.(*element).entry
+
+	return entry, c.now().Sub(entry.ValidatedAt) < c.ttl, true
+}
+
+// Add stores the content of the object of the key, with its ETag, evicting
+// the least recently used entries over the maximum size. The objects larger
+// than the maximum object size are not stored.
+func (c *Cache) Add(key, etag string, content []byte) {
+	if c == nil {
+		return
+	}
+	size := int64(len(content))
+	if size > c.maxObjectSize || size > c.maxBytes {
+		c.Remove(key)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(key)
+	e := c.entries.PushFront(&element{key: key, entry: Entry{ETag: etag, Content: content, ValidatedAt: c.now()}})
+	c.elements[key] = e
+	c.size += size
+
+	for c.size > c.maxBytes {
+		c.remove(c.entries.Back().Value.(*element).key)
+	}
+}
+
+// Revalidate makes the entry of the key fresh again, if its ETag matches.
+func (c *Cache) Revalidate(key, etag string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.elements[key]; ok && e.Value.(*element).entry.ETag == etag {
+		e.Value.(*element).entry.ValidatedAt = c.now()
+	}
+}
+
+// Remove removes the entry of the key, if any.
+func (c *Cache) Remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remove(key)
+}
+
+// RemovePrefix removes the entries of the keys with the prefix.
+func (c *Cache) RemovePrefix(prefix string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.elements {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(key)
+		}
+	}
+}
+
+// Size returns the number of entries and the size of their content.
+func (c *Cache) Size() (entries int, bytes int64) {
+	if c == nil {
+		return 0, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.elements), c.size
+}
+
+func (c *Cache) remove(key string) {
+	e, ok := c.elements[key]
+	if !ok {
+		return
+	}
+	c.entries.Remove(e)
+	delete(c.elements, key)
+	c.size -= int64(len(e.Value.(*element).entry.Content))
+}
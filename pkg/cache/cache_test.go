@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := New(WithMaxBytes(10), WithMaxObjectSize(6), WithTTL(time.Minute))
+	c.now = func() time.Time { return now }
+
+	c.Add("a", "etag-a", []byte("aaaa"))
+	c.Add("b", "etag-b", []byte("bbbb"))
+	if entry, fresh, ok := c.Get("a"); !ok || !fresh || string(entry.Content) != "aaaa" || entry.ETag != "etag-a" {
+		t.Errorf("got entry %+v, fresh %t and ok %t, want a fresh", entry, fresh, ok)
+	}
+
+	// The least recently used entries are evicted over the maximum size.
+	c.Add("c", "etag-c", []byte("cccc"))
+	if _, _, ok := c.Get("b"); ok {
+		t.Error("got entry b, want it evicted")
+	}
+	if entries, bytes := c.Size(); entries != 2 || bytes != 8 {
+		t.Errorf("got %d entries of %d bytes, want 2 of 8", entries, bytes)
+	}
+
+	// The objects over the maximum object size are not cached, and replace
+	// the entries of their key.
+	c.Add("a", "etag-a2", []byte("aaaaaaa"))
+	if _, _, ok := c.Get("a"); ok {
+		t.Error("got entry a over the max object size, want none")
+	}
+
+	// The entries are stale after the TTL, until they're revalidated.
+	now = now.Add(time.Minute)
+	if _, fresh, ok := c.Get("c"); !ok || fresh {
+		t.Errorf("got fresh %t and ok %t after the ttl, want stale", fresh, ok)
+	}
+	c.Revalidate("c", "etag-other")
+	if _, fresh, _ := c.Get("c"); fresh {
+		t.Error("got entry fresh after revalidation with other etag, want stale")
+	}
+	c.Revalidate("c", "etag-c")
+	if _, fresh, _ := c.Get("c"); !fresh {
+		t.Error("got entry stale after revalidation, want fresh")
+	}
+
+	c.Add("bucket/a", "etag", []byte("a"))
+	c.Add("bucket2/a", "etag", []byte("a"))
+	c.RemovePrefix("bucket/")
+	if _, _, ok := c.Get("bucket/a"); ok {
+		t.Error("got entry with prefix removed")
+	}
+	if _, _, ok := c.Get("bucket2/a"); !ok {
+		t.Error("got entry without prefix removed")
+	}
+	c.Remove("bucket2/a")
+	if _, _, ok := c.Get("bucket2/a"); ok {
+		t.Error("got entry removed")
+	}
+}
+
+func TestCacheNil(t *testing.T) {
+	var c *Cache
+
+	c.Add("a", "etag", []byte("a"))
+	c.Revalidate("a", "etag")
+	c.Remove("a")
+	c.RemovePrefix("")
+	if _, _, ok := c.Get("a"); ok {
+		t.Error("got entry of nil cache")
+	}
+	if entries, bytes := c.Size(); entries != 0 || bytes != 0 {
+		t.Errorf("got %d entries of %d bytes of nil cache", entries, bytes)
+	}
+}
@@ -0,0 +1,484 @@
+package cache
+
+import (
+	"bufio"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultDiskMaxBytes = 1 << 30
+
+	// entryExt and tempExt are the extensions of the entry files, and of the
+	// ones being written.
+	entryExt = ".obj"
+	tempExt  = ".tmp"
+)
+
+var (
+	ErrEntryCorrupted = errors.New("cache entry corrupted")
+)
+
+// DiskEviction is the policy of eviction of the entries over the maximum size.
+type DiskEviction string
+
+const (
+	// DiskEvictionLRU evicts the least recently used entries first.
+	DiskEvictionLRU DiskEviction = "lru"
+
+	// DiskEvictionLFU evicts the least frequently used entries first, and the
+	// least recently used ones among them. The frequency of use is not
+	// recovered on restart.
+	DiskEvictionLFU DiskEviction = "lfu"
+)
+
+// diskHeader is the first line of the entry files, followed by the content.
+type diskHeader struct {
+	Key    string `json:"key"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Disk is a cache of objects in a directory, bounded by the size of their
+// content, evicting the least recently used entries, or the least frequently
+// used ones. The entries are written atomically, and their content is checked
+// against its checksum while it's read. The index of the entries is recovered
+// from the directory, with their recency from the modification time of their
+// files.
+// All the methods are safe to call on a nil Disk, which caches nothing.
+type Disk struct {
+	dir           string
+	maxBytes      int64
+	maxObjectSize int64
+	eviction      DiskEviction
+
+	// entries are the cached entries, the next one to evict first, indexed by
+	// key by elements. The uses of the entries are sequenced by clock.
+	entries  diskHeap
+	elements map[string]*diskElement
+	clock    uint64
+	size     int64
+	mu       sync.Mutex
+
+	now func() time.Time
+}
+
+type diskElement struct {
+	key  string
+	etag string
+	size int64
+
+	// hits is the number of reads of the entry, and used the sequence of its
+	// last use.
+	hits  int64
+	used  uint64
+	index int
+}
+
+// diskHeap is a heap of the entries, the next one to evict first.
+type diskHeap struct {
+	elements []*diskElement
+	lfu      bool
+}
+
+func (h *diskHeap) Len() int { return len(h.elements) }
+
+func (h *diskHeap) Less(i, j int) bool {
+	a, b := h.elements[i], h.elements[j]
+	if h.lfu && a.hits != b.hits {
+		return a.hits < b.hits
+	}
+
+	return a.used < b.used
+}
+
+func (h *diskHeap) Swap(i, j int) {
+	h.elements[i], h.elements[j] = h.elements[j], h.elements[i]
+	h.elements[i].index = i
+	h.elements[j].index = j
+}
+
+func (h *diskHeap) Push(x any) {
+	e := x.(*diskElement)
+	e.index = len(h.elements)
+	h.elements = append(h.elements, e)
+}
+
+func (h *diskHeap) Pop() any {
+	n := len(h.elements) - 1
+	e := h.elements[n]
+	h.elements[n] = nil
+	h.elements = h.elements[:n]
+
+	return e
+}
+
+type DiskOption func(d *Disk)
+
+// WithDiskMaxBytes sets the maximum size of the content of the entries.
+func WithDiskMaxBytes(n int64) DiskOption {
+	return func(d *Disk) {
+		d.maxBytes = n
+	}
+}
+
+// WithDiskMaxObjectSize sets the maximum size of the content of each entry.
+// The larger objects are not cached. The size of the entries is not limited,
+// when zero.
+func WithDiskMaxObjectSize(n int64) DiskOption {
+	return func(d *Disk) {
+		d.maxObjectSize = n
+	}
+}
+
+// WithDiskEviction sets the policy of eviction of the entries, by default
+// DiskEvictionLRU.
+func WithDiskEviction(eviction DiskEviction) DiskOption {
+	return func(d *Disk) {
+		d.eviction = eviction
+	}
+}
+
+// OpenDisk returns the Disk cache in the directory, which is created if
+// missing. The entries in the directory are recovered, except the ones not
+// written completely, and the ones to evict over the maximum size.
+func OpenDisk(dir string, opts ...DiskOption) (*Disk, error) {
+	d := &Disk{
+		dir:      dir,
+		maxBytes: defaultDiskMaxBytes,
+		eviction: DiskEvictionLRU,
+		elements: make(map[string]*diskElement),
+		now:      time.Now,
+	}
+
+	for _, f := range opts {
+		f(d)
+	}
+	d.entries.lfu = d.eviction == DiskEvictionLFU
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "error creating the cache directory")
+	}
+	if err := d.recover(); err != nil {
+		return nil, errors.Wrap(err, "error recovering the cache entries")
+	}
+
+	return d, nil
+}
+
+// recover indexes the entry files in the directory, used in the order they're
+// modified, and removes the files being written when the cache was closed.
+func (d *Disk) recover() error {
+	files, err := os.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	type recovered struct {
+		header  diskHeader
+		modTime time.Time
+	}
+	var entries []recovered
+	for _, f := range files {
+		path := filepath.Join(d.dir, f.Name())
+		switch filepath.Ext(f.Name()) {
+		case tempExt:
+			os.Remove(path)
+			continue
+		case entryExt:
+		default:
+			continue
+		}
+
+		info, err := f.Info()
+		if err != nil {
+			return err
+		}
+		header, err := readHeader(path)
+		if err != nil || d.path(header.Key) != path {
+			os.Remove(path)
+			continue
+		}
+		entries = append(entries, recovered{header: header, modTime: info.ModTime()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, e := range entries {
+		d.push(&diskElement{key: e.header.Key, etag: e.header.ETag, size: e.header.Size})
+	}
+	d.evict(0)
+
+	return nil
+}
+
+// Get returns the entry of the key, if any. The entries whose content doesn't
+// match their checksum are removed.
+func (d *Disk) Get(key string) (Entry, bool, error) {
+	if d == nil {
+		return Entry{}, false, nil
+	}
+
+	// The file is opened with the lock held, so that it's the one of the
+	// element even if the entry is replaced or removed while it's read.
+	d.mu.Lock()
+	e, ok := d.elements[key]
+	if !ok {
+		d.mu.Unlock()
+		return Entry{}, false, nil
+	}
+	path := d.path(key)
+	f, err := os.Open(path)
+	if err != nil {
+		d.removeElement(e)
+		d.mu.Unlock()
+		return Entry{}, false, err
+	}
+	defer f.Close()
+	d.use(e)
+	e.hits++
+	heap.Fix(&d.entries, e.index)
+	// The recency of the entries is recovered from their modification time.
+	now := d.now()
+	os.Chtimes(path, now, now)
+	d.mu.Unlock()
+
+	entry, err := readEntry(f, key, e.size)
+	if err != nil {
+		d.mu.Lock()
+		d.removeElement(e)
+		d.mu.Unlock()
+		return Entry{}, false, err
+	}
+
+	return entry, true, nil
+}
+
+// Add stores the content of the object of the key, with its ETag, evicting
+// the least recently used entries over the maximum size. The objects larger
+// than the maximum object size are not stored.
+func (d *Disk) Add(key, etag string, content []byte) error {
+	if d == nil {
+		return nil
+	}
+	size := int64(len(content))
+	if (d.maxObjectSize > 0 && size > d.maxObjectSize) || size > d.maxBytes {
+		d.Remove(key)
+		return nil
+	}
+
+	// The entry is written to a temporary file, renamed once complete.
+	tmp, err := os.CreateTemp(d.dir, "*"+tempExt)
+	if err != nil {
+		return errors.Wrap(err, "error creating the cache entry")
+	}
+	defer os.Remove(tmp.Name())
+
+	sum := sha256.Sum256(content)
+	header, err := json.Marshal(diskHeader{Key: key, ETag: etag, Size: size, SHA256: hex.EncodeToString(sum[:])})
+	if err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "error encoding the cache entry")
+	}
+	w := bufio.NewWriter(tmp)
+	w.Write(header)
+	w.WriteByte('\n')
+	w.Write(content)
+	if err = w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "error writing the cache entry")
+	}
+
+	d.mu.Lock()
+	if err = os.Rename(tmp.Name(), d.path(key)); err != nil {
+		d.mu.Unlock()
+		return errors.Wrap(err, "error writing the cache entry")
+	}
+	if e, ok := d.elements[key]; ok {
+		heap.Remove(&d.entries, e.index)
+		delete(d.elements, key)
+		d.size -= e.size
+	}
+	// The entries are evicted before the new one is added, which is never
+	// evicted in its place, even if used less frequently.
+	d.evict(size)
+	d.push(&diskElement{key: key, etag: etag, size: size})
+	d.mu.Unlock()
+
+	// The directory is synced for the rename to be durable.
+	if err = syncDir(d.dir); err != nil {
+		return errors.Wrap(err, "error syncing the cache directory")
+	}
+
+	return nil
+}
+
+// Remove removes the entry of the key, if any.
+func (d *Disk) Remove(key string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.remove(key)
+}
+
+// RemovePrefix removes the entries of the keys with the prefix.
+func (d *Disk) RemovePrefix(prefix string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key := range d.elements {
+		if strings.HasPrefix(key, prefix) {
+			d.remove(key)
+		}
+	}
+}
+
+// Size returns the number of entries and the size of their content.
+func (d *Disk) Size() (entries int, bytes int64) {
+	if d == nil {
+		return 0, 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.elements), d.size
+}
+
+// evict removes the entries to evict over the maximum size, less the size to
+// add.
+func (d *Disk) evict(add int64) {
+	for d.size+add > d.maxBytes && d.entries.Len() > 0 {
+		d.removeElement(d.entries.elements[0])
+	}
+}
+
+// push adds the element, as the most recently used one.
+func (d *Disk) push(e *diskElement) {
+	d.use(e)
+	heap.Push(&d.entries, e)
+	d.elements[e.key] = e
+	d.size += e.size
+}
+
+// use marks the element as the most recently used one. The heap must be fixed
+// if the element is in it.
+func (d *Disk) use(e *diskElement) {
+	d.clock++
+	e.used = d.clock
+}
+
+func (d *Disk) remove(key string) {
+	if e, ok := d.elements[key]; ok {
+		d.removeElement(e)
+	}
+}
+
+// removeElement removes the element, and its file, unless its entry has been
+// replaced or removed already.
+func (d *Disk) removeElement(e *diskElement) {
+	if d.elements[e.key] != e {
+		return
+	}
+	heap.Remove(&d.entries, e.index)
+	delete(d.elements, e.key)
+	d.size -= e.size
+	os.Remove(d.path(e.key))
+}
+
+// path returns the path of the entry file of the key.
+func (d *Disk) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+entryExt)
+}
+
+// readHeader returns the header of the entry file.
+func readHeader(path string) (diskHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return diskHeader{}, err
+	}
+	defer f.Close()
+
+	return decodeHeader(bufio.NewReader(f))
+}
+
+func decodeHeader(r *bufio.Reader) (diskHeader, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return diskHeader{}, errors.Wrap(ErrEntryCorrupted, "header incomplete")
+	}
+	var header diskHeader
+	if err = json.Unmarshal(line, &header); err != nil {
+		return diskHeader{}, errors.Wrap(ErrEntryCorrupted, err.Error())
+	}
+
+	return header, nil
+}
+
+// readEntry returns the entry of the key in the entry file of the size, if
+// its content matches its size and checksum. The checksum is computed while
+// the content is read.
+func readEntry(f *os.File, key string, size int64) (Entry, error) {
+	r := bufio.NewReader(f)
+	header, err := decodeHeader(r)
+	if err != nil {
+		return Entry{}, err
+	}
+	if header.Key != key {
+		return Entry{}, errors.Wrapf(ErrEntryCorrupted, "entry of key %s", header.Key)
+	}
+	if header.Size != size {
+		return Entry{}, errors.Wrapf(ErrEntryCorrupted, "size %d of %d indexed", header.Size, size)
+	}
+
+	hash := sha256.New()
+	content := make([]byte, size)
+	if _, err = io.ReadFull(io.TeeReader(r, hash), content); err != nil {
+		return Entry{}, errors.Wrap(ErrEntryCorrupted, "content incomplete")
+	}
+	if n, _ := r.Read(make([]byte, 1)); n > 0 {
+		return Entry{}, errors.Wrap(ErrEntryCorrupted, "content larger than its size")
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != header.SHA256 {
+		return Entry{}, errors.Wrap(ErrEntryCorrupted, "checksum mismatch")
+	}
+
+	return Entry{ETag: header.ETag, Content: content}, nil
+}
+
+// syncDir syncs the directory, e.g. once an entry file is renamed in it.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestDisk(t *testing.T) {
+	dir := t.TempDir()
+	d, err := OpenDisk(dir, WithDiskMaxBytes(10), WithDiskMaxObjectSize(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	add := func(key, etag, content string) {
+		if err := d.Add(key, etag, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	add("a", "etag-a", "aaaa")
+	add("b", "etag-b", "bbbb")
+	if entry, ok, err := d.Get("a"); err != nil || !ok || string(entry.Content) != "aaaa" || entry.ETag != "etag-a" {
+		t.Errorf("got entry %+v, ok %t and error %v, want a", entry, ok, err)
+	}
+	now = now.Add(time.Second)
+
+	// The least recently used entries are evicted over the maximum size.
+	add("c", "etag-c", "cccc")
+	if _, ok, _ := d.Get("b"); ok {
+		t.Error("got entry b, want it evicted")
+	}
+	if entries, bytes := d.Size(); entries != 2 || bytes != 8 {
+		t.Errorf("got %d entries of %d bytes, want 2 of 8", entries, bytes)
+	}
+
+	// The objects over the maximum object size are not cached, and replace
+	// the entries of their key.
+	add("c", "etag-c2", "ccccccc")
+	if _, ok, _ := d.Get("c"); ok {
+		t.Error("got entry c over the max object size, want none")
+	}
+
+	add("bucket/a", "etag", "a")
+	add("bucket2/a", "etag", "a")
+	d.RemovePrefix("bucket/")
+	if _, ok, _ := d.Get("bucket/a"); ok {
+		t.Error("got entry with prefix removed")
+	}
+	if _, ok, _ := d.Get("bucket2/a"); !ok {
+		t.Error("got entry without prefix removed")
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 2 {
+		t.Errorf("got %d files, want 2 of the entries", len(files))
+	}
+}
+
+func TestDiskEviction(t *testing.T) {
+	testCases := []struct {
+		eviction DiskEviction
+		evicted  string
+		kept     string
+	}{
+		{eviction: DiskEvictionLRU, evicted: "a", kept: "b"},
+		{eviction: DiskEvictionLFU, evicted: "b", kept: "a"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(string(tt.eviction), func(t *testing.T) {
+			d, err := OpenDisk(t.TempDir(), WithDiskMaxBytes(10), WithDiskEviction(tt.eviction))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"a", "b"} {
+				if err = d.Add(key, "etag-"+key, []byte("xxxx")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// a is read more frequently, and b more recently.
+			for _, key := range []string{"a", "a", "b"} {
+				if _, ok, _ := d.Get(key); !ok {
+					t.Fatalf("got no entry %s", key)
+				}
+			}
+
+			if err = d.Add("c", "etag-c", []byte("xxxx")); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok, _ := d.Get(tt.evicted); ok {
+				t.Errorf("got entry %s, want it evicted", tt.evicted)
+			}
+			if _, ok, _ := d.Get(tt.kept); !ok {
+				t.Errorf("got no entry %s, want it kept", tt.kept)
+			}
+		})
+	}
+}
+
+func TestDiskConcurrentReplace(t *testing.T) {
+	d, err := OpenDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				content := strings.Repeat(strconv.Itoa(i), j+1)
+				if err := d.Add("a", content, []byte(content)); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				// The entries read are the ones of a file, even if replaced meanwhile.
+				entry, ok, err := d.Get("a")
+				if err != nil {
+					t.Errorf("got error %v reading an entry replaced", err)
+				}
+				if ok && entry.ETag != string(entry.Content) {
+					t.Errorf("got entry of etag %s with content %s", entry.ETag, entry.Content)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if entries, _ := d.Size(); entries != 1 {
+		t.Errorf("got %d entries, want 1", entries)
+	}
+}
+
+func TestDiskRecover(t *testing.T) {
+	dir := t.TempDir()
+	d, err := OpenDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		d.now = func() time.Time { return now }
+		if err = d.Add(key, "etag-"+key, []byte(key+key)); err != nil {
+			t.Fatal(err)
+		}
+		// The recency of the entries is recovered from the modification time.
+		os.Chtimes(d.path(key), now, now)
+		now = now.Add(time.Minute)
+	}
+	d.Get("a")
+
+	// The files being written, and the ones not valid, are removed.
+	os.WriteFile(filepath.Join(dir, "partial"+tempExt), []byte("{"), 0o600)
+	os.WriteFile(filepath.Join(dir, "invalid"+entryExt), []byte("invalid"), 0o600)
+
+	d, err = OpenDisk(dir, WithDiskMaxBytes(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, bytes := d.Size(); entries != 2 || bytes != 4 {
+		t.Errorf("got %d entries of %d bytes, want 2 of 4", entries, bytes)
+	}
+	if entry, ok, err := d.Get("a"); err != nil || !ok || string(entry.Content) != "aa" || entry.ETag != "etag-a" {
+		t.Errorf("got entry %+v, ok %t and error %v, want a recovered", entry, ok, err)
+	}
+	if _, ok, _ := d.Get("b"); ok {
+		t.Error("got entry b, want it evicted as least recently used")
+	}
+	for _, name := range []string{"partial" + tempExt, "invalid" + entryExt} {
+		if _, err = os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("got file %s, want it removed", name)
+		}
+	}
+}
+
+func TestDiskCorrupted(t *testing.T) {
+	d, err := OpenDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Add("a", "etag-a", []byte("aaaa")); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(d.path("a"))
+	content[len(content)-1] = 'b'
+	os.WriteFile(d.path("a"), content, 0o600)
+
+	if _, ok, err := d.Get("a"); ok || !errors.Is(err, ErrEntryCorrupted) {
+		t.Errorf("got ok %t and error %v, want %v", ok, err, ErrEntryCorrupted)
+	}
+	if entries, _ := d.Size(); entries != 0 {
+		t.Errorf("got %d entries, want the corrupted one removed", entries)
+	}
+	if _, err = os.Stat(d.path("a")); !os.IsNotExist(err) {
+		t.Error("got file of the corrupted entry, want it removed")
+	}
+}
+
+func TestDiskNil(t *testing.T) {
+	var d *Disk
+	if err := d.Add("a", "etag", []byte("a")); err != nil {
+		t.Errorf("got error %v, want none", err)
+	}
+	if _, ok, err := d.Get("a"); ok || err != nil {
+		t.Errorf("got ok %t and error %v from nil disk, want none", ok, err)
+	}
+	d.Remove("a")
+	d.RemovePrefix("")
+	if entries, bytes := d.Size(); entries != 0 || bytes != 0 {
+		t.Errorf("got %d entries of %d bytes, want none", entries, bytes)
+	}
+}
@@ -0,0 +1,202 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultReloadInterval = 10 * time.Second
+)
+
+var (
+	ErrCertPoolEmpty = errors.New("no certificates found")
+)
+
+// Reloader serves the TLS certificate, and the CAs of the client certificates
+// if any, from files which are reloaded when they change, e.g. on renewals.
+type Reloader struct {
+	logger *log.Logger
+
+	certFile string
+	keyFile  string
+
+	// clientCAFile is the CA bundle the client certificates are verified
+	// against. The client certificates are not requested when empty.
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+
+	reloadInterval time.Duration
+
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	mu        sync.RWMutex
+}
+
+type Option func(r *Reloader)
+
+func WithLogger(logger *log.Logger) Option {
+	return func(r *Reloader) {
+		r.logger = logger
+	}
+}
+
+// WithClientCA verifies the client certificates against the CA bundle file.
+// The client certificates are required if required is true, and verified if
+// given otherwise.
+func WithClientCA(file string, required bool) Option {
+	return func(r *Reloader) {
+		r.clientCAFile = file
+		r.clientAuth = tls.VerifyClientCertIfGiven
+		if required {
+			r.clientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+}
+
+// WithReloadInterval sets the interval the files are checked for changes at.
+func WithReloadInterval(interval time.Duration) Option {
+	return func(r *Reloader) {
+		r.reloadInterval = interval
+	}
+}
+
+// NewReloader returns a new Reloader of the certificate and key files, which
+// are loaded immediately.
+func NewReloader(certFile, keyFile string, opts ...Option) (*Reloader, error) {
+	r := new(Reloader)
+	r.certFile = certFile
+	r.keyFile = keyFile
+	r.clientAuth = tls.NoClientCert
+	r.reloadInterval = defaultReloadInterval
+	r.modTimes = make(map[string]time.Time)
+
+	for _, f := range opts {
+		f(r)
+	}
+
+	if r.logger == nil {
+		r.logger = log.New()
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// TLSConfig returns the TLS configuration of a server, which serves the
+// current certificate and verifies the client certificates against the
+// current CAs, on every handshake.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   r.clientAuth,
+				ClientCAs:    r.clientCAs,
+			}, nil
+		},
+	}
+}
+
+// Reload loads the files again if any changed since the last load, and returns
+// whether they're reloaded. The current ones are kept, if the changed ones are
+// not valid.
+func (r *Reloader) Reload() (bool, error) {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+
+	r.mu.RLock()
+	previous := r.modTimes
+	r.mu.RUnlock()
+
+	modTimes := make(map[string]time.Time, len(files))
+	changed := false
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, errors.Wrap(err, "error reading tls file")
+		}
+		modTimes[file] = info.ModTime()
+		if !info.ModTime().Equal(previous[file]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, errors.Wrap(err, "error loading tls certificate")
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		if clientCAs, err = LoadCertPool(r.clientCAFile); err != nil {
+			return false, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+
+	return true, nil
+}
+
+// Watch reloads the files when they change, until the context is done.
+func (r *Reloader) Watch(ctx context.Context) {
+	ticker := time.NewTicker(r.reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				r.logger.WithError(err).Error("error reloading tls certificate")
+				continue
+			}
+			if reloaded {
+				r.logger.Info("tls certificate reloaded")
+			}
+		}
+	}
+}
+
+// LoadCertPool returns the pool of the PEM-encoded certificates of the file.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading ca bundle")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, errors.Wrapf(ErrCertPoolEmpty, "ca bundle %s", file)
+	}
+
+	return pool, nil
+}
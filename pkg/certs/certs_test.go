@@ -0,0 +1,173 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// testCert is a certificate, signed by parent or self-signed if nil.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write writes the PEM-encoded certificate and key to the files in dir.
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, "localhost", ca).write(t, dir, "server")
+
+	r, err := NewReloader(certFile, keyFile, WithClientCA(caFile, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = r.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(clientCerts ...tls.Certificate) (*x509.Certificate, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: clientCerts,
+		}}}
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		return res.TLS.PeerCertificates[0], nil
+	}
+
+	client := newTestCert(t, "client", ca)
+	served, err := get(client.tlsCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get(); err == nil {
+		t.Error("got no error without client certificate, want one")
+	}
+	if _, err := get(newTestCert(t, "client", nil).tlsCertificate()); err == nil {
+		t.Error("got no error with client certificate of another ca, want one")
+	}
+
+	// The certificate is served after it's renewed.
+	renewed := newTestCert(t, "localhost", ca)
+	renewed.write(t, dir, "server")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	os.Chtimes(keyFile, future, future)
+	if reloaded, err := r.Reload(); err != nil || !reloaded {
+		t.Fatalf("got reloaded %t, error %v, want reloaded", reloaded, err)
+	}
+	got, err := get(client.tlsCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SerialNumber.Cmp(renewed.cert.SerialNumber) != 0 || got.SerialNumber.Cmp(served.SerialNumber) == 0 {
+		t.Errorf("got serial %s, want renewed %s", got.SerialNumber, renewed.cert.SerialNumber)
+	}
+
+	// The current certificate is kept, if the changed one is not valid.
+	os.WriteFile(keyFile, []byte("not a key"), 0o600)
+	future = future.Add(time.Minute)
+	os.Chtimes(keyFile, future, future)
+	if _, err := r.Reload(); err == nil {
+		t.Error("got no error reloading a key not valid, want one")
+	}
+	if got, err = get(client.tlsCertificate()); err != nil || got.SerialNumber.Cmp(renewed.cert.SerialNumber) != 0 {
+		t.Errorf("got serial %v, error %v, want the renewed certificate", got, err)
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.pem")
+	os.WriteFile(empty, []byte("no certificates"), 0o600)
+
+	if _, err := LoadCertPool(empty); !errors.Is(err, ErrCertPoolEmpty) {
+		t.Errorf("got error %v, want %v", err, ErrCertPoolEmpty)
+	}
+	caFile, _ := newTestCert(t, "ca", nil).write(t, dir, "ca")
+	if _, err := LoadCertPool(caFile); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,187 @@
+package credentials
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/discovery"
+)
+
+const (
+	// fileEnvSuffix is the suffix of the environment variables pointing to a file
+	// which contains the value, e.g. MINIO_ROOT_PASSWORD_FILE.
+	fileEnvSuffix = "_FILE"
+
+	// defaultSecretsDir is the directory in which Docker mounts secrets.
+	// Relative *_FILE paths are resolved against it, as MinIO does.
+	defaultSecretsDir = "/run/secrets"
+)
+
+var (
+	// DefaultAccessKeyEnvVars are the environment variables of the MinIO access key,
+	// in order of precedence: the modern name first, then the legacy one.
+	DefaultAccessKeyEnvVars = []string{"MINIO_ROOT_USER", "MINIO_ACCESS_KEY"}
+
+	// DefaultSecretKeyEnvVars are the environment variables of the MinIO secret key,
+	// in order of precedence: the modern name first, then the legacy one.
+	DefaultSecretKeyEnvVars = []string{"MINIO_ROOT_PASSWORD", "MINIO_SECRET_KEY"}
+)
+
+var (
+	ErrAccessKeyNotFound = errors.New("access key not found")
+	ErrSecretKeyNotFound = errors.New("secret key not found")
+	ErrFileReaderMissing = errors.New("file reader missing")
+)
+
+// Credentials are the credentials to access a MinIO node.
+type Credentials struct {
+	AccessKey string `yaml:"accessKey" toml:"accessKey"`
+	SecretKey string `yaml:"secretKey" toml:"secretKey"`
+}
+
+// FileReader reads a file from the filesystem of a discovered endpoint.
+type FileReader interface {
+	ReadFile(ctx context.Context, id, path string) ([]byte, error)
+}
+
+// Resolver resolves the credentials of MinIO nodes from the environment of the
+// discovered endpoints.
+type Resolver struct {
+	accessKeyEnvVars []string
+	secretKeyEnvVars []string
+
+	// secretsDir is the directory relative *_FILE paths are resolved against.
+	secretsDir string
+
+	fileReader FileReader
+
+	// overrides are the credentials per node, by endpoint name, ID or address.
+	overrides map[string]*Credentials
+}
+
+type Option func(r *Resolver)
+
+func WithAccessKeyEnvVars(names ...string) Option {
+	return func(r *Resolver) {
+		r.accessKeyEnvVars = names
+	}
+}
+
+func WithSecretKeyEnvVars(names ...string) Option {
+	return func(r *Resolver) {
+		r.secretKeyEnvVars = names
+	}
+}
+
+func WithSecretsDir(dir string) Option {
+	return func(r *Resolver) {
+		r.secretsDir = dir
+	}
+}
+
+func WithFileReader(reader FileReader) Option {
+	return func(r *Resolver) {
+		r.fileReader = reader
+	}
+}
+
+// WithOverride sets the credentials of the node identified by its endpoint name,
+// ID or address. Empty fields are resolved from the environment.
+func WithOverride(node string, credentials Credentials) Option {
+	return func(r *Resolver) {
+		r.overrides[node] = &credentials
+	}
+}
+
+// NewResolver returns a new Resolver.
+func NewResolver(opts ...Option) *Resolver {
+	r := new(Resolver)
+	r.accessKeyEnvVars = DefaultAccessKeyEnvVars
+	r.secretKeyEnvVars = DefaultSecretKeyEnvVars
+	r.secretsDir = defaultSecretsDir
+	r.overrides = make(map[string]*Credentials)
+
+	for _, f := range opts {
+		f(r)
+	}
+
+	return r
+}
+
+// Resolve returns the credentials of the node behind the endpoint.
+// Per-node overrides take precedence over the environment. For each environment
+// variable, the plain value takes precedence over the *_FILE variant.
+func (r *Resolver) Resolve(ctx context.Context, endpoint discovery.Endpoint) (*Credentials, error) {
+	creds := new(Credentials)
+	if o := r.override(endpoint); o != nil {
+		*creds = *o
+	}
+
+	var err error
+	if creds.AccessKey == "" {
+		creds.AccessKey, err = r.lookup(ctx, endpoint, r.accessKeyEnvVars)
+		if err != nil {
+			return nil, errors.Wrap(err, "error resolving access key")
+		}
+		if creds.AccessKey == "" {
+			return nil, ErrAccessKeyNotFound
+		}
+	}
+	if creds.SecretKey == "" {
+		creds.SecretKey, err = r.lookup(ctx, endpoint, r.secretKeyEnvVars)
+		if err != nil {
+			return nil, errors.Wrap(err, "error resolving secret key")
+		}
+		if creds.SecretKey == "" {
+			return nil, ErrSecretKeyNotFound
+		}
+	}
+
+	return creds, nil
+}
+
+func (r *Resolver) override(endpoint discovery.Endpoint) *Credentials {
+	for _, k := range []string{endpoint.Name, endpoint.ID, endpoint.Address} {
+		if k == "" {
+			continue
+		}
+		if o, ok := r.overrides[k]; ok {
+			return o
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the value of the first of the environment variables names
+// which is set, either directly or through a file.
+func (r *Resolver) lookup(ctx context.Context, endpoint discovery.Endpoint, names []string) (string, error) {
+	for _, name := range names {
+		if v := endpoint.Env[name]; v != "" {
+			return v, nil
+		}
+
+		file := endpoint.Env[name+fileEnvSuffix]
+		if file == "" {
+			continue
+		}
+		if r.fileReader == nil {
+			return "", ErrFileReaderMissing
+		}
+		if !path.IsAbs(file) {
+			file = path.Join(r.secretsDir, file)
+		}
+
+		b, err := r.fileReader.ReadFile(ctx, endpoint.ID, file)
+		if err != nil {
+			return "", errors.Wrapf(err, "error reading %s", name+fileEnvSuffix)
+		}
+
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	return "", nil
+}
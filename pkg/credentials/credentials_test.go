@@ -0,0 +1,130 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/discovery"
+)
+
+// fakeFileReader reads files from an in-memory map, by container ID and path.
+type fakeFileReader map[string]map[string]string
+
+func (f fakeFileReader) ReadFile(_ context.Context, id, path string) ([]byte, error) {
+	content, ok := f[id][path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return []byte(content), nil
+}
+
+func TestResolverResolve(t *testing.T) {
+	files := fakeFileReader{
+		"c1": {
+			"/run/secrets/minio_user":     "secretuser\n",
+			"/run/secrets/minio_password": "secretpassword\n",
+			"/etc/minio/password":         "filepassword",
+		},
+	}
+
+	testCases := []struct {
+		name    string
+		given   []Option
+		in      discovery.Endpoint
+		want    *Credentials
+		wantErr error
+	}{
+		{
+			name: "with legacy variables",
+			in: discovery.Endpoint{Env: map[string]string{
+				"MINIO_ACCESS_KEY": "ring", "MINIO_SECRET_KEY": "treepotato",
+			}},
+			want: &Credentials{AccessKey: "ring", SecretKey: "treepotato"},
+		},
+		{
+			name: "with modern variables taking precedence",
+			in: discovery.Endpoint{Env: map[string]string{
+				"MINIO_ROOT_USER": "root", "MINIO_ROOT_PASSWORD": "rootpassword",
+				"MINIO_ACCESS_KEY": "ring", "MINIO_SECRET_KEY": "treepotato",
+			}},
+			want: &Credentials{AccessKey: "root", SecretKey: "rootpassword"},
+		},
+		{
+			name:  "with docker secrets",
+			given: []Option{WithFileReader(files)},
+			in: discovery.Endpoint{ID: "c1", Env: map[string]string{
+				"MINIO_ROOT_USER_FILE": "minio_user", "MINIO_ROOT_PASSWORD_FILE": "minio_password",
+			}},
+			want: &Credentials{AccessKey: "secretuser", SecretKey: "secretpassword"},
+		},
+		{
+			name:  "with absolute file path",
+			given: []Option{WithFileReader(files)},
+			in: discovery.Endpoint{ID: "c1", Env: map[string]string{
+				"MINIO_ROOT_USER": "root", "MINIO_ROOT_PASSWORD_FILE": "/etc/minio/password",
+			}},
+			want: &Credentials{AccessKey: "root", SecretKey: "filepassword"},
+		},
+		{
+			name: "with override by name",
+			given: []Option{
+				WithOverride("node-1", Credentials{AccessKey: "override", SecretKey: "overridesecret"}),
+			},
+			in: discovery.Endpoint{Name: "node-1", Env: map[string]string{
+				"MINIO_ACCESS_KEY": "ring", "MINIO_SECRET_KEY": "treepotato",
+			}},
+			want: &Credentials{AccessKey: "override", SecretKey: "overridesecret"},
+		},
+		{
+			name:  "with partial override by address",
+			given: []Option{WithOverride("10.0.0.2:9000", Credentials{SecretKey: "overridesecret"})},
+			in: discovery.Endpoint{Address: "10.0.0.2:9000", Env: map[string]string{
+				"MINIO_ACCESS_KEY": "ring", "MINIO_SECRET_KEY": "treepotato",
+			}},
+			want: &Credentials{AccessKey: "ring", SecretKey: "overridesecret"},
+		},
+		{
+			name:  "with custom variables",
+			given: []Option{WithAccessKeyEnvVars("ACCESS"), WithSecretKeyEnvVars("SECRET")},
+			in: discovery.Endpoint{Env: map[string]string{
+				"ACCESS": "custom", "SECRET": "customsecret", "MINIO_ROOT_USER": "root",
+			}},
+			want: &Credentials{AccessKey: "custom", SecretKey: "customsecret"},
+		},
+		{
+			name:    "with missing secret key",
+			in:      discovery.Endpoint{Env: map[string]string{"MINIO_ROOT_USER": "root"}},
+			wantErr: ErrSecretKeyNotFound,
+		},
+		{
+			name:    "with file and no file reader",
+			in:      discovery.Endpoint{Env: map[string]string{"MINIO_ROOT_USER_FILE": "minio_user"}},
+			wantErr: ErrFileReaderMissing,
+		},
+		{
+			name:  "with missing file",
+			given: []Option{WithFileReader(files)},
+			in: discovery.Endpoint{ID: "c2", Env: map[string]string{
+				"MINIO_ROOT_USER_FILE": "minio_user",
+			}},
+			wantErr: os.ErrNotExist,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewResolver(tt.given...).Resolve(context.Background(), tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
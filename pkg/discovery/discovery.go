@@ -5,6 +5,31 @@ type Discoverer interface {
 }
 
 type Endpoint struct {
+	// ID is the unique identifier of the endpoint, e.g. the container ID.
+	ID string
+
+	// Name is the human-readable name of the endpoint, e.g. the container name.
+	Name string
+
 	Address string
 	Env     map[string]string
+
+	// Labels are the metadata of the endpoint, e.g. the container labels.
+	Labels map[string]string
+}
+
+type EventType string
+
+const (
+	EventStart EventType = "start"
+	EventStop  EventType = "stop"
+)
+
+// Event is a change of the set of endpoints.
+type Event struct {
+	Type EventType
+
+	// ID and Name are the ones of the endpoint which changed.
+	ID   string
+	Name string
 }
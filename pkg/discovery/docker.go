@@ -1,70 +1,154 @@
 package discovery
 
 import (
+	"archive/tar"
 	"context"
-	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	docker "github.com/docker/docker/client"
-	"strings"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 const (
 	containerStatusRunning = "running"
+
+	// DefaultPortLabel is the container label which specifies the port the
+	// endpoint listens on.
+	DefaultPortLabel = "homework-object-storage.port"
+
+	// WeightLabel is the container label which specifies the relative share
+	// of the keys the endpoint stores.
+	WeightLabel = "homework-object-storage.weight"
+
+	// The container labels which specify the TLS of the connections to the
+	// endpoint, overriding the defaults of the gateway. The CA bundle file is
+	// on the gateway filesystem.
+	TLSLabel                   = "homework-object-storage.tls"
+	TLSCAFileLabel             = "homework-object-storage.tls.ca-file"
+	TLSServerNameLabel         = "homework-object-storage.tls.server-name"
+	TLSInsecureSkipVerifyLabel = "homework-object-storage.tls.insecure-skip-verify"
+
+	portProtocolTCP = "tcp"
+
+	containerEventStart = "start"
+	containerEventDie   = "die"
 )
 
+var (
+	ErrPortNotFound    = errors.New("endpoint port not found")
+	ErrPortNotValid    = errors.New("endpoint port not valid")
+	ErrNetworkNotFound = errors.New("network not found")
+)
+
+// DockerClient is the subset of the Docker Engine API client used by the
+// DockerDiscoverer.
+type DockerClient interface {
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error)
+	Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error)
+}
+
 // DockerDiscoverer is a discoverer of Docker containers.
 type DockerDiscoverer struct {
-	client  *docker.Client
+	client DockerClient
+
+	// network is the name of the network the endpoints are reachable at.
+	// When empty, it's auto-detected as the network shared with self.
 	network string
+
+	// self is the ID or name of the container the discoverer runs in.
+	self string
+
+	// portLabel is the container label which specifies the endpoint port.
+	portLabel string
+
+	logger *log.Logger
 }
 
 type DockerOption func(d *DockerDiscoverer)
 
+// WithNetwork sets the name of the network the endpoints are reachable at.
+// When not set, the network shared with the discoverer's own container is used.
 func WithNetwork(network string) DockerOption {
 	return func(d *DockerDiscoverer) {
 		d.network = network
 	}
 }
 
-func NewDockerDiscovererFromClient(client *docker.Client, options ...DockerOption) *DockerDiscoverer {
+// WithSelf sets the ID or name of the container the discoverer runs in.
+// By default it's the hostname, which Docker sets to the container ID.
+func WithSelf(self string) DockerOption {
+	return func(d *DockerDiscoverer) {
+		d.self = self
+	}
+}
+
+func WithPortLabel(label string) DockerOption {
+	return func(d *DockerDiscoverer) {
+		d.portLabel = label
+	}
+}
+
+func WithDockerLogger(logger *log.Logger) DockerOption {
+	return func(d *DockerDiscoverer) {
+		d.logger = logger
+	}
+}
+
+func NewDockerDiscovererFromClient(client DockerClient, options ...DockerOption) *DockerDiscoverer {
 	discoverer := new(DockerDiscoverer)
 	discoverer.client = client
+	discoverer.self, _ = os.Hostname()
+	discoverer.portLabel = DefaultPortLabel
 
 	for _, f := range options {
 		f(discoverer)
 	}
 
+	if discoverer.logger == nil {
+		discoverer.logger = log.New()
+		discoverer.logger.SetOutput(io.Discard)
+	}
+
 	return discoverer
 }
 
 // DiscoverEndpoints returns a list of container endpoints and container environment,
 // selected by label.
-// The endpoint port can be overridden with portOverride argument.
+// The endpoint port can be overridden with portOverride argument, otherwise it's
+// resolved for each container from the port label, the published ports and the
+// exposed ports, in this order.
+// Containers which don't share a network with the discoverer are skipped.
 func (c *DockerDiscoverer) DiscoverEndpoints(ctx context.Context, labelSelectors []string,
 	portOverride ...uint16) ([]Endpoint, error) {
-	cli, err := docker.NewClientWithOpts(docker.FromEnv)
-	if err != nil {
-		return nil, err
-	}
-	defer cli.Close()
-
-	// Supported filters: https://docs.docker.com/engine/api/v1.24/.
-	args := []filters.KeyValuePair{}
-	for _, v := range labelSelectors {
-		args = append(args, filters.Arg("label", fmt.Sprintf("%s", v)))
+	args := c.labelFilters(labelSelectors)
+	if c.network != "" {
+		args = append(args, filters.Arg("network", c.network))
 	}
-
-	args = append(args, filters.Arg("network", c.network))
 	args = append(args, filters.Arg("status", containerStatusRunning))
 
-	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+	containers, err := c.client.ContainerList(ctx, types.ContainerListOptions{
 		Filters: filters.NewArgs(args...),
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	networks, err := c.networks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var port uint16
 	if len(portOverride) > 0 {
 		port = portOverride[0]
@@ -73,22 +157,37 @@ func (c *DockerDiscoverer) DiscoverEndpoints(ctx context.Context, labelSelectors
 	endpoints := []Endpoint{}
 	for _, container := range containers {
 		e := new(Endpoint)
-
-		if port == 0 && len(container.Ports) > 0 {
-			port = container.Ports[0].PrivatePort
+		e.ID = container.ID
+		e.Labels = container.Labels
+		if len(container.Names) > 0 {
+			e.Name = strings.TrimPrefix(container.Names[0], "/")
 		}
 
-		e.Address = fmt.Sprintf("%s:%d", container.NetworkSettings.Networks[c.network].IPAddress, port)
-		inspect, err := cli.ContainerInspect(ctx, container.ID)
+		inspect, err := c.client.ContainerInspect(ctx, container.ID)
 		if err != nil {
 			return nil, err
 		}
 
+		ip := c.address(inspect, networks)
+		if ip == "" {
+			c.logger.Debugf("skipping container %s: no network shared with the gateway", e.Name)
+			continue
+		}
+
+		p := port
+		if p == 0 {
+			p, err = c.port(container, inspect)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error resolving port of container %s", e.Name)
+			}
+		}
+		e.Address = net.JoinHostPort(ip, strconv.Itoa(int(p)))
+
 		if inspect.Config != nil {
 			e.Env = make(map[string]string, len(inspect.Config.Env))
 			for _, env := range inspect.Config.Env {
-				s := strings.Split(env, "=")
-				e.Env[s[0]] = s[1]
+				k, v, _ := strings.Cut(env, "=")
+				e.Env[k] = v
 			}
 		}
 
@@ -97,3 +196,197 @@ func (c *DockerDiscoverer) DiscoverEndpoints(ctx context.Context, labelSelectors
 
 	return endpoints, nil
 }
+
+// Watch notifies the start and the stop of the containers selected by label,
+// until the context is done or the Docker events stream fails.
+// Both channels are closed when watching stops.
+func (c *DockerDiscoverer) Watch(ctx context.Context, labelSelectors []string) (<-chan Event, <-chan error) {
+	args := c.labelFilters(labelSelectors)
+	args = append(args,
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("event", containerEventStart),
+		filters.Arg("event", containerEventDie),
+	)
+
+	msgs, errs := c.client.Events(ctx, types.EventsOptions{Filters: filters.NewArgs(args...)})
+
+	eventCh := make(chan Event)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(eventCh)
+		defer close(errCh)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-errs:
+				if err != nil && ctx.Err() == nil {
+					errCh <- errors.Wrap(err, "error watching docker events")
+				}
+				return
+			case msg := <-msgs:
+				e := Event{ID: msg.Actor.ID, Name: msg.Actor.Attributes["name"]}
+				switch msg.Action {
+				case containerEventStart:
+					e.Type = EventStart
+				case containerEventDie:
+					e.Type = EventStop
+				default:
+					continue
+				}
+
+				select {
+				case eventCh <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return eventCh, errCh
+}
+
+func (c *DockerDiscoverer) labelFilters(labelSelectors []string) []filters.KeyValuePair {
+	// Supported filters: https://docs.docker.com/engine/api/v1.24/.
+	args := []filters.KeyValuePair{}
+	for _, v := range labelSelectors {
+		args = append(args, filters.Arg("label", v))
+	}
+
+	return args
+}
+
+// networks returns the names of the networks the endpoints can be reached at,
+// in order of preference.
+// If the network is not configured, the networks of the discoverer's own container
+// are returned. If that is not a container, nil is returned, meaning any network.
+func (c *DockerDiscoverer) networks(ctx context.Context) ([]string, error) {
+	if c.network != "" {
+		return []string{c.network}, nil
+	}
+	if c.self == "" {
+		return nil, nil
+	}
+
+	self, err := c.client.ContainerInspect(ctx, c.self)
+	if err != nil {
+		if docker.IsErrNotFound(err) {
+			c.logger.Debugf("container %s not found, not running in a container", c.self)
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error inspecting the gateway container")
+	}
+	if self.NetworkSettings == nil || len(self.NetworkSettings.Networks) == 0 {
+		return nil, ErrNetworkNotFound
+	}
+
+	return sortedKeys(self.NetworkSettings.Networks), nil
+}
+
+// address returns the IP address of the container in the first of the networks
+// the container is attached to. IPv4 addresses are preferred over IPv6 ones.
+// If networks is nil, any network of the container is considered.
+func (c *DockerDiscoverer) address(inspect types.ContainerJSON, networks []string) string {
+	if inspect.NetworkSettings == nil {
+		return ""
+	}
+	if networks == nil {
+		networks = sortedKeys(inspect.NetworkSettings.Networks)
+	}
+
+	for _, name := range networks {
+		settings, ok := inspect.NetworkSettings.Networks[name]
+		if !ok || settings == nil {
+			continue
+		}
+		if settings.IPAddress != "" {
+			return settings.IPAddress
+		}
+		if settings.GlobalIPv6Address != "" {
+			return settings.GlobalIPv6Address
+		}
+	}
+
+	return ""
+}
+
+// port returns the port of the container from the port label, the lowest
+// published TCP port, or the lowest exposed TCP port, in this order.
+func (c *DockerDiscoverer) port(container types.Container, inspect types.ContainerJSON) (uint16, error) {
+	if v, ok := container.Labels[c.portLabel]; ok {
+		p, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || p == 0 {
+			return 0, errors.Wrapf(ErrPortNotValid, "label %s=%s", c.portLabel, v)
+		}
+		return uint16(p), nil
+	}
+
+	var port uint16
+	for _, p := range container.Ports {
+		if p.Type != portProtocolTCP || p.PrivatePort == 0 {
+			continue
+		}
+		if port == 0 || p.PrivatePort < port {
+			port = p.PrivatePort
+		}
+	}
+	if port != 0 {
+		return port, nil
+	}
+
+	if inspect.Config != nil {
+		for p := range inspect.Config.ExposedPorts {
+			if p.Proto() != portProtocolTCP || p.Int() <= 0 {
+				continue
+			}
+			if port == 0 || uint16(p.Int()) < port {
+				port = uint16(p.Int())
+			}
+		}
+	}
+	if port == 0 {
+		return 0, ErrPortNotFound
+	}
+
+	return port, nil
+}
+
+// ReadFile returns the content of the file at path, in the filesystem of the container
+// with the specified ID.
+// The file is read through the Docker API archive endpoint, so that files which are not
+// available to the discoverer, like Docker secrets, can be read as well.
+func (c *DockerDiscoverer) ReadFile(ctx context.Context, containerID, path string) ([]byte, error) {
+	rc, _, err := c.client.CopyFromContainer(ctx, containerID, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.Errorf("file %s not found in container %s", path, containerID)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading archive")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		return io.ReadAll(tr)
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,208 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	docker "github.com/docker/docker/client"
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/internal/dockertest"
+)
+
+// newFakeDockerClient starts a fake Docker daemon serving the containers, and
+// returns a client for it.
+func newFakeDockerClient(t *testing.T, containers ...dockertest.Container) (*docker.Client, *dockertest.Server) {
+	srv := dockertest.NewServer(containers...)
+	t.Cleanup(srv.Close)
+
+	cli, err := srv.DockerClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+
+	return cli, srv
+}
+
+func endpointSettings(ipv4, ipv6 string) *network.EndpointSettings {
+	return &network.EndpointSettings{IPAddress: ipv4, GlobalIPv6Address: ipv6}
+}
+
+func TestDockerDiscovererDiscoverEndpoints(t *testing.T) {
+	minioLabels := map[string]string{"name": "MinIO"}
+	minioPorts := []types.Port{
+		{PrivatePort: 9001, PublicPort: 9001, Type: "tcp"},
+		{PrivatePort: 9000, PublicPort: 9011, Type: "tcp"},
+	}
+
+	gateway := dockertest.Container{
+		ID: "aaaaaaaaaaaa0001", Name: "gateway",
+		Networks: map[string]*network.EndpointSettings{"app": endpointSettings("10.0.0.10", "")},
+	}
+	node1 := dockertest.Container{
+		ID: "bbbbbbbbbbbb0001", Name: "node-1", Labels: minioLabels, Ports: minioPorts,
+		Env:      []string{"MINIO_ACCESS_KEY=ring", "MINIO_SECRET_KEY=tree=potato"},
+		Networks: map[string]*network.EndpointSettings{"app": endpointSettings("10.0.0.2", "")},
+	}
+	node2 := dockertest.Container{
+		ID: "bbbbbbbbbbbb0002", Name: "node-2", Labels: minioLabels, ExposedPorts: []string{"9000/tcp", "9443/tcp"},
+		Networks: map[string]*network.EndpointSettings{
+			"app":   endpointSettings("10.0.0.3", ""),
+			"other": endpointSettings("10.1.0.3", ""),
+		},
+	}
+	node3 := dockertest.Container{
+		ID: "bbbbbbbbbbbb0003", Name: "node-3", Labels: minioLabels, Ports: minioPorts,
+		Networks: map[string]*network.EndpointSettings{"other": endpointSettings("10.1.0.4", "")},
+	}
+	node4 := dockertest.Container{
+		ID: "bbbbbbbbbbbb0004", Name: "node-4",
+		Labels:   map[string]string{"name": "MinIO", DefaultPortLabel: "9100"},
+		Ports:    minioPorts,
+		Networks: map[string]*network.EndpointSettings{"app": endpointSettings("", "fd00::4")},
+	}
+	web := dockertest.Container{
+		ID: "cccccccccccc0001", Name: "web", Ports: minioPorts,
+		Networks: map[string]*network.EndpointSettings{"app": endpointSettings("10.0.0.20", "")},
+	}
+	invalid := dockertest.Container{
+		ID: "dddddddddddd0001", Name: "invalid",
+		Labels:   map[string]string{"name": "MinIO", DefaultPortLabel: "http"},
+		Networks: map[string]*network.EndpointSettings{"app": endpointSettings("10.0.0.30", "")},
+	}
+
+	testCases := []struct {
+		name       string
+		containers []dockertest.Container
+		options    []DockerOption
+		port       []uint16
+		want       []Endpoint
+		wantErr    error
+	}{
+		{
+			name:       "with network shared with the gateway container",
+			containers: []dockertest.Container{gateway, node1, node2, node3, node4, web},
+			options:    []DockerOption{WithSelf("gateway")},
+			want: []Endpoint{
+				{ID: node1.ID, Name: "node-1", Labels: node1.Labels, Address: "10.0.0.2:9000",
+					Env: map[string]string{"MINIO_ACCESS_KEY": "ring", "MINIO_SECRET_KEY": "tree=potato"}},
+				{ID: node2.ID, Name: "node-2", Labels: node2.Labels, Address: "10.0.0.3:9000", Env: map[string]string{}},
+				{ID: node4.ID, Name: "node-4", Labels: node4.Labels, Address: "[fd00::4]:9100", Env: map[string]string{}},
+			},
+		},
+		{
+			name:       "with network configured",
+			containers: []dockertest.Container{gateway, node1, node2, node3},
+			options:    []DockerOption{WithSelf("gateway"), WithNetwork("other")},
+			want: []Endpoint{
+				{ID: node2.ID, Name: "node-2", Labels: node2.Labels, Address: "10.1.0.3:9000", Env: map[string]string{}},
+				{ID: node3.ID, Name: "node-3", Labels: node3.Labels, Address: "10.1.0.4:9000", Env: map[string]string{}},
+			},
+		},
+		{
+			name:       "with port override",
+			containers: []dockertest.Container{gateway, node2, node4},
+			options:    []DockerOption{WithSelf(gateway.ID[:12])},
+			port:       []uint16{9443},
+			want: []Endpoint{
+				{ID: node2.ID, Name: "node-2", Labels: node2.Labels, Address: "10.0.0.3:9443", Env: map[string]string{}},
+				{ID: node4.ID, Name: "node-4", Labels: node4.Labels, Address: "[fd00::4]:9443", Env: map[string]string{}},
+			},
+		},
+		{
+			name:       "with gateway not running in a container",
+			containers: []dockertest.Container{node2, node3},
+			options:    []DockerOption{WithSelf("host")},
+			want: []Endpoint{
+				{ID: node2.ID, Name: "node-2", Labels: node2.Labels, Address: "10.0.0.3:9000", Env: map[string]string{}},
+				{ID: node3.ID, Name: "node-3", Labels: node3.Labels, Address: "10.1.0.4:9000", Env: map[string]string{}},
+			},
+		},
+		{
+			name:       "with port label not valid",
+			containers: []dockertest.Container{gateway, invalid},
+			options:    []DockerOption{WithSelf("gateway")},
+			wantErr:    ErrPortNotValid,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, _ := newFakeDockerClient(t, tt.containers...)
+
+			got, err := NewDockerDiscovererFromClient(cli, tt.options...).
+				DiscoverEndpoints(context.Background(), []string{"name=MinIO"}, tt.port...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerDiscovererReadFile(t *testing.T) {
+	node := dockertest.Container{
+		ID: "bbbbbbbbbbbb0001", Name: "node-1",
+		Files: map[string]string{"/run/secrets/minio_password": "treepotato\n"},
+	}
+	cli, _ := newFakeDockerClient(t, node)
+	d := NewDockerDiscovererFromClient(cli)
+
+	got, err := d.ReadFile(context.Background(), node.ID, "/run/secrets/minio_password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "treepotato\n" {
+		t.Errorf("got %q, want %q", got, "treepotato\n")
+	}
+
+	if _, err = d.ReadFile(context.Background(), node.ID, "/run/secrets/missing"); !docker.IsErrNotFound(err) {
+		t.Errorf("got error %v, want not found", err)
+	}
+}
+
+func TestDockerDiscovererWatch(t *testing.T) {
+	cli, srv := newFakeDockerClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventCh, errCh := NewDockerDiscovererFromClient(cli).Watch(ctx, []string{"app=minio"})
+
+	srv.Start(dockertest.Container{ID: "cccccccccccc0001", Name: "web"})
+	srv.Start(dockertest.Container{ID: "bbbbbbbbbbbb0001", Name: "node-1", Labels: map[string]string{"app": "minio"}})
+	srv.Stop("cccccccccccc0001")
+	srv.Stop("bbbbbbbbbbbb0001")
+
+	want := []Event{
+		{Type: EventStart, ID: "bbbbbbbbbbbb0001", Name: "node-1"},
+		{Type: EventStop, ID: "bbbbbbbbbbbb0001", Name: "node-1"},
+	}
+	for _, w := range want {
+		select {
+		case got := <-eventCh:
+			if !reflect.DeepEqual(got, w) {
+				t.Errorf("got %v, want %v", got, w)
+			}
+		case err := <-errCh:
+			t.Fatalf("got error %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for event %v", w)
+		}
+	}
+
+	cancel()
+	if _, ok := <-eventCh; ok {
+		t.Error("event channel not closed after cancel")
+	}
+}
@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// logAccess writes the access log of the request. The successful requests are
+// sampled with the access log sample ratio, while the failed ones are always logged.
+func (g *Gateway) logAccess(r *http.Request, info *requestInfo, rw *responseWriter, received int64,
+	duration time.Duration) {
+	if g.accessLogger == nil {
+		return
+	}
+
+	objectKey, nodeID, err := info.get()
+	failed := err != nil || rw.status >= http.StatusInternalServerError
+	if !failed && g.accessLogSampleRatio < 1 && rand.Float64() >= g.accessLogSampleRatio {
+		return
+	}
+
+	clientIP, _, splitErr := net.SplitHostPort(r.RemoteAddr)
+	if splitErr != nil {
+		clientIP = r.RemoteAddr
+	}
+
+	entry := g.accessLogger.WithFields(log.Fields{
+		"request_id":     info.requestID,
+		"method":         r.Method,
+		"path":           r.URL.Path,
+		"key":            objectKey,
+		"node":           nodeID,
+		"status":         rw.status,
+		"bytes_received": received,
+		"bytes_sent":     rw.bytes,
+		"duration_ms":    float64(duration.Microseconds()) / 1000,
+		"client_ip":      clientIP,
+		"user_agent":     r.UserAgent(),
+		"principal":      info.getPrincipal(),
+		"tenant":         getRequestTenant(r.Context()),
+	})
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+
+	entry.Info("access")
+}
@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maxgio92/homework-object-storage/internal/output"
+)
+
+func TestAccessLog(t *testing.T) {
+	testCases := []struct {
+		name          string
+		sampleRatio   float64
+		method        string
+		path          string
+		requestID     string
+		wantStatus    int
+		wantLogged    bool
+		wantRequestID string
+		wantError     bool
+	}{
+		{name: "with request id", sampleRatio: 1, method: http.MethodPut, path: "/object/hello", requestID: "abc-123",
+			wantStatus: http.StatusOK, wantLogged: true, wantRequestID: "abc-123"},
+		{name: "without request id", sampleRatio: 1, method: http.MethodPut, path: "/object/hello",
+			wantStatus: http.StatusOK, wantLogged: true},
+		{name: "with request id not valid", sampleRatio: 1, method: http.MethodPut, path: "/object/hello", requestID: "abc\n123",
+			wantStatus: http.StatusOK, wantLogged: true},
+		{name: "with success not sampled", sampleRatio: 0, method: http.MethodPut, path: "/object/hello",
+			wantStatus: http.StatusOK},
+		{name: "with error not sampled", sampleRatio: 0, method: http.MethodGet, path: "/object/missing",
+			wantStatus: http.StatusNotFound, wantLogged: true, wantError: true},
+		{name: "with route not found", sampleRatio: 1, method: http.MethodGet, path: "/unknown",
+			wantStatus: http.StatusNotFound, wantLogged: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			gw, _ := newTestGateway(t, 1, WithAccessLog(output.NewJSONLogger(output.WithOutput(buf)), tt.sampleRatio))
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("hello world"))
+			if tt.requestID != "" {
+				req.Header.Set(requestIDHeader, tt.requestID)
+			}
+			rec := httptest.NewRecorder()
+			gw.r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			requestID := rec.Header().Get(requestIDHeader)
+			if requestID == "" {
+				t.Error("got no request id header, want it")
+			}
+			if tt.wantRequestID != "" && requestID != tt.wantRequestID {
+				t.Errorf("got request id %s, want %s", requestID, tt.wantRequestID)
+			}
+
+			if !tt.wantLogged {
+				if buf.Len() > 0 {
+					t.Errorf("got access log %s, want none", buf)
+				}
+				return
+			}
+
+			var entry map[string]any
+			if err := json.NewDecoder(buf).Decode(&entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry["request_id"] != requestID {
+				t.Errorf("got logged request id %v, want %s", entry["request_id"], requestID)
+			}
+			if entry["status"] != float64(tt.wantStatus) {
+				t.Errorf("got logged status %v, want %d", entry["status"], tt.wantStatus)
+			}
+			if entry["method"] != tt.method || entry["path"] != tt.path {
+				t.Errorf("got logged %v %v, want %s %s", entry["method"], entry["path"], tt.method, tt.path)
+			}
+			if _, ok := entry["error"]; ok != tt.wantError {
+				t.Errorf("got logged error %v, want error %t", entry["error"], tt.wantError)
+			}
+		})
+	}
+}
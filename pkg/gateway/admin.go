@@ -0,0 +1,413 @@
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+)
+
+const (
+	bearerPrefix = "Bearer "
+)
+
+var (
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrReloadNotSupported = errors.New("reload not supported")
+	ErrDrainInProgress    = errors.New("drain in progress")
+	ErrNodePoolReplaced   = errors.New("node pool replaced")
+)
+
+// AddAdminRoutes adds the admin API routes, authenticated with the admin token.
+func (g *Gateway) AddAdminRoutes(r *mux.Router) {
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(g.adminAuthMiddleware)
+	adminRouter.Methods(http.MethodPost).Path("/reload").HandlerFunc(g.ReloadHandler)
+	adminRouter.Methods(http.MethodGet).Path("/ring").HandlerFunc(g.RingHandler)
+	adminRouter.Methods(http.MethodGet).Path(fmt.Sprintf("/locate/{key:%s}", objectKeyRegex)).HandlerFunc(g.LocateHandler)
+	adminRouter.Methods(http.MethodGet).Path("/nodes").HandlerFunc(g.NodesHandler)
+	adminRouter.Methods(http.MethodPost).Path("/nodes/{id}/cordon").HandlerFunc(g.nodeOperationHandler(g.cordonNode))
+	adminRouter.Methods(http.MethodPost).Path("/nodes/{id}/uncordon").HandlerFunc(g.nodeOperationHandler(g.uncordonNode))
+	adminRouter.Methods(http.MethodPost).Path("/nodes/{id}/drain").HandlerFunc(g.nodeOperationHandler(g.drainNode))
+	adminRouter.Methods(http.MethodDelete).Path("/nodes/{id}").HandlerFunc(g.nodeOperationHandler(g.removeNode))
+	adminRouter.Methods(http.MethodGet).Path("/limits").HandlerFunc(g.LimitsHandler)
+	adminRouter.Methods(http.MethodPut).Path("/limits").HandlerFunc(g.SetLimitsHandler)
+	adminRouter.Methods(http.MethodGet).Path("/quotas").HandlerFunc(g.QuotasHandler)
+	adminRouter.Methods(http.MethodPost).Path("/quotas/refresh").HandlerFunc(g.RefreshQuotasHandler)
+}
+
+// ring is the hash ring of the node pool, as served by the admin API.
+type ring struct {
+	ReplicationFactor int        `json:"replicationFactor"`
+	VirtualNodes      int        `json:"virtualNodes"`
+	Nodes             []ringNode `json:"nodes"`
+}
+
+type ringNode struct {
+	ID           string        `json:"id"`
+	Weight       int           `json:"weight"`
+	KeyShare     float64       `json:"keyShare"`
+	VirtualNodes []virtualNode `json:"virtualNodes"`
+}
+
+type virtualNode struct {
+	ID   string `json:"id"`
+	Hash uint32 `json:"hash"`
+}
+
+// placement is where an object is stored, as served by the admin API.
+type placement struct {
+	Key      string   `json:"key"`
+	Hash     uint32   `json:"hash"`
+	Primary  string   `json:"primary"`
+	Replicas []string `json:"replicas"`
+}
+
+// node is the config and the health of a node, as served by the admin API.
+// The node credentials are never served.
+type node struct {
+	ID       string     `json:"id"`
+	Endpoint string     `json:"endpoint"`
+	Weight   int        `json:"weight"`
+	State    string     `json:"state"`
+	Health   nodeHealth `json:"health"`
+}
+
+// ReloadHandler reloads the gateway, e.g. rebuilding and swapping the node pool.
+func (g *Gateway) ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if g.reloadFunc == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(ErrReloadNotSupported.Error())
+		return
+	}
+
+	if err := g.reloadFunc(r.Context()); err != nil {
+		g.logger.WithError(err).Error("error reloading the gateway")
+
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+
+	g.logger.
+		WithField("operation", "reload").
+		Info("admin request")
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode("reloaded")
+}
+
+// adminAuthMiddleware rejects the requests without the admin bearer token.
+func (g *Gateway) adminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !bearerAuthorized(r, g.adminToken) {
+			g.logger.Debug("admin request unauthorized")
+
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(ErrUnauthorized.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bearerAuthorized returns whether the request has the bearer token.
+func bearerAuthorized(r *http.Request, token string) bool {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), bearerPrefix)
+
+	return ok && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
+
+// RingHandler returns the nodes on the hash ring, with their virtual nodes and weights.
+func (g *Gateway) RingHandler(w http.ResponseWriter, r *http.Request) {
+	nodePool := g.NodePool()
+	if nodePool == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
+		return
+	}
+
+	res := ring{
+		ReplicationFactor: nodePool.ReplicationFactor(),
+		VirtualNodes:      nodePool.VirtualNodes(),
+		Nodes:             []ringNode{},
+	}
+	for _, n := range nodePool.Ring() {
+		rn := ringNode{ID: n.ID, Weight: n.Weight, KeyShare: n.KeyShare, VirtualNodes: make([]virtualNode, len(n.VirtualNodes))}
+		for i, v := range n.VirtualNodes {
+			rn.VirtualNodes[i] = virtualNode{ID: v.ID, Hash: v.Hash}
+		}
+		res.Nodes = append(res.Nodes, rn)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// LocateHandler returns the primary and the replica nodes of an object key.
+func (g *Gateway) LocateHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if err := g.validateObjectKey(r.Context(), key); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+
+	nodePool := g.NodePool()
+	if nodePool == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
+		return
+	}
+
+	nodeIDs := nodePool.ObjectToNodeIDs(key)
+	if len(nodeIDs) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(placement{
+		Key:      key,
+		Hash:     nodepool.KeyHash(key),
+		Primary:  nodeIDs[0],
+		Replicas: nodeIDs[1:],
+	})
+}
+
+// NodesHandler returns the config, without credentials, and the health of each node.
+func (g *Gateway) NodesHandler(w http.ResponseWriter, r *http.Request) {
+	nodePool := g.NodePool()
+	if nodePool == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
+		return
+	}
+
+	health := make(map[string]nodepool.NodeHealth)
+	for _, h := range nodePool.Health() {
+		health[h.ID] = h
+	}
+
+	configs := nodePool.NodeConfigs()
+	nodes := make([]node, len(configs))
+	for i, c := range configs {
+		nodes[i] = newNode(nodePool, c, health)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(nodes)
+}
+
+func newNode(nodePool *nodepool.NodePool, config *nodepool.NodeConfig, health map[string]nodepool.NodeHealth) node {
+	h, ok := health[config.Endpoint()]
+	if !ok {
+		h = nodepool.NodeHealth{ID: config.Endpoint()}
+	}
+
+	return node{
+		ID:       config.Endpoint(),
+		Endpoint: config.Endpoint(),
+		Weight:   config.Weight(),
+		State:    string(nodePool.NodeState(config.Endpoint())),
+		Health:   newNodeHealth(h),
+	}
+}
+
+// nodeOperation changes the state of a node of the node pool.
+type nodeOperation func(nodePool *nodepool.NodePool, id string) error
+
+// nodeOperationHandler returns the handler of the node operation, which
+// responds with the node as of after the operation.
+func (g *Gateway) nodeOperationHandler(op nodeOperation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodePool := g.NodePool()
+		if nodePool == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		if err := op(nodePool, id); err != nil {
+			setRequestError(r.Context(), err)
+
+			w.WriteHeader(nodeOperationStatusCode(err))
+			json.NewEncoder(w).Encode(err.Error())
+			return
+		}
+
+		g.logger.
+			WithField("operation", r.URL.Path).
+			WithField("node id", id).
+			Info("admin request")
+
+		health := make(map[string]nodepool.NodeHealth)
+		for _, h := range nodePool.Health() {
+			health[h.ID] = h
+		}
+		for _, c := range nodePool.NodeConfigs() {
+			if c.Endpoint() == id {
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(newNode(nodePool, c, health))
+				return
+			}
+		}
+	}
+}
+
+func (g *Gateway) cordonNode(nodePool *nodepool.NodePool, id string) error {
+	return nodePool.Cordon(id)
+}
+
+func (g *Gateway) uncordonNode(nodePool *nodepool.NodePool, id string) error {
+	return nodePool.Uncordon(id)
+}
+
+// drainNode marks the node as draining, and copies its objects in the background.
+// The node can't be drained again until its drain in progress returns.
+func (g *Gateway) drainNode(nodePool *nodepool.NodePool, id string) error {
+	g.drainsMu.Lock()
+	defer g.drainsMu.Unlock()
+
+	d, err := g.drainsOf(nodePool)
+	if err != nil {
+		return err
+	}
+	if d.isRunning(id) {
+		return errors.Wrapf(ErrDrainInProgress, "node %s", id)
+	}
+	if err := nodePool.StartDrain(id); err != nil {
+		return err
+	}
+	g.drain(d, id)
+
+	return nil
+}
+
+func (g *Gateway) removeNode(nodePool *nodepool.NodePool, id string) error {
+	return nodePool.Remove(id)
+}
+
+// drains are the drains in progress of the nodes of a node pool, at most one
+// per node. They are cancelled together, when the node pool is replaced.
+type drains struct {
+	nodePool *nodepool.NodePool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]struct{}
+}
+
+func (d *drains) isRunning(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, ok := d.running[id]
+
+	return ok
+}
+
+// drainsOf returns the drains of the node pool, stopping the ones of the
+// previous node pool. The node pool must be the current one.
+// It must be called with drainsMu held.
+func (g *Gateway) drainsOf(nodePool *nodepool.NodePool) (*drains, error) {
+	if g.drains != nil && g.drains.nodePool == nodePool {
+		return g.drains, nil
+	}
+	if nodePool != g.NodePool() {
+		return nil, ErrNodePoolReplaced
+	}
+	g.stopDrains()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g.drains = &drains{nodePool: nodePool, ctx: ctx, cancel: cancel, running: make(map[string]struct{})}
+
+	return g.drains, nil
+}
+
+// stopDrains cancels the drains in progress, and waits for them to return, so
+// that their node pool doesn't write its node states anymore.
+// It must be called with drainsMu held.
+func (g *Gateway) stopDrains() {
+	if g.drains == nil {
+		return
+	}
+	g.drains.cancel()
+	g.drains.wg.Wait()
+	g.drains = nil
+}
+
+// drain copies the objects of the draining node in the background, unless
+// they're being copied already. The node stays draining if it fails or it's
+// cancelled, and it can be drained again.
+func (g *Gateway) drain(d *drains, id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.running[id]; ok {
+		return
+	}
+	d.running[id] = struct{}{}
+	d.wg.Add(1)
+
+	go func() {
+		defer d.wg.Done()
+
+		err := d.nodePool.Drain(d.ctx, id, g.region, g.ownsBucket)
+		switch {
+		case err != nil && d.ctx.Err() != nil:
+			g.logger.Infof("drain of node %s cancelled", id)
+		case err != nil:
+			g.logger.WithError(err).Errorf("error draining node %s", id)
+		}
+
+		d.mu.Lock()
+		delete(d.running, id)
+		d.mu.Unlock()
+	}()
+}
+
+// resumeDrains resumes draining the nodes which were draining when the node
+// pool state was persisted, e.g. before a restart or a reload.
+func (g *Gateway) resumeDrains(nodePool *nodepool.NodePool) {
+	g.drainsMu.Lock()
+	defer g.drainsMu.Unlock()
+
+	d, err := g.drainsOf(nodePool)
+	if err != nil {
+		return
+	}
+	for _, id := range nodePool.NodesInState(nodepool.NodeStateDraining) {
+		g.logger.Infof("resuming drain of node %s", id)
+		g.drain(d, id)
+	}
+}
+
+// nodeOperationStatusCode returns the HTTP status code of the error of a node operation.
+func nodeOperationStatusCode(err error) int {
+	switch {
+	case errors.Is(err, nodepool.ErrNodeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, nodepool.ErrNodeStateTransition), errors.Is(err, ErrDrainInProgress):
+		return http.StatusConflict
+	case errors.Is(err, ErrNodePoolReplaced):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,374 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+)
+
+func TestReloadHandler(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	var reloads int
+	reloadFunc := func(ctx context.Context) error {
+		reloads++
+		return nil
+	}
+	failingReloadFunc := func(ctx context.Context) error {
+		return errors.New("no nodes found")
+	}
+
+	testCases := []struct {
+		name        string
+		reloadFunc  ReloadFunc
+		token       string
+		wantStatus  int
+		wantReloads int
+	}{
+		{name: "without token", reloadFunc: reloadFunc, token: "", wantStatus: http.StatusUnauthorized},
+		{name: "with wrong token", reloadFunc: reloadFunc, token: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "with token", reloadFunc: reloadFunc, token: "secret", wantStatus: http.StatusOK, wantReloads: 1},
+		{name: "with reload failing", reloadFunc: failingReloadFunc, token: "secret", wantStatus: http.StatusInternalServerError},
+		{name: "without reload func", reloadFunc: nil, token: "secret", wantStatus: http.StatusNotImplemented},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			reloads = 0
+			gw := NewGateway(
+				WithLogger(logger),
+				WithHTTPServer(&http.Server{}),
+				WithAdminToken("secret"),
+				WithReloadFunc(tt.reloadFunc),
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", bearerPrefix+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			gw.r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if reloads != tt.wantReloads {
+				t.Errorf("got %d reloads, want %d", reloads, tt.wantReloads)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesDisabled(t *testing.T) {
+	gw := NewGateway(WithHTTPServer(&http.Server{}))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestSwapNodePool(t *testing.T) {
+	old := nodepool.NewNodePool(nodepool.WithNodeConfigs(nodepool.NewNodeConfig("localhost:9004", "mykey", "mysecret")))
+	gw := NewGateway(WithHTTPServer(&http.Server{}), WithNodePool(old))
+
+	swapped := nodepool.NewNodePool(nodepool.WithNodeConfigs(nodepool.NewNodeConfig("localhost:9005", "mykey", "mysecret")))
+	if got := gw.SwapNodePool(swapped); got != old {
+		t.Errorf("got previous node pool %v, want %v", got, old)
+	}
+	if got := gw.NodePool(); got != swapped {
+		t.Errorf("got node pool %v, want %v", got, swapped)
+	}
+}
+
+func TestSwapNodePoolNodeStates(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	gw, servers := newTestGateway(t, 3, WithAdminToken("secret"))
+	id := servers[0].Endpoint()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/nodes/"+id+"/cordon", nil)
+	req.Header.Set("Authorization", bearerPrefix+"secret")
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got cordon status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	// The node pool is reloaded, with the node states kept in memory only.
+	configs := make([]*nodepool.NodeConfig, len(servers))
+	for i, s := range servers {
+		configs[i] = nodepool.NewNodeConfig(s.Endpoint(), miniotest.AccessKey, miniotest.SecretKey)
+	}
+	swapped := nodepool.NewNodePool(
+		nodepool.WithNodeConfigs(configs...),
+		nodepool.WithLogger(logger),
+		nodepool.WithHealthCheckRetries(1),
+	)
+	if err := swapped.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(swapped.Close)
+	gw.SwapNodePool(swapped).Close()
+
+	if got := swapped.NodeState(id); got != nodepool.NodeStateCordoned {
+		t.Errorf("got node state %s after reload, want %s", got, nodepool.NodeStateCordoned)
+	}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		if got := swapped.ObjectToNodeID(key); got == id {
+			t.Errorf("got cordoned node %s as primary node of %s after reload", got, key)
+		}
+	}
+}
+
+func TestAdminRingHandlers(t *testing.T) {
+	gw, _ := newTestGateway(t, 3, WithAdminToken("secret"))
+	nodePool := gw.NodePool()
+
+	serve := func(path, token string, v any) int {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", bearerPrefix+token)
+		}
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, req)
+
+		if strings.Contains(rec.Body.String(), miniotest.SecretKey) {
+			t.Errorf("got response of %s with the node secret key: %s", path, rec.Body)
+		}
+		if rec.Code == http.StatusOK && v != nil {
+			if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return rec.Code
+	}
+
+	for _, path := range []string{"/admin/ring", "/admin/locate/foo", "/admin/nodes"} {
+		if code := serve(path, "", nil); code != http.StatusUnauthorized {
+			t.Errorf("got status %d of %s without token, want %d", code, path, http.StatusUnauthorized)
+		}
+	}
+
+	var gotRing ring
+	if code := serve("/admin/ring", "secret", &gotRing); code != http.StatusOK {
+		t.Fatalf("got ring status %d, want %d", code, http.StatusOK)
+	}
+	if len(gotRing.Nodes) != 3 {
+		t.Errorf("got %d ring nodes, want 3", len(gotRing.Nodes))
+	}
+	for _, n := range gotRing.Nodes {
+		if n.Weight != 1 || len(n.VirtualNodes) != 1 {
+			t.Errorf("got node %s with weight %d and %d virtual nodes, want 1 and 1", n.ID, n.Weight, len(n.VirtualNodes))
+		}
+	}
+
+	var gotPlacement placement
+	if code := serve("/admin/locate/foo", "secret", &gotPlacement); code != http.StatusOK {
+		t.Fatalf("got locate status %d, want %d", code, http.StatusOK)
+	}
+	if want := nodePool.ObjectToNodeID("foo"); gotPlacement.Primary != want {
+		t.Errorf("got primary node %s, want %s", gotPlacement.Primary, want)
+	}
+	if code := serve("/admin/locate/0123456789abcdef0123456789abcdef0", "secret", nil); code != http.StatusBadRequest {
+		t.Errorf("got locate status %d with invalid key, want %d", code, http.StatusBadRequest)
+	}
+
+	var gotNodes []node
+	if code := serve("/admin/nodes", "secret", &gotNodes); code != http.StatusOK {
+		t.Fatalf("got nodes status %d, want %d", code, http.StatusOK)
+	}
+	if len(gotNodes) != 3 {
+		t.Fatalf("got %d nodes, want 3", len(gotNodes))
+	}
+	for _, n := range gotNodes {
+		if !n.Health.Healthy {
+			t.Errorf("got node %s unhealthy, want healthy", n.ID)
+		}
+	}
+}
+
+func TestAdminNodeOperations(t *testing.T) {
+	gw, servers := newTestGateway(t, 3, WithAdminToken("secret"))
+	nodePool := gw.NodePool()
+
+	serve := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if strings.HasPrefix(path, "/admin") {
+			req.Header.Set("Authorization", bearerPrefix+"secret")
+		}
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, key := range keys {
+		if rec := serve(http.MethodPut, "/object/"+key, []byte(key)); rec.Code != http.StatusOK {
+			t.Fatalf("got put status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+	}
+
+	// Drain the node storing the first object.
+	id := nodePool.ObjectToNodeID(keys[0])
+
+	if rec := serve(http.MethodDelete, "/admin/nodes/"+id, nil); rec.Code != http.StatusConflict {
+		t.Errorf("got remove status %d of active node, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := serve(http.MethodPost, "/admin/nodes/127.0.0.1:1/cordon", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("got cordon status %d of unknown node, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := serve(http.MethodPost, "/admin/nodes/"+id+"/cordon", nil); rec.Code != http.StatusOK {
+		t.Fatalf("got cordon status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got := nodePool.ObjectToNodeID(keys[0]); got == id {
+		t.Errorf("got cordoned node %s as primary node", got)
+	}
+
+	// The objects of the cordoned node are read from it, until it's drained.
+	if rec := serve(http.MethodGet, "/object/"+keys[0], nil); rec.Code != http.StatusOK {
+		t.Errorf("got get status %d from cordoned node, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	rec := serve(http.MethodPost, "/admin/nodes/"+id+"/drain", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got drain status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for nodePool.NodeState(id) != nodepool.NodeStateDrained {
+		if time.Now().After(deadline) {
+			t.Fatalf("got node state %s, want %s", nodePool.NodeState(id), nodepool.NodeStateDrained)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if rec := serve(http.MethodDelete, "/admin/nodes/"+id, nil); rec.Code != http.StatusOK {
+		t.Fatalf("got remove status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	// Every object is served, and stored by a node which is not removed.
+	for _, key := range keys {
+		if rec := serve(http.MethodGet, "/object/"+key, nil); rec.Code != http.StatusOK {
+			t.Errorf("got get status %d of %s after remove, want %d: %s", rec.Code, key, http.StatusOK, rec.Body)
+		}
+		for _, s := range servers {
+			if s.Endpoint() == nodePool.ObjectToNodeID(key) {
+				if _, ok := s.Object(defaultBucket, key); !ok {
+					t.Errorf("got object %s missing on node %s", key, s.Endpoint())
+				}
+			}
+		}
+	}
+}
+
+func TestAdminDrainSwap(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	servers := make([]*miniotest.Server, 3)
+	configs := make([]*nodepool.NodeConfig, len(servers))
+	for i := range servers {
+		servers[i] = miniotest.NewServer()
+		t.Cleanup(servers[i].Close)
+		configs[i] = nodepool.NewNodeConfig(servers[i].Endpoint(), miniotest.AccessKey, miniotest.SecretKey)
+	}
+	stateFile := t.TempDir() + "/state.json"
+	newNodePool := func() *nodepool.NodePool {
+		nodePool := nodepool.NewNodePool(
+			nodepool.WithNodeConfigs(configs...),
+			nodepool.WithLogger(logger),
+			nodepool.WithHealthCheckRetries(1),
+			nodepool.WithStateFile(stateFile),
+		)
+		if err := nodePool.Init(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(nodePool.Close)
+
+		return nodePool
+	}
+
+	old := newNodePool()
+	gw := NewGateway(WithLogger(logger), WithHTTPServer(&http.Server{}), WithNodePool(old), WithAdminToken("secret"))
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/"+key, strings.NewReader(key)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got put status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+	}
+
+	id := old.ObjectToNodeID("a")
+	for _, s := range servers {
+		if s.Endpoint() == id {
+			s.SetLatency(100 * time.Millisecond)
+		}
+	}
+	drain := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/nodes/"+id+"/drain", nil)
+		req.Header.Set("Authorization", bearerPrefix+"secret")
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+	if code := drain(); code != http.StatusOK {
+		t.Fatalf("got drain status %d, want %d", code, http.StatusOK)
+	}
+	if code := drain(); code != http.StatusConflict {
+		t.Errorf("got drain status %d with drain in progress, want %d", code, http.StatusConflict)
+	}
+
+	// The drain of the previous node pool is stopped, and resumed on the new one.
+	swapped := newNodePool()
+	gw.SwapNodePool(swapped)
+	old.Close()
+
+	if got := old.NodeState(id); got != nodepool.NodeStateDraining {
+		t.Errorf("got node state %s on previous node pool, want %s", got, nodepool.NodeStateDraining)
+	}
+	if err := gw.drainNode(old, id); !errors.Is(err, ErrNodePoolReplaced) {
+		t.Errorf("got error %v draining on previous node pool, want %v", err, ErrNodePoolReplaced)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for swapped.NodeState(id) != nodepool.NodeStateDrained {
+		if time.Now().After(deadline) {
+			t.Fatalf("got node state %s, want %s", swapped.NodeState(id), nodepool.NodeStateDrained)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), string(nodepool.NodeStateDrained)) {
+		t.Errorf("got state file %s, want node %s", b, nodepool.NodeStateDrained)
+	}
+}
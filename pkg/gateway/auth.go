@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+)
+
+// Authenticator returns the current authenticator of the object routes, or nil
+// if authentication is disabled.
+func (g *Gateway) Authenticator() *auth.Authenticator {
+	return g.authenticator.Load()
+}
+
+// SetAuthenticator replaces the authenticator of the object routes, e.g. to
+// rotate the keys. Authentication is disabled when nil.
+func (g *Gateway) SetAuthenticator(authenticator *auth.Authenticator) {
+	g.authenticator.Store(authenticator)
+}
+
+// authMiddleware authenticates the requests to the object routes, authorizes
+// them with the policy of the principal, and resolves their tenant.
+func (g *Gateway) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		objectKey, ok := vars["key"]
+		if !ok {
+			objectKey = vars["id"]
+		}
+
+		var principal *auth.Principal
+		if authenticator := g.Authenticator(); authenticator != nil {
+			if principal, ok = g.authenticate(w, r, authenticator, auth.ActionOf(r.Method), objectKey); !ok {
+				return
+			}
+		}
+		if _, ok := g.setTenant(w, r, principal, vars["tenant"]); !ok {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setTenant records the tenant of the request, of the principal or the path,
+// and returns it. Otherwise, it writes the error response and returns false.
+func (g *Gateway) setTenant(w http.ResponseWriter, r *http.Request, principal *auth.Principal,
+	pathTenant string) (string, bool) {
+	tenant, err := resolveTenant(principal, pathTenant)
+	if err != nil {
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(auth.ErrForbidden.Error())
+		return "", false
+	}
+	if err = g.validateTenant(tenant); err != nil {
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(err.Error())
+		return "", false
+	}
+	setRequestTenant(r.Context(), tenant)
+
+	return tenant, true
+}
+
+// authenticate returns the principal of the request, if it's allowed the action
+// on the object key. Otherwise, it writes the error response and returns false.
+func (g *Gateway) authenticate(w http.ResponseWriter, r *http.Request, authenticator *auth.Authenticator,
+	action auth.Action, objectKey string) (*auth.Principal, bool) {
+	principal, err := authenticator.Authenticate(r)
+	if err != nil {
+		g.logger.WithError(err).Debug("request unauthenticated")
+		setRequestError(r.Context(), err)
+
+		status := http.StatusUnauthorized
+		if errors.Is(err, auth.ErrContentTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		} else {
+			w.Header().Set("WWW-Authenticate", "HMAC-SHA256")
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(err.Error())
+		return nil, false
+	}
+	setRequestPrincipal(r.Context(), principal.ID)
+	trace.SpanFromContext(r.Context()).SetAttributes(semconv.EnduserID(principal.ID))
+
+	if !principal.Allows(action, objectKey) {
+		err := errors.Wrapf(auth.ErrForbidden, "%s %s %s", principal.ID, action, objectKey)
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(auth.ErrForbidden.Error())
+		return nil, false
+	}
+
+	return principal, true
+}
@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	reader := auth.Key{ID: "reader", Secret: "reader-secret", Policy: auth.Policy{Actions: []auth.Action{auth.ActionRead}}}
+	writer := auth.Key{ID: "writer", Secret: "writer-secret",
+		Policy: auth.Policy{Actions: []auth.Action{auth.ActionRead, auth.ActionWrite}, Prefixes: []string{"logs"}}}
+
+	gw, _ := newTestGateway(t, 1, WithAuthenticator(auth.NewAuthenticator(auth.WithKeys(reader, writer))))
+
+	content := []byte("hello")
+
+	testCases := []struct {
+		name       string
+		method     string
+		key        string
+		body       []byte
+		sign       func(r *http.Request)
+		wantStatus int
+	}{
+		{name: "without credentials", method: http.MethodGet, key: "logs1", wantStatus: http.StatusUnauthorized},
+		{name: "with wrong api key", method: http.MethodGet, key: "logs1", wantStatus: http.StatusUnauthorized,
+			sign: func(r *http.Request) { r.Header.Set(auth.APIKeyHeader, "wrong") }},
+		{name: "with write of read-only key", method: http.MethodPut, key: "logs1", body: content, wantStatus: http.StatusForbidden,
+			sign: func(r *http.Request) { r.Header.Set(auth.APIKeyHeader, reader.Secret) }},
+		{name: "with write out of key prefixes", method: http.MethodPut, key: "foo", body: content, wantStatus: http.StatusForbidden,
+			sign: func(r *http.Request) { auth.Sign(r, writer.ID, writer.Secret, content, time.Now()) }},
+		{name: "with signed write", method: http.MethodPut, key: "logs1", body: content, wantStatus: http.StatusOK,
+			sign: func(r *http.Request) { auth.Sign(r, writer.ID, writer.Secret, content, time.Now()) }},
+		{name: "with signed write of tampered body", method: http.MethodPut, key: "logs2", body: []byte("hellO"),
+			wantStatus: http.StatusBadRequest,
+			sign:       func(r *http.Request) { auth.Sign(r, writer.ID, writer.Secret, content, time.Now()) }},
+		{name: "with read of api key", method: http.MethodGet, key: "logs1", wantStatus: http.StatusOK,
+			sign: func(r *http.Request) { r.Header.Set(auth.APIKeyHeader, reader.Secret) }},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/object/"+tt.key, bytes.NewReader(tt.body))
+			if tt.sign != nil {
+				tt.sign(req)
+			}
+			rec := httptest.NewRecorder()
+			gw.r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+
+	// The routes are public again, when the authenticator is removed.
+	gw.SetAuthenticator(nil)
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/object/logs1", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d without authenticator, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestPresignHandler(t *testing.T) {
+	reader := auth.Key{ID: "reader", Secret: "reader-secret", Policy: auth.Policy{Actions: []auth.Action{auth.ActionRead}}}
+	writer := auth.Key{ID: "writer", Secret: "writer-secret",
+		Policy: auth.Policy{Actions: []auth.Action{auth.ActionRead, auth.ActionWrite}, Prefixes: []string{"logs"}}}
+
+	gw, _ := newTestGateway(t, 1, WithPresignBaseURL("https://objects.example.com/"),
+		WithAuthenticator(auth.NewAuthenticator(auth.WithKeys(reader, writer), auth.WithPresign("s3cr3t", time.Hour))))
+
+	presign := func(t *testing.T, secret, body string, wantStatus int) presignedURL {
+		req := httptest.NewRequest(http.MethodPost, "/presign", bytes.NewBufferString(body))
+		req.Header.Set(auth.APIKeyHeader, secret)
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, req)
+		if rec.Code != wantStatus {
+			t.Fatalf("got status %d presigning, want %d: %s", rec.Code, wantStatus, rec.Body)
+		}
+		var got presignedURL
+		json.NewDecoder(rec.Body).Decode(&got)
+		return got
+	}
+	send := func(t *testing.T, method, target string, body []byte, wantStatus int) {
+		u, err := url.Parse(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Host != "objects.example.com" {
+			t.Errorf("got url host %q, want %q", u.Host, "objects.example.com")
+		}
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(method, u.RequestURI(), bytes.NewReader(body)))
+		if rec.Code != wantStatus {
+			t.Errorf("got status %d, want %d: %s", rec.Code, wantStatus, rec.Body)
+		}
+	}
+
+	t.Run("with presigned put and get", func(t *testing.T) {
+		put := presign(t, writer.Secret, `{"method": "put", "key": "logs1", "expiresIn": 60, "maxContentLength": 5}`, http.StatusOK)
+		if put.Method != http.MethodPut {
+			t.Errorf("got method %q, want %q", put.Method, http.MethodPut)
+		}
+		send(t, http.MethodPut, put.URL, []byte("hello"), http.StatusOK)
+		send(t, http.MethodPut, put.URL, []byte("hello world"), http.StatusRequestEntityTooLarge)
+		// The URL only authorizes its method.
+		send(t, http.MethodGet, put.URL, nil, http.StatusUnauthorized)
+
+		get := presign(t, reader.Secret, `{"method": "GET", "key": "logs1"}`, http.StatusOK)
+		send(t, http.MethodGet, get.URL, nil, http.StatusOK)
+	})
+	t.Run("with tenant", func(t *testing.T) {
+		put := presign(t, writer.Secret, `{"method": "PUT", "key": "logs2", "tenant": "acme"}`, http.StatusOK)
+		if !strings.Contains(put.URL, "/t/acme/object/logs2?") {
+			t.Errorf("got url %s, want one of tenant acme", put.URL)
+		}
+		send(t, http.MethodPut, put.URL, []byte("hello"), http.StatusOK)
+
+		get := presign(t, reader.Secret, `{"method": "GET", "key": "logs2"}`, http.StatusOK)
+		send(t, http.MethodGet, get.URL, nil, http.StatusNotFound)
+	})
+	t.Run("with request not allowed to the requester", func(t *testing.T) {
+		presign(t, reader.Secret, `{"method": "PUT", "key": "logs1"}`, http.StatusForbidden)
+	})
+	t.Run("without credentials", func(t *testing.T) {
+		presign(t, "", `{"method": "GET", "key": "logs1"}`, http.StatusUnauthorized)
+	})
+	t.Run("with method not supported", func(t *testing.T) {
+		presign(t, writer.Secret, `{"method": "DELETE", "key": "logs1"}`, http.StatusBadRequest)
+	})
+	t.Run("with expiry too long", func(t *testing.T) {
+		presign(t, writer.Secret, `{"method": "GET", "key": "logs1", "expiresIn": 7200}`, http.StatusBadRequest)
+	})
+	t.Run("with expiry overflowing", func(t *testing.T) {
+		presign(t, writer.Secret, `{"method": "GET", "key": "logs1", "expiresIn": 9223372036854775807}`, http.StatusBadRequest)
+		presign(t, writer.Secret, `{"method": "GET", "key": "logs1", "expiresIn": 18446744074}`, http.StatusBadRequest)
+	})
+	t.Run("without authenticator", func(t *testing.T) {
+		gw, _ := newTestGateway(t, 1)
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/presign", bytes.NewBufferString(`{"method": "GET", "key": "logs1"}`)))
+		if rec.Code != http.StatusNotImplemented {
+			t.Errorf("got status %d, want %d", rec.Code, http.StatusNotImplemented)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+)
+
+var (
+	ErrBucketNameNotValid = errors.New("bucket name not valid")
+)
+
+var bucketNamePattern = regexp.MustCompile("^" + bucketNameRegex + "$")
+
+// bucket is a named bucket, as served by the bucket API.
+type bucket struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Nodes     []string  `json:"nodes"`
+}
+
+// AddBucketRoutes adds the routes to list, create and delete the named buckets,
+// of the tenant of the principal, if any, and of the tenants in the path, e.g.
+// /t/{tenant}/bucket/{bucket}. The named buckets are stored on every node, in
+// the bucket of the tenant suffixed with the name.
+func (g *Gateway) AddBucketRoutes(r *mux.Router) {
+	bucketRouter := r.NewRoute().Subrouter()
+	bucketRouter.Use(g.authMiddleware, g.rateLimitMiddleware)
+	for _, prefix := range []string{"/bucket", fmt.Sprintf("/t/{tenant:%s}/bucket", tenantRegex)} {
+		namePath := fmt.Sprintf("%s/{bucket:%s}", prefix, bucketNameRegex)
+		bucketRouter.Methods(http.MethodGet).Path(prefix).HandlerFunc(g.ListBucketsHandler)
+		bucketRouter.Methods(http.MethodPut).Path(namePath).HandlerFunc(g.CreateBucketHandler)
+		bucketRouter.Methods(http.MethodDelete).Path(namePath).HandlerFunc(g.DeleteBucketHandler)
+	}
+}
+
+func (g *Gateway) ListBucketsHandler(w http.ResponseWriter, r *http.Request) {
+	nodePool := g.NodePool()
+	if nodePool == nil {
+		setRequestError(r.Context(), ErrNodePoolEmpty)
+
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
+		return
+	}
+
+	prefix := g.tenantBucket(getRequestTenant(r.Context())) + "."
+	buckets, err := nodePool.ListBuckets(r.Context(), prefix)
+	if err != nil {
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+
+	list := make([]bucket, 0, len(buckets))
+	for _, b := range buckets {
+		list = append(list, bucket{Name: strings.TrimPrefix(b.Name, prefix), CreatedAt: b.CreatedAt, Nodes: b.Nodes})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (g *Gateway) CreateBucketHandler(w http.ResponseWriter, r *http.Request) {
+	g.bucketOperation(w, r, http.StatusCreated, func(nodePool *nodepool.NodePool, name string) error {
+		return nodePool.CreateBucket(r.Context(), name, g.region)
+	})
+}
+
+func (g *Gateway) DeleteBucketHandler(w http.ResponseWriter, r *http.Request) {
+	g.bucketOperation(w, r, http.StatusNoContent, func(nodePool *nodepool.NodePool, name string) error {
+		defer g.uncacheBucket(name)
+
+		return nodePool.DeleteBucket(r.Context(), name, g.region)
+	})
+}
+
+// bucketOperation runs the operation on the named bucket of the request, on
+// the current node pool, and writes the response.
+func (g *Gateway) bucketOperation(w http.ResponseWriter, r *http.Request, status int,
+	op func(nodePool *nodepool.NodePool, name string) error) {
+	name := g.requestBucket(r)
+	if len(name) > maxBucketNameSize {
+		err := errors.Wrapf(ErrBucketNameNotValid, "%s longer than %d", name, maxBucketNameSize)
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+
+	nodePool := g.NodePool()
+	if nodePool == nil {
+		setRequestError(r.Context(), ErrNodePoolEmpty)
+
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
+		return
+	}
+
+	if err := op(nodePool, name); err != nil {
+		g.logger.WithError(err).Debugf("error operating on bucket %s", name)
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(bucketStatusCode(err))
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+
+	w.WriteHeader(status)
+}
+
+// bucketStatusCode returns the HTTP status code of the error of a bucket operation.
+func bucketStatusCode(err error) int {
+	switch {
+	case errors.Is(err, nodepool.ErrBucketNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, nodepool.ErrBucketExists), errors.Is(err, nodepool.ErrBucketNotEmpty):
+		return http.StatusConflict
+	case errors.Is(err, nodepool.ErrNodesUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+)
+
+func TestBuckets(t *testing.T) {
+	gw, servers := newTestGateway(t, 2)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+	list := func(path string) []bucket {
+		rec := serve(http.MethodGet, path, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got list status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+		var buckets []bucket
+		json.NewDecoder(rec.Body).Decode(&buckets)
+		return buckets
+	}
+
+	if rec := serve(http.MethodPut, "/bucket/photos/object/foo", "hello"); rec.Code != http.StatusNotFound {
+		t.Errorf("got put status %d to bucket missing, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if rec := serve(http.MethodPut, "/bucket/photos", ""); rec.Code != http.StatusCreated {
+		t.Fatalf("got create status %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	for _, srv := range servers {
+		if !srv.BucketExists(defaultBucket + ".photos") {
+			t.Errorf("got bucket not created on node %s", srv.Endpoint())
+		}
+	}
+	if rec := serve(http.MethodPut, "/bucket/photos", ""); rec.Code != http.StatusConflict {
+		t.Errorf("got create status %d of bucket existing, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := serve(http.MethodPut, "/t/acme/bucket/"+strings.Repeat("a", 60), ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("got create status %d of bucket name too long, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if got := list("/bucket"); len(got) != 1 || got[0].Name != "photos" || len(got[0].Nodes) != len(servers) {
+		t.Errorf("got buckets %+v, want photos on every node", got)
+	}
+	if got := list("/t/acme/bucket"); len(got) != 0 {
+		t.Errorf("got buckets %+v of other tenant, want none", got)
+	}
+
+	// The objects of the named bucket are isolated from the ones of the tenant.
+	if rec := serve(http.MethodPut, "/bucket/photos/object/foo", "hello"); rec.Code != http.StatusOK {
+		t.Fatalf("got put status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	rec := serve(http.MethodGet, "/bucket/photos/object/foo", "")
+	var got []byte
+	json.NewDecoder(rec.Body).Decode(&got)
+	if rec.Code != http.StatusOK || string(got) != "hello" {
+		t.Errorf("got get status %d and body %q, want %d and %q", rec.Code, got, http.StatusOK, "hello")
+	}
+	if rec := serve(http.MethodGet, "/object/foo", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("got get status %d of object of named bucket, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if rec := serve(http.MethodDelete, "/bucket/photos", ""); rec.Code != http.StatusConflict {
+		t.Errorf("got delete status %d of bucket not empty, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := serve(http.MethodPut, "/bucket/videos", ""); rec.Code != http.StatusCreated {
+		t.Fatalf("got create status %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if rec := serve(http.MethodDelete, "/bucket/videos", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("got delete status %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if rec := serve(http.MethodDelete, "/bucket/videos", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("got delete status %d of bucket missing, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestBucketsAuthorization(t *testing.T) {
+	readWrite := []auth.Action{auth.ActionRead, auth.ActionWrite}
+	owner := auth.Key{ID: "owner", Secret: "owner-secret", Tenant: "acme",
+		Policy: auth.Policy{Actions: readWrite}}
+	prefixed := auth.Key{ID: "prefixed", Secret: "prefixed-secret", Tenant: "acme",
+		Policy: auth.Policy{Actions: readWrite, Prefixes: []string{"a"}}}
+
+	gw, servers := newTestGateway(t, 1,
+		WithAuthenticator(auth.NewAuthenticator(auth.WithKeys(owner, prefixed))))
+
+	serve := func(method, path, secret string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(auth.APIKeyHeader, secret)
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// The keys restricted to key prefixes don't manage the buckets.
+	if code := serve(http.MethodPut, "/bucket/photos", prefixed.Secret); code != http.StatusForbidden {
+		t.Errorf("got status %d with prefixed key, want %d", code, http.StatusForbidden)
+	}
+	if code := serve(http.MethodPut, "/bucket/photos", owner.Secret); code != http.StatusCreated {
+		t.Errorf("got status %d, want %d", code, http.StatusCreated)
+	}
+	if !servers[0].BucketExists(defaultBucket + "-acme.photos") {
+		t.Errorf("got bucket not created in the namespace of the tenant")
+	}
+	if code := serve(http.MethodDelete, "/t/globex/bucket/photos", owner.Secret); code != http.StatusForbidden {
+		t.Errorf("got status %d with path of other tenant, want %d", code, http.StatusForbidden)
+	}
+}
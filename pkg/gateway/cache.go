@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/maxgio92/homework-object-storage/pkg/cache"
+)
+
+const (
+	// The tiers of the cache of the objects read.
+	cacheTierMemory = "memory"
+	cacheTierDisk   = "disk"
+
+	// The results of the lookups of the objects read in the cache.
+	cacheHit         = "hit"
+	cacheMiss        = "miss"
+	cacheRevalidated = "revalidated"
+)
+
+// objectCacheKey returns the key of the object in the bucket in the cache.
+func objectCacheKey(bucket, key string) string {
+	return bucket + "/" + key
+}
+
+// cacheObject records the result of the read of the object of the cache key,
+// which is cached in memory if ok, either revalidating or replacing it. The
+// cached object is removed if it's not found anymore.
+func (g *Gateway) cacheObject(cacheKey string, cached cache.Entry, ok bool, etag string, content []byte, err error) {
+	if g.cache == nil {
+		return
+	}
+
+	switch {
+	case err == nil && ok && etag == cached.ETag:
+		g.cache.Revalidate(cacheKey, etag)
+		g.metrics.CacheLookup(cacheTierMemory, cacheRevalidated)
+		return
+	case err == nil:
+		g.cache.Add(cacheKey, etag, content)
+	case errorStatusCode(err) == http.StatusNotFound:
+		g.cache.Remove(cacheKey)
+	}
+	g.metrics.CacheLookup(cacheTierMemory, cacheMiss)
+	g.recordCacheSizes()
+}
+
+// diskCached returns the object of the cache key cached on disk, if any. The
+// objects on disk are always revalidated, as they're not refreshed.
+func (g *Gateway) diskCached(cacheKey string) (cache.Entry, bool) {
+	entry, ok, err := g.diskCache.Get(cacheKey)
+	if err != nil {
+		g.logger.WithError(err).Warnf("error reading the cached object %s from disk", cacheKey)
+		g.recordCacheSizes()
+	}
+
+	return entry, ok
+}
+
+// diskCacheObject records the result of the read of the object of the cache
+// key, whose content is read from the disk cache if modified since base. The
+// lookup on disk is recorded if looked up.
+func (g *Gateway) diskCacheObject(cacheKey string, base cache.Entry, lookedUp, onDisk bool, res objectRead) {
+	if g.diskCache == nil {
+		return
+	}
+
+	result := cacheMiss
+	switch {
+	case res.err == nil && res.etag == base.ETag:
+		if onDisk {
+			result = cacheRevalidated
+		}
+	case res.err == nil:
+		if err := g.diskCache.Add(cacheKey, res.etag, res.content); err != nil {
+			g.logger.WithError(err).Warnf("error caching the object %s on disk", cacheKey)
+		}
+	case errorStatusCode(res.err) == http.StatusNotFound:
+		g.diskCache.Remove(cacheKey)
+	}
+	if lookedUp {
+		g.metrics.CacheLookup(cacheTierDisk, result)
+	}
+	g.recordCacheSizes()
+}
+
+// uncacheObject removes the cached object of the cache key, e.g. once it's put.
+// The reads of the object in flight are not cached.
+func (g *Gateway) uncacheObject(cacheKey string) {
+	g.reads.invalidate(cacheKey, false)
+	g.cache.Remove(cacheKey)
+	g.diskCache.Remove(cacheKey)
+	g.recordCacheSizes()
+}
+
+// uncacheBucket removes the cached objects of the bucket, e.g. once it's deleted.
+func (g *Gateway) uncacheBucket(bucket string) {
+	g.reads.invalidate(objectCacheKey(bucket, ""), true)
+	g.cache.RemovePrefix(objectCacheKey(bucket, ""))
+	g.diskCache.RemovePrefix(objectCacheKey(bucket, ""))
+	g.recordCacheSizes()
+}
+
+// recordCacheSizes records the size of the cache tiers enabled.
+func (g *Gateway) recordCacheSizes() {
+	if g.cache != nil {
+		entries, bytes := g.cache.Size()
+		g.metrics.SetCacheSize(cacheTierMemory, entries, bytes)
+	}
+	if g.diskCache != nil {
+		entries, bytes := g.diskCache.Size()
+		g.metrics.SetCacheSize(cacheTierDisk, entries, bytes)
+	}
+}
+
+// notModified returns whether the error is due to the object not modified
+// since it's been cached.
+func notModified(err error) bool {
+	return err != nil && minio.ToErrorResponse(err).StatusCode == http.StatusNotModified
+}
@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+	"github.com/maxgio92/homework-object-storage/pkg/cache"
+	"github.com/maxgio92/homework-object-storage/pkg/metrics"
+)
+
+func TestObjectCache(t *testing.T) {
+	gw, servers := newTestGateway(t, 1, WithCache(cache.New()))
+	srv := servers[0]
+
+	put := func(body string) {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/foo", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got put status %d, want %d", rec.Code, http.StatusOK)
+		}
+	}
+	get := func() string {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/object/foo", nil))
+		var content []byte
+		json.NewDecoder(rec.Body).Decode(&content)
+		return string(content)
+	}
+
+	put("hello")
+	get()
+	reads := srv.Calls(miniotest.OpGetObject)
+	if got := get(); got != "hello" {
+		t.Errorf("got content %q, want %q", got, "hello")
+	}
+	if got := srv.Calls(miniotest.OpGetObject) - reads; got != 0 {
+		t.Errorf("got %d reads of the fresh cached object, want none", got)
+	}
+
+	// The objects put through the gateway are evicted.
+	put("world")
+	if got := get(); got != "world" {
+		t.Errorf("got content %q after put, want %q", got, "world")
+	}
+}
+
+func TestObjectCacheRevalidation(t *testing.T) {
+	m := metrics.New(metrics.WithRegistry(prometheus.NewRegistry()))
+	gw, servers := newTestGateway(t, 1, WithCache(cache.New(cache.WithTTL(0))), WithMetrics(m, "/metrics"))
+	srv := servers[0]
+	srv.PutObject(defaultBucket, "foo", []byte("hello"))
+
+	get := func() string {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/object/foo", nil))
+		var content []byte
+		json.NewDecoder(rec.Body).Decode(&content)
+		return string(content)
+	}
+
+	for i := 0; i < 2; i++ {
+		if got := get(); got != "hello" {
+			t.Errorf("got content %q, want %q", got, "hello")
+		}
+	}
+	// The objects modified on the nodes are read again.
+	srv.PutObject(defaultBucket, "foo", []byte("world"))
+	if got := get(); got != "world" {
+		t.Errorf("got content %q after it's modified, want %q", got, "world")
+	}
+
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`object_storage_gateway_cache_lookups_total{result="miss",tier="memory"} 2`,
+		`object_storage_gateway_cache_lookups_total{result="revalidated",tier="memory"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("got metrics without %s", want)
+		}
+	}
+}
+
+func TestObjectDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	diskCache, err := cache.OpenDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := metrics.New(metrics.WithRegistry(prometheus.NewRegistry()))
+	gw, servers := newTestGateway(t, 1, WithDiskCache(diskCache), WithMetrics(m, "/metrics"))
+	srv := servers[0]
+	srv.PutObject(defaultBucket, "foo", []byte("hello"))
+
+	get := func() string {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/object/foo", nil))
+		var content []byte
+		json.NewDecoder(rec.Body).Decode(&content)
+		return string(content)
+	}
+
+	get()
+	// The objects cached on disk are recovered on restart.
+	if diskCache, err = cache.OpenDisk(dir); err != nil {
+		t.Fatal(err)
+	}
+	gw.diskCache = diskCache
+	if got := get(); got != "hello" {
+		t.Errorf("got content %q, want %q", got, "hello")
+	}
+	// The objects modified on the nodes are read again.
+	srv.PutObject(defaultBucket, "foo", []byte("world"))
+	if got := get(); got != "world" {
+		t.Errorf("got content %q after it's modified, want %q", got, "world")
+	}
+	if entry, ok, _ := diskCache.Get(objectCacheKey(defaultBucket, "foo")); !ok || string(entry.Content) != "world" {
+		t.Errorf("got cached content %q, want %q", entry.Content, "world")
+	}
+
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`object_storage_gateway_cache_lookups_total{result="miss",tier="disk"} 2`,
+		`object_storage_gateway_cache_lookups_total{result="revalidated",tier="disk"} 1`,
+		`object_storage_gateway_cache_entries{tier="disk"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("got metrics without %s", want)
+		}
+	}
+}
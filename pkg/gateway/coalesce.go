@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// objectRead is the result of a read of an object from the nodes.
+type objectRead struct {
+	content []byte
+	etag    string
+
+	// nodeID is the ID of the node which served the object, or of the last
+	// node tried, if failed.
+	nodeID string
+	err    error
+}
+
+// readGroup coalesces the concurrent reads of the same object, so that they
+// share a single read from the nodes. The results are buffered, the content of
+// the objects included, and returned to the callers once the read is done:
+// they're not streamed to them.
+type readGroup struct {
+	mu    sync.Mutex
+	reads map[string]*inflightRead
+}
+
+// inflightRead is a read in flight, whose result is set once done is closed.
+// The reads invalidated, e.g. by a put of the object, are not joined anymore,
+// and their results are not stored.
+type inflightRead struct {
+	done chan struct{}
+	objectRead
+
+	mu          sync.Mutex
+	invalidated bool
+}
+
+// do reads the object of the key with read, unless a read of the same key is
+// in flight, whose result is returned once done instead. The result read is
+// stored with store, e.g. cached, unless the read is invalidated meanwhile. It
+// returns whether the result is shared with a read in flight.
+func (g *readGroup) do(ctx context.Context, key string, read func() objectRead, store func(objectRead)) (objectRead, bool) {
+	g.mu.Lock()
+	if g.reads == nil {
+		g.reads = make(map[string]*inflightRead)
+	}
+	if r, ok := g.reads[key]; ok {
+		g.mu.Unlock()
+
+		select {
+		case <-r.done:
+			return r.objectRead, true
+		case <-ctx.Done():
+			return objectRead{err: ctx.Err()}, true
+		}
+	}
+	r := &inflightRead{done: make(chan struct{})}
+	g.reads[key] = r
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		if g.reads[key] == r {
+			delete(g.reads, key)
+		}
+		g.mu.Unlock()
+		close(r.done)
+	}()
+	r.objectRead = read()
+
+	// The invalidations wait for the result to be stored, so that it's removed
+	// after, if stored before.
+	r.mu.Lock()
+	if !r.invalidated {
+		store(r.objectRead)
+	}
+	r.mu.Unlock()
+
+	return r.objectRead, false
+}
+
+// invalidate invalidates the reads in flight of the keys with the prefix, or
+// of the key only, unless prefix. They return once the results of the reads
+// already stored are.
+func (g *readGroup) invalidate(key string, prefix bool) {
+	var invalidated []*inflightRead
+
+	g.mu.Lock()
+	for k, r := range g.reads {
+		if k == key || (prefix && strings.HasPrefix(k, key)) {
+			delete(g.reads, k)
+			invalidated = append(invalidated, r)
+		}
+	}
+	g.mu.Unlock()
+
+	for _, r := range invalidated {
+		r.mu.Lock()
+		r.invalidated = true
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,154 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+)
+
+func TestGetObjectCoalescing(t *testing.T) {
+	gw, servers := newTestGateway(t, 1)
+	srv := servers[0]
+
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/foo", strings.NewReader("hello")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got put status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// The reads are slow enough for the concurrent ones to be in flight together.
+	srv.SetLatency(200 * time.Millisecond)
+	reads := srv.Calls(miniotest.OpGetObject)
+
+	const n = 10
+	var wg sync.WaitGroup
+	contents := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			rec := httptest.NewRecorder()
+			gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/object/foo", nil))
+			var content []byte
+			json.NewDecoder(rec.Body).Decode(&content)
+			contents[i] = string(content)
+		}(i)
+	}
+	wg.Wait()
+
+	if got := srv.Calls(miniotest.OpGetObject) - reads; got != 1 {
+		t.Errorf("got %d reads from the node, want 1", got)
+	}
+	for i, got := range contents {
+		if got != "hello" {
+			t.Errorf("got content %q of read %d, want %q", got, i, "hello")
+		}
+	}
+}
+
+func TestReadGroup(t *testing.T) {
+	var g readGroup
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	leader := make(chan objectRead)
+	go func() {
+		res, _ := g.do(context.Background(), "foo", func() objectRead {
+			close(started)
+			<-release
+			return objectRead{content: []byte("hello")}
+		}, func(objectRead) {})
+		leader <- res
+	}()
+	<-started
+
+	// The waiters stop waiting once their request is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, shared := g.do(ctx, "foo", func() objectRead {
+		t.Error("got read of key in flight")
+		return objectRead{}
+	}, func(objectRead) {})
+	if !shared || !errors.Is(res.err, context.Canceled) {
+		t.Errorf("got result %+v and shared %t of waiter cancelled, want %v", res, shared, context.Canceled)
+	}
+
+	close(release)
+	if res := <-leader; string(res.content) != "hello" {
+		t.Errorf("got content %q, want %q", res.content, "hello")
+	}
+
+	// The keys are read again once their read is done.
+	res, shared = g.do(context.Background(), "foo", func() objectRead {
+		return objectRead{content: []byte("world")}
+	}, func(objectRead) {})
+	if shared || string(res.content) != "world" {
+		t.Errorf("got content %q and shared %t, want %q read again", res.content, shared, "world")
+	}
+}
+
+func TestReadGroupInvalidate(t *testing.T) {
+	var g readGroup
+
+	testCases := []struct {
+		name       string
+		key        string
+		invalidate func()
+	}{
+		{name: "with key", key: "photos/foo", invalidate: func() { g.invalidate("photos/foo", false) }},
+		{name: "with prefix", key: "photos/bar", invalidate: func() { g.invalidate("photos/", true) }},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			stored := make(chan objectRead, 2)
+			store := func(res objectRead) { stored <- res }
+
+			leader := make(chan objectRead)
+			go func() {
+				res, _ := g.do(context.Background(), tt.key, func() objectRead {
+					close(started)
+					<-release
+					return objectRead{content: []byte("old")}
+				}, store)
+				leader <- res
+			}()
+			<-started
+
+			// The object is put meanwhile: the read in flight is not joined anymore.
+			tt.invalidate()
+			res, shared := g.do(context.Background(), tt.key, func() objectRead {
+				return objectRead{content: []byte("new")}
+			}, store)
+			if shared || string(res.content) != "new" {
+				t.Errorf("got content %q and shared %t after invalidation, want %q read again", res.content, shared, "new")
+			}
+
+			// The result of the read invalidated is returned to its callers, not stored.
+			close(release)
+			if res := <-leader; string(res.content) != "old" {
+				t.Errorf("got content %q of the read invalidated, want %q", res.content, "old")
+			}
+			close(stored)
+			var got []string
+			for res := range stored {
+				got = append(got, string(res.content))
+			}
+			if len(got) != 1 || got[0] != "new" {
+				t.Errorf("got results %q stored, want %q only", got, "new")
+			}
+		})
+	}
+}
@@ -5,4 +5,7 @@ const (
 	defaultRegion    = "us-east-1"
 	maxObjectKeysize = 32
 	objectKeyRegex   = "[0-9a-z]+"
+	tenantRegex      = "[0-9a-z]+"
+	bucketNameRegex  = "[0-9a-z]+"
+	peerBucketRegex  = "[0-9a-z.-]+"
 )
@@ -3,15 +3,27 @@ package gateway
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 
 	"github.com/maxgio92/homework-object-storage/internal/output"
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+	"github.com/maxgio92/homework-object-storage/pkg/cache"
+	"github.com/maxgio92/homework-object-storage/pkg/metrics"
 	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+	"github.com/maxgio92/homework-object-storage/pkg/peers"
 )
 
 const (
@@ -26,9 +38,98 @@ type Gateway struct {
 	r   *mux.Router
 	srv *http.Server
 
-	nodePool *nodepool.NodePool
+	// nodePool is the current node pool. It's swapped on reload, while in-flight
+	// requests complete against the node pool they started with.
+	nodePool atomic.Pointer[nodepool.NodePool]
+
+	// drains are the drains in progress of the nodes of the node pool. They're
+	// stopped when the node pool is swapped, and when the gateway shuts down.
+	drains   *drains
+	drainsMu sync.Mutex
+
+	// bucket and region are the ones objects are stored in, on every node.
+	bucket string
+	region string
+
+	// timeouts are the per-request timeouts, which can change at runtime.
+	timeouts   Timeouts
+	timeoutsMu sync.RWMutex
+
+	// adminToken is the bearer token of the admin API. The admin API is disabled
+	// when it's empty.
+	adminToken string
+
+	// reloadFunc reloads the gateway on request of the admin API.
+	reloadFunc ReloadFunc
+
+	// metrics are exposed at metricsPath. The metrics are disabled when nil.
+	metrics     *metrics.Metrics
+	metricsPath string
+
+	// minHealthyNodes is the minimum number of healthy nodes for the gateway
+	// to be ready.
+	minHealthyNodes int
+
+	// accessLogger writes the access logs, sampling the successful requests
+	// with accessLogSampleRatio. The access logs are disabled when nil.
+	accessLogger         *log.Logger
+	accessLogSampleRatio float64
+
+	// tracer traces the requests, propagated with propagator.
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+
+	// authenticator authenticates the requests to the object routes, and can
+	// be replaced at runtime. The object routes are public when nil.
+	authenticator atomic.Pointer[auth.Authenticator]
+
+	// limiter limits the rate of the requests of each client, and the
+	// concurrent requests to each node. The requests are not limited when nil.
+	limiter atomic.Pointer[limiter]
+
+	// maxObjectSize is the maximum size of the objects put, in bytes. The size
+	// is not limited when zero.
+	maxObjectSize int64
+
+	// quotas limits the storage used by the objects of each key prefix, and
+	// can be replaced at runtime. The storage is not limited when nil.
+	quotas atomic.Pointer[quotaTracker]
+
+	// cache caches the content of the objects read. The objects are not cached
+	// when nil.
+	cache *cache.Cache
+
+	// diskCache caches the content of the objects read on disk, between the
+	// cache in memory and the nodes. The objects are not cached on disk when nil.
+	diskCache *cache.Disk
+
+	// reads coalesces the concurrent reads of the same object.
+	reads readGroup
+
+	// peers are the peer gateways, which the reads of the objects they own
+	// are forwarded to with peerClient, authenticated with peerToken. The
+	// reads are never forwarded when nil.
+	peers      *peers.Peers
+	peerToken  string
+	peerClient *http.Client
+
+	// presignBaseURL is the base of the presigned URLs. The presigned URLs are
+	// relative to the host of the presign requests when empty.
+	presignBaseURL string
+}
+
+// Timeouts are the per-request timeouts of the gateway.
+type Timeouts struct {
+	// Read is the maximum duration for reading the entire request, including the body.
+	Read time.Duration
+
+	// Write is the maximum duration before timing out writes of the response.
+	Write time.Duration
 }
 
+// ReloadFunc reloads the gateway, e.g. swapping its node pool.
+type ReloadFunc func(ctx context.Context) error
+
 type Option func(gw *Gateway)
 
 func WithLogger(logger *log.Logger) Option {
@@ -51,13 +152,139 @@ func WithRouter(router *mux.Router) Option {
 
 func WithNodePool(nodePool *nodepool.NodePool) Option {
 	return func(gw *Gateway) {
-		gw.nodePool = nodePool
+		gw.nodePool.Store(nodePool)
+	}
+}
+
+func WithBucket(bucket string) Option {
+	return func(gw *Gateway) {
+		gw.bucket = bucket
+	}
+}
+
+func WithRegion(region string) Option {
+	return func(gw *Gateway) {
+		gw.region = region
+	}
+}
+
+func WithAdminToken(token string) Option {
+	return func(gw *Gateway) {
+		gw.adminToken = token
+	}
+}
+
+func WithReloadFunc(f ReloadFunc) Option {
+	return func(gw *Gateway) {
+		gw.reloadFunc = f
+	}
+}
+
+// WithMetrics enables the metrics, exposed at path.
+func WithMetrics(m *metrics.Metrics, path string) Option {
+	return func(gw *Gateway) {
+		gw.metrics = m
+		gw.metricsPath = path
+	}
+}
+
+// WithMinHealthyNodes sets the minimum number of healthy nodes for the gateway
+// to be ready.
+func WithMinHealthyNodes(n int) Option {
+	return func(gw *Gateway) {
+		gw.minHealthyNodes = n
+	}
+}
+
+// WithAccessLog enables the access logs, written by logger. The successful
+// requests are sampled with sampleRatio, between 0 and 1.
+func WithAccessLog(logger *log.Logger, sampleRatio float64) Option {
+	return func(gw *Gateway) {
+		gw.accessLogger = logger
+		gw.accessLogSampleRatio = sampleRatio
+	}
+}
+
+// WithTracerProvider enables the tracing of the requests, with the W3C trace
+// context propagation.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(gw *Gateway) {
+		gw.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithAuthenticator enables the authentication and the authorization of the
+// requests to the object routes.
+func WithAuthenticator(authenticator *auth.Authenticator) Option {
+	return func(gw *Gateway) {
+		gw.authenticator.Store(authenticator)
+	}
+}
+
+// WithPresignBaseURL sets the base of the presigned URLs, e.g. the public URL
+// of the gateway behind a proxy.
+func WithPresignBaseURL(baseURL string) Option {
+	return func(gw *Gateway) {
+		gw.presignBaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithLimits limits the rate of the requests of each client, and the
+// concurrent requests to each node.
+func WithLimits(limits Limits) Option {
+	return func(gw *Gateway) {
+		gw.limiter.Store(newLimiter(limits))
+	}
+}
+
+// WithMaxObjectSize limits the size of the objects put, in bytes.
+func WithMaxObjectSize(size int64) Option {
+	return func(gw *Gateway) {
+		gw.maxObjectSize = size
+	}
+}
+
+// WithQuotas limits the storage used by the objects of each key prefix. The
+// quotas are assumed valid.
+func WithQuotas(quotas []Quota) Option {
+	return func(gw *Gateway) {
+		if len(quotas) > 0 {
+			gw.quotas.Store(newQuotaTracker(quotas))
+		}
+	}
+}
+
+// WithCache caches the content of the objects read.
+func WithCache(c *cache.Cache) Option {
+	return func(gw *Gateway) {
+		gw.cache = c
+	}
+}
+
+// WithDiskCache caches the content of the objects read on disk.
+func WithDiskCache(d *cache.Disk) Option {
+	return func(gw *Gateway) {
+		gw.diskCache = d
+	}
+}
+
+// WithPeers shares the ownership of the cached objects with the peer gateways,
+// which serve the peer routes authenticated with the token. The reads of the
+// objects owned by the peers are forwarded to them with the client.
+func WithPeers(p *peers.Peers, token string, client *http.Client) Option {
+	return func(gw *Gateway) {
+		gw.peers = p
+		gw.peerToken = token
+		gw.peerClient = client
 	}
 }
 
 // NewGateway returns a new Gateway.
 func NewGateway(opts ...Option) *Gateway {
 	gw := new(Gateway)
+	gw.bucket = defaultBucket
+	gw.region = defaultRegion
+	gw.minHealthyNodes = defaultMinHealthyNodes
 
 	for _, f := range opts {
 		f(gw)
@@ -68,9 +295,25 @@ func NewGateway(opts ...Option) *Gateway {
 	if gw.r == nil {
 		gw.r = mux.NewRouter()
 	}
+	gw.r.Use(gw.timeoutsMiddleware, gw.requestMiddleware, gw.tracingMiddleware)
+	// The router middlewares don't apply to the requests not matching any route.
+	if gw.r.NotFoundHandler == nil {
+		gw.r.NotFoundHandler = gw.requestMiddleware(http.NotFoundHandler())
+	}
 	gw.r.HandleFunc("/", gw.HomeHandler)
+	gw.AddHealthRoutes(gw.r)
+	if gw.metrics != nil {
+		gw.r.Handle(gw.metricsPath, gw.metrics.Handler())
+	}
 	gw.AddObjectRoutes(gw.r)
-	http.Handle("/", gw.r)
+	gw.AddBucketRoutes(gw.r)
+	gw.r.Methods(http.MethodPost).Path("/presign").HandlerFunc(gw.PresignHandler)
+	if gw.adminToken != "" {
+		gw.AddAdminRoutes(gw.r)
+	}
+	if gw.peers != nil {
+		gw.AddPeerRoutes(gw.r)
+	}
 
 	gw.srv.Handler = gw.r
 
@@ -91,13 +334,88 @@ func (g *Gateway) init() {
 			IdleTimeout:  15 * time.Second,
 		}
 	}
+	if g.tracer == nil {
+		g.tracer = noop.NewTracerProvider().Tracer(tracerName)
+	}
+	g.propagator = propagation.TraceContext{}
+	if g.peers != nil && g.peerClient == nil {
+		g.peerClient = http.DefaultClient
+	}
+	g.timeouts = Timeouts{Read: g.srv.ReadTimeout, Write: g.srv.WriteTimeout}
+}
+
+// NodePool returns the current node pool.
+func (g *Gateway) NodePool() *nodepool.NodePool {
+	return g.nodePool.Load()
 }
 
+// SwapNodePool atomically replaces the node pool, and returns the previous one.
+// Requests in flight complete against the previous node pool.
+// The drains of the previous node pool are stopped, and the ones of the nodes
+// of the node pool are resumed, if it's initialized, so that only the current
+// node pool writes the node states.
+// The current concurrency limit of the nodes applies to the new node pool, and
+// the node states of the previous node pool carry over to it.
+func (g *Gateway) SwapNodePool(nodePool *nodepool.NodePool) *nodepool.NodePool {
+	if l := g.limiter.Load(); l != nil && nodePool != nil {
+		nodePool.SetMaxConcurrentRequests(l.limits.NodeMaxConcurrentRequests)
+	}
+	if nodePool != nil {
+		nodePool.InheritStates(g.NodePool())
+	}
+	previous := g.nodePool.Swap(nodePool)
+
+	g.drainsMu.Lock()
+	g.stopDrains()
+	g.drainsMu.Unlock()
+
+	if nodePool != nil && nodePool.Initialized() {
+		g.resumeDrains(nodePool)
+	}
+
+	return previous
+}
+
+// SetTimeouts sets the per-request timeouts, for the requests to come.
+func (g *Gateway) SetTimeouts(timeouts Timeouts) {
+	g.timeoutsMu.Lock()
+	defer g.timeoutsMu.Unlock()
+
+	g.timeouts = timeouts
+}
+
+// Run initializes the node pool and serves the requests, with TLS if the server
+// has a TLS config. The server starts listening before the node pool is
+// initialized, to serve the health routes meanwhile.
 func (g *Gateway) Run() error {
-	if err := g.nodePool.Init(); err != nil {
+	nodePool := g.NodePool()
+	if nodePool == nil {
+		return ErrNodePoolEmpty
+	}
+
+	// Listen before initializing the node pool, so that a listen error
+	// doesn't leave an initialized node pool behind.
+	ln, err := net.Listen("tcp", g.srv.Addr)
+	if err != nil {
+		return errors.Wrap(err, "error listening")
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		// The certificates are served by the TLS config of the server, if any.
+		if g.srv.TLSConfig != nil {
+			errCh <- g.srv.ServeTLS(ln, "", "")
+			return
+		}
+		errCh <- g.srv.Serve(ln)
+	}()
+
+	if err := nodePool.Init(); err != nil {
+		g.srv.Close()
 		return err
 	}
-	if err := g.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	g.resumeDrains(nodePool)
+	if err := <-errCh; err != nil && err != http.ErrServerClosed {
 		return err
 	}
 
@@ -105,5 +423,39 @@ func (g *Gateway) Run() error {
 }
 
 func (g *Gateway) Shutdown(ctx context.Context) error {
+	g.drainsMu.Lock()
+	g.stopDrains()
+	g.drainsMu.Unlock()
+
+	if nodePool := g.NodePool(); nodePool != nil {
+		defer nodePool.Close()
+	}
+
 	return g.srv.Shutdown(ctx)
 }
+
+// timeoutsMiddleware applies the current per-request timeouts, overriding the
+// ones the server has been started with.
+func (g *Gateway) timeoutsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.timeoutsMu.RLock()
+		timeouts := g.timeouts
+		g.timeoutsMu.RUnlock()
+
+		rc := http.NewResponseController(w)
+		now := time.Now()
+
+		if timeouts.Read > 0 {
+			if err := rc.SetReadDeadline(now.Add(timeouts.Read)); err != nil {
+				g.logger.WithError(err).Debug("error setting read deadline")
+			}
+		}
+		if timeouts.Write > 0 {
+			if err := rc.SetWriteDeadline(now.Add(timeouts.Write)); err != nil {
+				g.logger.WithError(err).Debug("error setting write deadline")
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
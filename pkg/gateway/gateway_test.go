@@ -2,12 +2,16 @@ package gateway
 
 import (
 	"github.com/gorilla/mux"
+	"net"
 	"net/http"
 	"reflect"
 	"testing"
 
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
 	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func TestNewGateway(t *testing.T) {
@@ -21,6 +25,14 @@ func TestNewGateway(t *testing.T) {
 	srv := &http.Server{Addr: "127.0.0.1:3000"}
 	router := mux.NewRouter()
 
+	newGateway := func(bucket, region string) *Gateway {
+		gw := &Gateway{logger: logger, r: router, srv: srv, bucket: bucket, region: region, minHealthyNodes: defaultMinHealthyNodes,
+			tracer: noop.NewTracerProvider().Tracer(tracerName), propagator: propagation.TraceContext{}}
+		gw.nodePool.Store(nodePool)
+
+		return gw
+	}
+
 	testCases := []struct {
 		name  string
 		given []Option
@@ -29,7 +41,13 @@ func TestNewGateway(t *testing.T) {
 		{
 			name:  "with logger, http server and running nodes",
 			given: []Option{WithLogger(logger), WithHTTPServer(srv), WithNodePool(nodePool), WithRouter(router)},
-			want:  &Gateway{logger: logger, r: router, srv: srv, nodePool: nodePool},
+			want:  newGateway(defaultBucket, defaultRegion),
+		},
+		{
+			name: "with bucket and region",
+			given: []Option{WithLogger(logger), WithHTTPServer(srv), WithNodePool(nodePool), WithRouter(router),
+				WithBucket("mybucket"), WithRegion("eu-west-1")},
+			want: newGateway("mybucket", "eu-west-1"),
 		},
 	}
 
@@ -45,3 +63,29 @@ func TestNewGateway(t *testing.T) {
 		})
 	}
 }
+
+func TestRunListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	server := miniotest.NewServer()
+	defer server.Close()
+
+	nodePool := nodepool.NewNodePool(
+		nodepool.WithNodeConfigs(nodepool.NewNodeConfig(server.Endpoint(), miniotest.AccessKey, miniotest.SecretKey)),
+		nodepool.WithLogger(logrus.StandardLogger()),
+		nodepool.WithHealthCheckRetries(1),
+	)
+	defer nodePool.Close()
+
+	gw := NewGateway(WithHTTPServer(&http.Server{Addr: ln.Addr().String()}), WithNodePool(nodePool))
+	if err := gw.Run(); err == nil {
+		t.Fatal("expected listen error")
+	}
+	if nodePool.Initialized() {
+		t.Error("node pool initialized after listen error")
+	}
+}
@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+)
+
+const (
+	defaultMinHealthyNodes = 1
+
+	statusOK = "ok"
+)
+
+var (
+	ErrNodePoolNotInitialized = errors.New("node pool not initialized")
+	ErrNotEnoughHealthyNodes  = errors.New("not enough healthy nodes")
+)
+
+// nodeHealth is the health of a node, as served by the health API.
+type nodeHealth struct {
+	ID        string    `json:"id"`
+	Healthy   bool      `json:"healthy"`
+	Latency   string    `json:"latency"`
+	LastError string    `json:"lastError,omitempty"`
+	LastCheck time.Time `json:"lastCheck"`
+	Circuit   string    `json:"circuit"`
+}
+
+// AddHealthRoutes adds the liveness, readiness and node health routes.
+func (g *Gateway) AddHealthRoutes(r *mux.Router) {
+	r.Methods(http.MethodGet).Path("/healthz").HandlerFunc(g.LivenessHandler)
+	r.Methods(http.MethodGet).Path("/readyz").HandlerFunc(g.ReadinessHandler)
+	r.Methods(http.MethodGet).Path("/health/nodes").HandlerFunc(g.NodesHealthHandler)
+}
+
+// LivenessHandler reports the gateway process is alive.
+func (g *Gateway) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(statusOK)
+}
+
+// ReadinessHandler reports whether the gateway is ready to serve objects: the
+// node pool is initialized, and at least the minimum number of nodes are healthy.
+func (g *Gateway) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	nodePool := g.NodePool()
+
+	var err error
+	switch {
+	case nodePool == nil:
+		err = ErrNodePoolEmpty
+	case !nodePool.Initialized():
+		err = ErrNodePoolNotInitialized
+	default:
+		if healthy := nodePool.HealthyNodes(); healthy < g.minHealthyNodes {
+			err = errors.Wrap(ErrNotEnoughHealthyNodes, fmt.Sprintf("%d healthy, %d required", healthy, g.minHealthyNodes))
+		}
+	}
+	if err != nil {
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(statusOK)
+}
+
+// NodesHealthHandler returns the health of each node.
+func (g *Gateway) NodesHealthHandler(w http.ResponseWriter, r *http.Request) {
+	nodePool := g.NodePool()
+	if nodePool == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
+		return
+	}
+
+	health := nodePool.Health()
+	nodes := make([]nodeHealth, len(health))
+	for i, h := range health {
+		nodes[i] = newNodeHealth(h)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(nodes)
+}
+
+func newNodeHealth(h nodepool.NodeHealth) nodeHealth {
+	health := nodeHealth{
+		ID:        h.ID,
+		Healthy:   h.Healthy,
+		Latency:   h.Latency.String(),
+		LastCheck: h.LastCheck,
+		Circuit:   h.Circuit.String(),
+	}
+	if h.LastError != nil {
+		health.LastError = h.LastError.Error()
+	}
+
+	return health
+}
@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+)
+
+func TestHealthHandlers(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	notInitialized := NewGateway(
+		WithLogger(logger),
+		WithHTTPServer(&http.Server{}),
+		WithNodePool(nodepool.NewNodePool(nodepool.WithNodeConfigs(nodepool.NewNodeConfig("localhost:9004", "mykey", "mysecret")))),
+	)
+	ready, _ := newTestGateway(t, 2)
+	notEnoughHealthy, _ := newTestGateway(t, 2, WithMinHealthyNodes(3))
+
+	testCases := []struct {
+		name       string
+		gateway    *Gateway
+		path       string
+		wantStatus int
+	}{
+		{name: "with liveness", gateway: notInitialized, path: "/healthz", wantStatus: http.StatusOK},
+		{name: "with node pool not initialized", gateway: notInitialized, path: "/readyz", wantStatus: http.StatusServiceUnavailable},
+		{name: "with node pool ready", gateway: ready, path: "/readyz", wantStatus: http.StatusOK},
+		{name: "with not enough healthy nodes", gateway: notEnoughHealthy, path: "/readyz", wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.gateway.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestNodesHealthHandler(t *testing.T) {
+	gw, servers := newTestGateway(t, 2)
+
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/nodes", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var got []nodeHealth
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(servers) {
+		t.Fatalf("got %d nodes, want %d", len(got), len(servers))
+	}
+	for _, node := range got {
+		if !node.Healthy || node.Circuit != nodepool.CircuitClosed.String() || node.LastCheck.IsZero() {
+			t.Errorf("got node health %+v, want healthy with closed circuit", node)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/pkg/metrics"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	gw := NewGateway(
+		WithLogger(logger),
+		WithHTTPServer(&http.Server{}),
+		WithMetrics(metrics.New(metrics.WithRegistry(prometheus.NewRegistry())), "/metrics"),
+	)
+
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	for _, want := range []string{
+		`object_storage_gateway_http_requests_total{method="GET",node="",status="200"} 1`,
+		`object_storage_gateway_http_requests_in_flight 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("got metrics %s, want %s", rec.Body.String(), want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// peerNodeHeader is the header of the node the peer read the object from.
+	peerNodeHeader = "X-Object-Node"
+
+	// The results of the reads forwarded to the peers owning the objects.
+	peerForwarded = "forwarded"
+	peerFallback  = "fallback"
+
+	// peerUncacheAttempts is the number of attempts to remove a cached object
+	// from its owner, backing off exponentially from peerUncacheBackoff.
+	peerUncacheAttempts = 3
+	peerUncacheBackoff  = 100 * time.Millisecond
+
+	// peerUncacheTimeout bounds the removal of a cached object from its owner,
+	// retries included.
+	peerUncacheTimeout = 5 * time.Second
+)
+
+var (
+	ErrPeerFailed = errors.New("peer failed")
+)
+
+// AddPeerRoutes adds the routes the peer gateways forward the reads of the
+// objects the gateway owns to, and invalidate them at, authenticated with the
+// peer token. The objects are addressed by the bucket they're stored in.
+func (g *Gateway) AddPeerRoutes(r *mux.Router) {
+	peerRouter := r.PathPrefix("/peer").Subrouter()
+	peerRouter.Use(g.peerAuthMiddleware)
+	path := fmt.Sprintf("/object/{bucket:%s}/{key:%s}", peerBucketRegex, objectKeyRegex)
+	peerRouter.Methods(http.MethodGet).Path(path).HandlerFunc(g.PeerGetObjectHandler)
+	peerRouter.Methods(http.MethodDelete).Path(path).HandlerFunc(g.PeerUncacheObjectHandler)
+}
+
+// PeerGetObjectHandler serves the object to the peer which forwarded its read,
+// with its ETag, from the cache or read from the nodes.
+func (g *Gateway) PeerGetObjectHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucket, objectKey := vars["bucket"], vars["key"]
+	setRequestObject(r.Context(), objectKey, "")
+	if !g.ownsBucket(bucket) {
+		err := errors.Wrapf(ErrBucketNameNotValid, "%s not owned", bucket)
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+
+	nodePool := g.NodePool()
+	if nodePool == nil {
+		setRequestError(r.Context(), ErrNodePoolEmpty)
+
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
+		return
+	}
+
+	res := g.fetchObject(r.Context(), nodePool, bucket, objectKey)
+	setRequestObject(r.Context(), objectKey, res.nodeID)
+	if res.err != nil {
+		setRequestError(r.Context(), res.err)
+
+		w.WriteHeader(errorStatusCode(res.err))
+		json.NewEncoder(w).Encode(res.err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", res.etag)
+	w.Header().Set(peerNodeHeader, res.nodeID)
+	w.WriteHeader(http.StatusOK)
+	w.Write(res.content)
+}
+
+// PeerUncacheObjectHandler removes the cached object, once it's put through a
+// peer. The reads of the object in flight are not cached.
+func (g *Gateway) PeerUncacheObjectHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	g.uncacheObject(objectCacheKey(vars["bucket"], vars["key"]))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// peerAuthMiddleware rejects the requests without the peer bearer token.
+func (g *Gateway) peerAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !bearerAuthorized(r, g.peerToken) {
+			g.logger.Debug("peer request unauthorized")
+
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(ErrUnauthorized.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardObject reads the object in the bucket through the peer owning it, if
+// any other than the gateway itself, and returns whether it's forwarded. The
+// objects are read by the gateway itself if their owner fails, e.g. while it's
+// leaving the ring.
+func (g *Gateway) forwardObject(ctx context.Context, bucket, objectKey string) (objectRead, bool) {
+	peer, self := g.peers.Owner(objectCacheKey(bucket, objectKey))
+	if self {
+		return objectRead{}, false
+	}
+
+	res, err := g.peerGetObject(ctx, peer, bucket, objectKey)
+	if err != nil && ctx.Err() == nil {
+		g.logger.WithError(err).Warnf("error reading object %s from peer %s", objectKey, peer)
+		g.metrics.PeerRead(peerFallback)
+
+		return objectRead{}, false
+	}
+	g.metrics.PeerRead(peerForwarded)
+
+	return res, true
+}
+
+// peerGetObject reads the object in the bucket from the peer. The objects not
+// found by the peer are read with a not found error.
+func (g *Gateway) peerGetObject(ctx context.Context, peer, bucket, objectKey string) (res objectRead, err error) {
+	ctx, span := g.startSpan(ctx, "peer.getObject", attributeBucket.String(bucket), attributeObjectKey.String(objectKey))
+	defer func() { endSpan(span, err) }()
+
+	resp, err := g.peerRequest(ctx, http.MethodGet, peer, bucket, objectKey)
+	if err != nil {
+		return objectRead{err: err}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		res.content, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return objectRead{err: err}, err
+		}
+		res.etag = resp.Header.Get("ETag")
+		res.nodeID = resp.Header.Get(peerNodeHeader)
+
+		return res, nil
+	case http.StatusNotFound:
+		var message string
+		json.NewDecoder(resp.Body).Decode(&message)
+
+		return objectRead{err: minio.ErrorResponse{StatusCode: resp.StatusCode, Message: message}}, nil
+	default:
+		err = errors.Wrapf(ErrPeerFailed, "status %d", resp.StatusCode)
+
+		return objectRead{err: err}, err
+	}
+}
+
+// uncachePeerObject removes the cached object in the bucket from the peer
+// owning it, if any other than the gateway itself, e.g. once it's put. The
+// removal runs in the background, even once the context is cancelled, and is
+// retried if the peer fails, a few times within peerUncacheTimeout.
+func (g *Gateway) uncachePeerObject(ctx context.Context, bucket, objectKey string) {
+	peer, self := g.peers.Owner(objectCacheKey(bucket, objectKey))
+	if self {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), peerUncacheTimeout)
+	go func() {
+		defer cancel()
+
+		err := g.peerUncacheObject(ctx, peer, bucket, objectKey)
+		backoff := peerUncacheBackoff
+		for attempt := 1; err != nil && attempt < peerUncacheAttempts; attempt++ {
+			g.logger.WithError(err).Debugf("error removing cached object %s from peer %s, retrying", objectKey, peer)
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				g.logger.WithError(ctx.Err()).Errorf("error removing cached object %s from peer %s", objectKey, peer)
+				return
+			case <-timer.C:
+			}
+			backoff *= 2
+
+			err = g.peerUncacheObject(ctx, peer, bucket, objectKey)
+		}
+		if err != nil {
+			g.logger.WithError(err).Errorf("error removing cached object %s from peer %s", objectKey, peer)
+		}
+	}()
+}
+
+// peerUncacheObject removes the cached object in the bucket from the peer.
+func (g *Gateway) peerUncacheObject(ctx context.Context, peer, bucket, objectKey string) error {
+	resp, err := g.peerRequest(ctx, http.MethodDelete, peer, bucket, objectKey)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.Wrapf(ErrPeerFailed, "status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// peerRequest sends the request of the object in the bucket to the peer route
+// of the peer.
+func (g *Gateway) peerRequest(ctx context.Context, method, peer, bucket, objectKey string) (*http.Response, error) {
+	target := fmt.Sprintf("%s/peer/object/%s/%s", peer, url.PathEscape(bucket), url.PathEscape(objectKey))
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", bearerPrefix+g.peerToken)
+	g.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	return g.peerClient.Do(req)
+}
@@ -0,0 +1,207 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+	"github.com/maxgio92/homework-object-storage/pkg/cache"
+	"github.com/maxgio92/homework-object-storage/pkg/peers"
+)
+
+func TestPeers(t *testing.T) {
+	const token = "peer-token"
+
+	// The gateways are in front of distinct nodes, so that the reads served
+	// through the peers are told apart.
+	peersA, peersB := peers.New(), peers.New()
+	gwA, serversA := newTestGateway(t, 1, WithCache(cache.New()), WithPeers(peersA, token, nil))
+	gwB, serversB := newTestGateway(t, 1, WithCache(cache.New()), WithPeers(peersB, token, nil))
+	tsA, tsB := httptest.NewServer(gwA.r), httptest.NewServer(gwB.r)
+	t.Cleanup(tsA.Close)
+	t.Cleanup(tsB.Close)
+	peersA.Set(tsA.URL, []string{tsA.URL, tsB.URL})
+	peersB.Set(tsB.URL, []string{tsA.URL, tsB.URL})
+
+	// ownedByB returns the i-th object key owned by the gateway B.
+	ownedByB := func(i int) string {
+		for n := 0; ; n++ {
+			key := fmt.Sprintf("key%d", n)
+			if owner, _ := peersA.Owner(objectCacheKey(defaultBucket, key)); owner == tsB.URL {
+				if i == 0 {
+					return key
+				}
+				i--
+			}
+		}
+	}
+	get := func(key string) (string, int) {
+		rec := httptest.NewRecorder()
+		gwA.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/object/"+key, nil))
+		var content []byte
+		json.NewDecoder(rec.Body).Decode(&content)
+		return string(content), rec.Code
+	}
+
+	key := ownedByB(0)
+	serversB[0].PutObject(defaultBucket, key, []byte("hello"))
+	for i := 0; i < 2; i++ {
+		if got, code := get(key); code != http.StatusOK || got != "hello" {
+			t.Errorf("got status %d and content %q, want %d and %q", code, got, http.StatusOK, "hello")
+		}
+	}
+	if got := serversB[0].Calls(miniotest.OpGetObject); got != 1 {
+		t.Errorf("got %d reads from the nodes of the owner, want 1", got)
+	}
+	if got := serversA[0].Calls(miniotest.OpGetObject); got != 0 {
+		t.Errorf("got %d reads from the nodes of the gateway, want none", got)
+	}
+	if _, _, ok := gwA.cache.Get(objectCacheKey(defaultBucket, key)); ok {
+		t.Error("got object cached by the gateway, want it cached by the owner only")
+	}
+	if _, code := get(ownedByB(1)); code != http.StatusNotFound {
+		t.Errorf("got status %d of an object not found by the owner, want %d", code, http.StatusNotFound)
+	}
+
+	// The objects put are removed from the cache of the owner.
+	rec := httptest.NewRecorder()
+	gwA.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/"+key, strings.NewReader("world")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got put status %d, want %d", rec.Code, http.StatusOK)
+	}
+	// The owner removes it in the background.
+	cached := func() bool { _, _, ok := gwB.cache.Get(objectCacheKey(defaultBucket, key)); return ok }
+	for deadline := time.Now().Add(time.Second); cached() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cached() {
+		t.Error("got object put cached by the owner, want it removed")
+	}
+
+	// The peer routes require the peer token.
+	resp, err := http.Get(fmt.Sprintf("%s/peer/object/%s/%s", tsB.URL, defaultBucket, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got peer status %d without token, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	// The objects are read by the gateway itself, when their owner fails.
+	tsB.Close()
+	key = ownedByB(2)
+	serversA[0].PutObject(defaultBucket, key, []byte("fallback"))
+	if got, code := get(key); code != http.StatusOK || got != "fallback" {
+		t.Errorf("got status %d and content %q with the owner down, want %d and %q", code, got, http.StatusOK, "fallback")
+	}
+}
+
+func TestPeersPutThroughNonOwner(t *testing.T) {
+	const token = "peer-token"
+
+	// The gateways are in front of the same nodes.
+	peersA, peersB := peers.New(), peers.New()
+	gwA, _ := newTestGateway(t, 1, WithCache(cache.New()), WithPeers(peersA, token, nil))
+	gwB := NewGateway(WithLogger(gwA.logger), WithHTTPServer(&http.Server{}), WithNodePool(gwA.NodePool()),
+		WithCache(cache.New()), WithPeers(peersB, token, nil))
+
+	// The owner fails the removal of the object it cached first.
+	var deletes atomic.Int32
+	tsA := httptest.NewServer(gwA.r)
+	tsB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete && deletes.Add(1) == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		gwB.r.ServeHTTP(w, r)
+	}))
+	t.Cleanup(tsA.Close)
+	t.Cleanup(tsB.Close)
+	peersA.Set(tsA.URL, []string{tsA.URL, tsB.URL})
+	peersB.Set(tsB.URL, []string{tsA.URL, tsB.URL})
+
+	var key string
+	for n := 0; key == ""; n++ {
+		if owner, _ := peersA.Owner(objectCacheKey(defaultBucket, fmt.Sprintf("key%d", n))); owner == tsB.URL {
+			key = fmt.Sprintf("key%d", n)
+		}
+	}
+
+	serve := func(gw *Gateway, method, body string) (string, int) {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(method, "/object/"+key, strings.NewReader(body)))
+		var content []byte
+		json.NewDecoder(rec.Body).Decode(&content)
+		return string(content), rec.Code
+	}
+
+	for _, content := range []string{"hello", "world", "again"} {
+		if _, code := serve(gwA, http.MethodPut, content); code != http.StatusOK {
+			t.Fatalf("got put status %d, want %d", code, http.StatusOK)
+		}
+		// The object put through the gateway is read through the owner, once
+		// removed from its cache in the background.
+		for _, gw := range []*Gateway{gwA, gwB} {
+			got, code := serve(gw, http.MethodGet, "")
+			for deadline := time.Now().Add(time.Second); got != content && time.Now().Before(deadline); {
+				time.Sleep(10 * time.Millisecond)
+				got, code = serve(gw, http.MethodGet, "")
+			}
+			if code != http.StatusOK || got != content {
+				t.Errorf("got status %d and content %q, want %d and %q", code, got, http.StatusOK, content)
+			}
+		}
+	}
+	if got := deletes.Load(); got < 4 {
+		t.Errorf("got %d removals by the owner, want the failed one retried", got)
+	}
+}
+
+func TestPeersPutOwnerHanging(t *testing.T) {
+	const token = "peer-token"
+
+	peersA := peers.New()
+	gwA, _ := newTestGateway(t, 1, WithCache(cache.New()), WithPeers(peersA, token, nil))
+
+	// The owner hangs on the removal of the cached objects until the test ends.
+	hanging := make(chan struct{})
+	tsA := httptest.NewServer(gwA.r)
+	tsB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hanging
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(tsA.Close)
+	t.Cleanup(tsB.Close)
+	t.Cleanup(func() { close(hanging) })
+	peersA.Set(tsA.URL, []string{tsA.URL, tsB.URL})
+
+	var key string
+	for n := 0; key == ""; n++ {
+		if owner, _ := peersA.Owner(objectCacheKey(defaultBucket, fmt.Sprintf("key%d", n))); owner == tsB.URL {
+			key = fmt.Sprintf("key%d", n)
+		}
+	}
+
+	// The put isn't delayed by the owner.
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		gwA.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/"+key, strings.NewReader("hello")))
+		done <- rec.Code
+	}()
+	select {
+	case code := <-done:
+		if code != http.StatusOK {
+			t.Errorf("got put status %d, want %d", code, http.StatusOK)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("got put delayed by the owner hanging")
+	}
+}
@@ -0,0 +1,156 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+)
+
+const (
+	defaultPresignExpiry = 15 * time.Minute
+	maxPresignBodySize   = 1 << 16
+)
+
+var (
+	ErrPresignRequestNotValid = errors.New("presign request not valid")
+)
+
+var objectKeyPattern = regexp.MustCompile("^" + objectKeyRegex + "$")
+
+// presignRequest is a request of a presigned URL.
+type presignRequest struct {
+	// Method is the method the URL authorizes, either GET or PUT.
+	Method string `json:"method"`
+	Key    string `json:"key"`
+
+	// Tenant is the tenant of the object, by default the one of the requester.
+	Tenant string `json:"tenant"`
+
+	// ExpiresIn is the number of seconds the URL is valid for.
+	ExpiresIn int64 `json:"expiresIn"`
+
+	// MaxContentLength limits the content length of the uploads, if positive.
+	MaxContentLength int64 `json:"maxContentLength"`
+}
+
+type presignedURL struct {
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// PresignHandler issues a URL which authorizes a request to an object without
+// credentials, e.g. to upload it from a browser. The requester must be allowed
+// the request itself.
+func (g *Gateway) PresignHandler(w http.ResponseWriter, r *http.Request) {
+	authenticator := g.Authenticator()
+	if authenticator == nil {
+		setRequestError(r.Context(), auth.ErrPresignDisabled)
+
+		w.WriteHeader(http.StatusNotImplemented)
+		json.NewEncoder(w).Encode(auth.ErrPresignDisabled.Error())
+		return
+	}
+
+	var req presignRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxPresignBodySize)).Decode(&req); err != nil {
+		err = errors.Wrap(ErrPresignRequestNotValid, err.Error())
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	setRequestObject(r.Context(), req.Key, "")
+
+	principal, ok := g.authenticate(w, r, authenticator, auth.ActionOf(req.Method), req.Key)
+	if !ok {
+		return
+	}
+	tenant, ok := g.setTenant(w, r, principal, req.Tenant)
+	if !ok {
+		return
+	}
+
+	expiry := defaultPresignExpiry
+	if req.ExpiresIn > 0 {
+		// The expiry is checked before it's converted to a duration, not to overflow.
+		if maxExpiry := authenticator.MaxPresignExpiry(); maxExpiry > 0 && req.ExpiresIn > int64(maxExpiry/time.Second) {
+			err := errors.Wrapf(auth.ErrPresignExpiryNotValid, "expiry must be between 0 and %s", maxExpiry)
+			setRequestError(r.Context(), err)
+
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err.Error())
+			return
+		}
+		expiry = time.Duration(req.ExpiresIn) * time.Second
+	}
+	path := "/object/" + req.Key
+	if tenant != "" {
+		path = "/t/" + tenant + path
+	}
+	query, expiresAt, err := authenticator.Presign(principal.ID, req.Method, path, expiry, req.MaxContentLength)
+	if err != nil {
+		setRequestError(r.Context(), err)
+
+		status := http.StatusBadRequest
+		if errors.Is(err, auth.ErrPresignDisabled) {
+			status = http.StatusNotImplemented
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(presignedURL{
+		URL:       g.baseURL(r) + path + "?" + query.Encode(),
+		Method:    req.Method,
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
+
+// validate normalizes the method of the request, and returns an error if the
+// request is not valid.
+func (p *presignRequest) validate() error {
+	p.Method = strings.ToUpper(p.Method)
+	if p.Method != http.MethodGet && p.Method != http.MethodPut {
+		return errors.Wrapf(ErrPresignRequestNotValid, "method %q not supported", p.Method)
+	}
+	if !objectKeyPattern.MatchString(p.Key) || len(p.Key) > maxObjectKeysize {
+		return errors.Wrap(ErrPresignRequestNotValid, ErrObjectKeyNotValid.Error())
+	}
+	if p.ExpiresIn < 0 || p.MaxContentLength < 0 {
+		return errors.Wrap(ErrPresignRequestNotValid, "negative expiry or content length")
+	}
+
+	return nil
+}
+
+// baseURL returns the base of the presigned URLs, by default the host of the request.
+func (g *Gateway) baseURL(r *http.Request) string {
+	if g.presignBaseURL != "" {
+		return g.presignBaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
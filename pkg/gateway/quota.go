@@ -0,0 +1,344 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+)
+
+var (
+	ErrObjectTooLarge = errors.New("object too large")
+	ErrQuotaExceeded  = errors.New("quota exceeded")
+	ErrQuotasNotValid = errors.New("quotas not valid")
+)
+
+var quotaPrefixPattern = regexp.MustCompile("^[0-9a-z]*$")
+
+// Quota limits the storage used by the objects of the tenant with the key
+// prefix, e.g. by all the objects of the tenant with an empty prefix. The
+// limits are disabled when zero.
+type Quota struct {
+	Tenant     string `json:"tenant,omitempty"`
+	Prefix     string `json:"prefix"`
+	MaxBytes   int64  `json:"maxBytes"`
+	MaxObjects int64  `json:"maxObjects"`
+}
+
+// QuotaStatus is a quota and the storage used by its objects, as served by the
+// admin API.
+type QuotaStatus struct {
+	Quota
+	Usage    nodepool.Usage `json:"usage"`
+	Exceeded bool           `json:"exceeded"`
+
+	// RefreshedAt is when the usage was last listed from the nodes. It's
+	// tracked by the gateway in between, and from zero before.
+	RefreshedAt *time.Time `json:"refreshedAt,omitempty"`
+}
+
+// ValidateQuotas returns an error if the quotas are not valid.
+func ValidateQuotas(quotas []Quota) error {
+	ids := make(map[string]bool, len(quotas))
+	for _, q := range quotas {
+		if q.Tenant != "" && !tenantPattern.MatchString(q.Tenant) {
+			return errors.Wrapf(ErrQuotasNotValid, "tenant %q is not valid", q.Tenant)
+		}
+		if !quotaPrefixPattern.MatchString(q.Prefix) || len(q.Prefix) > maxObjectKeysize {
+			return errors.Wrapf(ErrQuotasNotValid, "prefix %q is not a valid object key prefix", q.Prefix)
+		}
+		if ids[q.id()] {
+			return errors.Wrapf(ErrQuotasNotValid, "prefix %q of tenant %q is duplicated", q.Prefix, q.Tenant)
+		}
+		ids[q.id()] = true
+		if q.MaxBytes < 0 || q.MaxObjects < 0 {
+			return errors.Wrapf(ErrQuotasNotValid, "limits of prefix %q must not be negative", q.Prefix)
+		}
+	}
+
+	return nil
+}
+
+// id returns the ID of the quota, unique by tenant and prefix.
+func (q Quota) id() string {
+	return q.Tenant + "/" + q.Prefix
+}
+
+// quotaTracker tracks the storage used by the objects of each quota, listed
+// from the nodes on refresh, and updated with the objects stored in between.
+type quotaTracker struct {
+	quotas []Quota
+
+	// usage is the usage of the quotas, by ID.
+	usage       map[string]nodepool.Usage
+	refreshedAt time.Time
+	mu          sync.Mutex
+}
+
+func newQuotaTracker(quotas []Quota) *quotaTracker {
+	return &quotaTracker{quotas: quotas, usage: make(map[string]nodepool.Usage, len(quotas))}
+}
+
+// tenantPrefixes returns the key prefixes of the quotas, by tenant.
+func (t *quotaTracker) tenantPrefixes() map[string][]string {
+	prefixes := make(map[string][]string)
+	for _, q := range t.quotas {
+		prefixes[q.Tenant] = append(prefixes[q.Tenant], q.Prefix)
+	}
+
+	return prefixes
+}
+
+// matching returns the quotas of the object key of the tenant.
+func (t *quotaTracker) matching(tenant, key string) []Quota {
+	var quotas []Quota
+	for _, q := range t.quotas {
+		if q.Tenant == tenant && strings.HasPrefix(key, q.Prefix) {
+			quotas = append(quotas, q)
+		}
+	}
+
+	return quotas
+}
+
+// reserve adds the bytes and the objects to the usage of the quotas of the
+// object key of the tenant, if none is exceeded, and returns the func which
+// cancels it.
+func (t *quotaTracker) reserve(tenant, key string, bytes, objects int64) (func(), error) {
+	quotas := t.matching(tenant, key)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, q := range quotas {
+		u := t.usage[q.id()]
+		if q.MaxBytes > 0 && bytes > 0 && u.Bytes+bytes > q.MaxBytes {
+			return nil, errors.Wrapf(ErrQuotaExceeded, "prefix %q of tenant %q uses %d of %d bytes",
+				q.Prefix, q.Tenant, u.Bytes, q.MaxBytes)
+		}
+		if q.MaxObjects > 0 && objects > 0 && u.Objects+objects > q.MaxObjects {
+			return nil, errors.Wrapf(ErrQuotaExceeded, "prefix %q of tenant %q stores %d of %d objects",
+				q.Prefix, q.Tenant, u.Objects, q.MaxObjects)
+		}
+	}
+	t.add(quotas, bytes, objects)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			t.add(quotas, -bytes, -objects)
+		})
+	}, nil
+}
+
+// add adds the bytes and the objects to the usage of the quotas, not below zero.
+func (t *quotaTracker) add(quotas []Quota, bytes, objects int64) {
+	for _, q := range quotas {
+		u := t.usage[q.id()]
+		u.Bytes = max(u.Bytes+bytes, 0)
+		u.Objects = max(u.Objects+objects, 0)
+		t.usage[q.id()] = u
+	}
+}
+
+// setUsage replaces the usage of the quotas, by ID, as listed from the nodes at now.
+func (t *quotaTracker) setUsage(usage map[string]nodepool.Usage, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.usage = usage
+	t.refreshedAt = now
+}
+
+// statuses returns the quotas and their usage.
+func (t *quotaTracker) statuses() []QuotaStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := make([]QuotaStatus, len(t.quotas))
+	for i, q := range t.quotas {
+		u := t.usage[q.id()]
+		statuses[i] = QuotaStatus{
+			Quota:    q,
+			Usage:    u,
+			Exceeded: (q.MaxBytes > 0 && u.Bytes >= q.MaxBytes) || (q.MaxObjects > 0 && u.Objects >= q.MaxObjects),
+		}
+		if !t.refreshedAt.IsZero() {
+			refreshedAt := t.refreshedAt
+			statuses[i].RefreshedAt = &refreshedAt
+		}
+	}
+
+	return statuses
+}
+
+// Quotas returns the quotas and the storage used by their objects.
+func (g *Gateway) Quotas() []QuotaStatus {
+	if t := g.quotas.Load(); t != nil {
+		return t.statuses()
+	}
+
+	return []QuotaStatus{}
+}
+
+// SetQuotas replaces the quotas, at runtime. The usage of the previous quotas of
+// the same tenants and prefixes is kept, until the next refresh.
+func (g *Gateway) SetQuotas(quotas []Quota) error {
+	if err := ValidateQuotas(quotas); err != nil {
+		return err
+	}
+	if len(quotas) == 0 {
+		g.quotas.Store(nil)
+		return nil
+	}
+
+	t := newQuotaTracker(quotas)
+	if previous := g.quotas.Load(); previous != nil {
+		previous.mu.Lock()
+		for _, q := range quotas {
+			if u, ok := previous.usage[q.id()]; ok {
+				t.usage[q.id()] = u
+			}
+		}
+		t.refreshedAt = previous.refreshedAt
+		previous.mu.Unlock()
+	}
+	g.quotas.Store(t)
+
+	return nil
+}
+
+// RefreshQuotaUsage lists the storage used by the objects of the quotas from
+// the nodes.
+func (g *Gateway) RefreshQuotaUsage(ctx context.Context) error {
+	t := g.quotas.Load()
+	if t == nil {
+		return nil
+	}
+	nodePool := g.NodePool()
+	if nodePool == nil || !nodePool.Initialized() {
+		return ErrNodePoolEmpty
+	}
+
+	now := time.Now()
+	usage := make(map[string]nodepool.Usage, len(t.quotas))
+	for tenant, prefixes := range t.tenantPrefixes() {
+		tenantUsage, err := g.tenantUsage(ctx, nodePool, tenant, prefixes)
+		if err != nil {
+			return errors.Wrapf(err, "error listing the usage of the quotas of tenant %q", tenant)
+		}
+		for prefix, u := range tenantUsage {
+			usage[Quota{Tenant: tenant, Prefix: prefix}.id()] = u
+		}
+	}
+	t.setUsage(usage, now)
+
+	return nil
+}
+
+// tenantUsage returns the storage used by the objects with each of the key
+// prefixes in the bucket of the tenant and in its named buckets.
+func (g *Gateway) tenantUsage(ctx context.Context, nodePool *nodepool.NodePool, tenant string,
+	prefixes []string) (map[string]nodepool.Usage, error) {
+	tenantBucket := g.tenantBucket(tenant)
+	named, err := nodePool.ListBuckets(ctx, tenantBucket+".")
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []string{tenantBucket}
+	for _, b := range named {
+		buckets = append(buckets, b.Name)
+	}
+
+	usage := make(map[string]nodepool.Usage, len(prefixes))
+	for _, bucket := range buckets {
+		bucketUsage, err := nodePool.Usage(ctx, bucket, prefixes)
+		if err != nil {
+			return nil, err
+		}
+		for prefix, u := range bucketUsage {
+			total := usage[prefix]
+			total.Bytes += u.Bytes
+			total.Objects += u.Objects
+			usage[prefix] = total
+		}
+	}
+
+	return usage, nil
+}
+
+// WatchQuotaUsage refreshes the usage of the quotas at the interval, until the
+// context is done.
+func (g *Gateway) WatchQuotaUsage(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.RefreshQuotaUsage(ctx); err != nil {
+				g.logger.WithError(err).Error("error refreshing the usage of the quotas")
+			}
+		}
+	}
+}
+
+// reserveQuota reserves the storage of the object of the tenant to put in the
+// bucket on the nodes, the primary first, in the usage of its quotas, and
+// returns the func which cancels it. The size of the object it overwrites, if
+// any, is released.
+func (g *Gateway) reserveQuota(ctx context.Context, nodePool *nodepool.NodePool, nodeIDs []string, tenant, bucket,
+	key string, size int64) (func(), error) {
+	t := g.quotas.Load()
+	if t == nil || len(t.matching(tenant, key)) == 0 {
+		return func() {}, nil
+	}
+
+	bytes, objects := size, int64(1)
+	if client := nodePool.NodeClient(nodeIDs[0]); client != nil {
+		info, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+		switch {
+		case err == nil:
+			bytes, objects = size-info.Size, 0
+		case minio.ToErrorResponse(err).StatusCode != http.StatusNotFound:
+			g.logger.WithError(err).Debugf("error getting object %s size from node %s", key, nodeIDs[0])
+		}
+	}
+
+	return t.reserve(tenant, key, bytes, objects)
+}
+
+// QuotasHandler serves the quotas and the storage used by their objects.
+func (g *Gateway) QuotasHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(g.Quotas())
+}
+
+// RefreshQuotasHandler lists the storage used by the objects of the quotas from
+// the nodes, and serves the quotas.
+func (g *Gateway) RefreshQuotasHandler(w http.ResponseWriter, r *http.Request) {
+	if err := g.RefreshQuotaUsage(r.Context()); err != nil {
+		g.logger.WithError(err).Error("error refreshing the usage of the quotas")
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+
+	g.QuotasHandler(w, r)
+}
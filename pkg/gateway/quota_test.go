@@ -0,0 +1,200 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+)
+
+func TestMaxObjectSize(t *testing.T) {
+	gw, _ := newTestGateway(t, 1, WithMaxObjectSize(5))
+
+	testCases := []struct {
+		name       string
+		body       io.Reader
+		wantStatus int
+	}{
+		{name: "within the size", body: strings.NewReader("hello"), wantStatus: http.StatusOK},
+		{name: "with content length over the size", body: strings.NewReader("hello world"), wantStatus: http.StatusRequestEntityTooLarge},
+		// The length of the body is unknown until it's read.
+		{name: "with body over the size", body: io.MultiReader(strings.NewReader("hello"), strings.NewReader(" world")),
+			wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/foo", tt.body))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	gw, servers := newTestGateway(t, 2, WithAdminToken("secret"), WithQuotas([]Quota{
+		{Prefix: "a", MaxBytes: 10},
+		{Prefix: "b", MaxObjects: 2},
+	}))
+	servers[0].PutObject(defaultBucket, "a1", []byte("hello"))
+	servers[1].PutObject(defaultBucket, "b1", []byte("hello"))
+
+	put := func(key, body string) int {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/"+key, strings.NewReader(body)))
+		return rec.Code
+	}
+	quotas := func() map[string]QuotaStatus {
+		req := httptest.NewRequest(http.MethodGet, "/admin/quotas", nil)
+		req.Header.Set("Authorization", bearerPrefix+"secret")
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, req)
+
+		var statuses []QuotaStatus
+		json.NewDecoder(rec.Body).Decode(&statuses)
+		byPrefix := make(map[string]QuotaStatus)
+		for _, s := range statuses {
+			byPrefix[s.Prefix] = s
+		}
+		return byPrefix
+	}
+
+	if err := gw.RefreshQuotaUsage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := quotas()
+	if got["a"].Usage != (nodepool.Usage{Bytes: 5, Objects: 1}) || got["a"].RefreshedAt == nil {
+		t.Errorf("got quota a status %+v, want the usage of the nodes", got["a"])
+	}
+
+	if code := put("a2", "hello"); code != http.StatusOK {
+		t.Errorf("got status %d within the bytes quota, want %d", code, http.StatusOK)
+	}
+	if code := put("a3", "x"); code != http.StatusInsufficientStorage {
+		t.Errorf("got status %d over the bytes quota, want %d", code, http.StatusInsufficientStorage)
+	}
+	// The size of an overwritten object is released.
+	if code := put("a2", "hi"); code != http.StatusOK {
+		t.Errorf("got status %d overwriting within the bytes quota, want %d", code, http.StatusOK)
+	}
+	if got := quotas()["a"]; got.Usage != (nodepool.Usage{Bytes: 7, Objects: 2}) || got.Exceeded {
+		t.Errorf("got quota a status %+v", got)
+	}
+
+	if code := put("b2", "hello"); code != http.StatusOK {
+		t.Errorf("got status %d within the objects quota, want %d", code, http.StatusOK)
+	}
+	if code := put("b3", "hello"); code != http.StatusInsufficientStorage {
+		t.Errorf("got status %d over the objects quota, want %d", code, http.StatusInsufficientStorage)
+	}
+	if code := put("b2", "hello world"); code != http.StatusOK {
+		t.Errorf("got status %d overwriting over the objects quota, want %d", code, http.StatusOK)
+	}
+	if got := quotas()["b"]; !got.Exceeded {
+		t.Errorf("got quota b status %+v, want exceeded", got)
+	}
+
+	// The keys without quota are not limited.
+	if code := put("c1", strings.Repeat("x", 20)); code != http.StatusOK {
+		t.Errorf("got status %d without quota, want %d", code, http.StatusOK)
+	}
+
+	// The usage is kept for the prefixes of the new quotas.
+	if err := gw.SetQuotas([]Quota{{Prefix: "a", MaxBytes: 100}, {Prefix: "A"}}); err == nil {
+		t.Error("got no error setting quotas not valid, want one")
+	}
+	if err := gw.SetQuotas([]Quota{{Prefix: "a", MaxBytes: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := quotas(); len(got) != 1 || got["a"].Usage.Bytes != 7 {
+		t.Errorf("got quotas %+v", got)
+	}
+}
+
+func TestQuotaReservationCancel(t *testing.T) {
+	tracker := newQuotaTracker([]Quota{{Prefix: "", MaxBytes: 10}})
+
+	cancel, err := tracker.reserve("", "foo", 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracker.reserve("", "bar", 1, 1); err == nil {
+		t.Error("got no error over the quota, want one")
+	}
+	cancel()
+	cancel()
+	if got := tracker.usage["/"]; got != (nodepool.Usage{}) {
+		t.Errorf("got usage %+v after cancel, want none", got)
+	}
+	if _, err := tracker.reserve("", "bar", 1, 1); err != nil {
+		t.Errorf("got error %v after cancel, want none", err)
+	}
+}
+
+func TestPutObjectQuotaNotStored(t *testing.T) {
+	gw, servers := newTestGateway(t, 1, WithQuotas([]Quota{{Prefix: "", MaxObjects: 1}}))
+	// The circuit breaker of the node opens.
+	for i := 0; i < 5; i++ {
+		gw.NodePool().ReportResult(servers[0].Endpoint(), errors.New("node down"))
+	}
+
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/foo", bytes.NewBufferString("hello")))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	// The reservation of the object not stored is cancelled.
+	if got := gw.Quotas()[0].Usage; got != (nodepool.Usage{}) {
+		t.Errorf("got usage %+v, want none", got)
+	}
+}
+
+func TestQuotasNamedBuckets(t *testing.T) {
+	gw, servers := newTestGateway(t, 2, WithQuotas([]Quota{{Tenant: "acme", Prefix: "", MaxObjects: 3}}))
+
+	serve := func(method, path, body string) int {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := serve(http.MethodPut, "/t/acme/bucket/photos", ""); code != http.StatusCreated {
+		t.Fatalf("got create bucket status %d, want %d", code, http.StatusCreated)
+	}
+	servers[0].PutObject(defaultBucket+"-acme.photos", "a1", []byte("hello"))
+	if err := gw.RefreshQuotaUsage(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := gw.Quotas()[0].Usage; got != (nodepool.Usage{Bytes: 5, Objects: 1}) {
+		t.Errorf("got usage %+v, want the one of the named bucket", got)
+	}
+
+	// The puts to the bucket of the tenant and to its named buckets share the quota.
+	if code := serve(http.MethodPut, "/t/acme/object/a2", "hello"); code != http.StatusOK {
+		t.Errorf("got status %d within the quota, want %d", code, http.StatusOK)
+	}
+	if code := serve(http.MethodPut, "/t/acme/bucket/photos/object/a3", "hello"); code != http.StatusOK {
+		t.Errorf("got status %d within the quota, want %d", code, http.StatusOK)
+	}
+	if code := serve(http.MethodPut, "/t/acme/bucket/photos/object/a4", "hello"); code != http.StatusInsufficientStorage {
+		t.Errorf("got status %d to named bucket over the quota, want %d", code, http.StatusInsufficientStorage)
+	}
+	// The objects overwritten in the named buckets are not counted twice.
+	if code := serve(http.MethodPut, "/t/acme/bucket/photos/object/a3", "hi"); code != http.StatusOK {
+		t.Errorf("got status %d overwriting within the quota, want %d", code, http.StatusOK)
+	}
+	if got := gw.Quotas()[0].Usage; got != (nodepool.Usage{Bytes: 12, Objects: 3}) {
+		t.Errorf("got usage %+v, want the one of every bucket", got)
+	}
+}
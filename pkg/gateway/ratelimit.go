@@ -0,0 +1,201 @@
+package gateway
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// limiterSweepInterval is the interval the idle client rate limiters are
+	// dropped at.
+	limiterSweepInterval = 1 * time.Minute
+)
+
+var (
+	ErrRateLimited    = errors.New("rate limited")
+	ErrLimitsNotValid = errors.New("limits not valid")
+)
+
+// Limits are the rate and concurrency limits of the requests.
+type Limits struct {
+	// ClientRate is the number of requests per second of each client, either
+	// the authenticated principal or the IP address. The requests are not
+	// rate limited when zero.
+	ClientRate float64 `json:"clientRate"`
+
+	// ClientBurst is the number of requests each client can send at once.
+	ClientBurst int `json:"clientBurst"`
+
+	// NodeMaxConcurrentRequests is the maximum number of requests in flight to
+	// each node. The requests are not limited when zero.
+	NodeMaxConcurrentRequests int `json:"nodeMaxConcurrentRequests"`
+}
+
+// Validate returns an error if the limits are not valid.
+func (l Limits) Validate() error {
+	if l.ClientRate < 0 || math.IsNaN(l.ClientRate) || math.IsInf(l.ClientRate, 0) {
+		return errors.Wrap(ErrLimitsNotValid, "client rate must be a non-negative number")
+	}
+	if l.ClientRate > 0 && l.ClientBurst < 1 {
+		return errors.Wrap(ErrLimitsNotValid, "client burst must be at least 1")
+	}
+	if l.NodeMaxConcurrentRequests < 0 {
+		return errors.Wrap(ErrLimitsNotValid, "node max concurrent requests must not be negative")
+	}
+
+	return nil
+}
+
+// limiter is the token bucket rate limiter of each client, which are created
+// on their first request, and dropped once they're full again.
+type limiter struct {
+	limits Limits
+
+	clients map[string]*rate.Limiter
+	sweptAt time.Time
+	mu      sync.Mutex
+}
+
+func newLimiter(limits Limits) *limiter {
+	return &limiter{limits: limits, clients: make(map[string]*rate.Limiter)}
+}
+
+// reserve reserves a request of the client as of now, and returns whether it's
+// allowed, or the delay after which it would be.
+func (l *limiter) reserve(client string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.sweptAt) > limiterSweepInterval {
+		// The full buckets are the same as new ones.
+		for id, c := range l.clients {
+			if c.TokensAt(now) >= float64(l.limits.ClientBurst) {
+				delete(l.clients, id)
+			}
+		}
+		l.sweptAt = now
+	}
+
+	c, ok := l.clients[client]
+	if !ok {
+		c = rate.NewLimiter(rate.Limit(l.limits.ClientRate), l.limits.ClientBurst)
+		l.clients[client] = c
+	}
+
+	r := c.ReserveN(now, 1)
+	if !r.OK() {
+		return time.Second, false
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay, false
+	}
+
+	return 0, true
+}
+
+// Limits returns the current limits of the requests.
+func (g *Gateway) Limits() Limits {
+	if l := g.limiter.Load(); l != nil {
+		return l.limits
+	}
+
+	return Limits{}
+}
+
+// SetLimits replaces the limits of the requests, at runtime. The rate limits of
+// the clients start over.
+func (g *Gateway) SetLimits(limits Limits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	g.limiter.Store(newLimiter(limits))
+	if nodePool := g.NodePool(); nodePool != nil {
+		nodePool.SetMaxConcurrentRequests(limits.NodeMaxConcurrentRequests)
+	}
+
+	return nil
+}
+
+// rateLimitMiddleware rate limits the requests of each client, by principal if
+// authenticated, or by IP address.
+func (g *Gateway) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := g.limiter.Load()
+		if l == nil || l.limits.ClientRate == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := requestClient(r)
+		if delay, ok := l.reserve(client, time.Now()); !ok {
+			err := errors.Wrapf(ErrRateLimited, "client %s", client)
+			setRequestError(r.Context(), err)
+
+			setRetryAfter(w, delay)
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(ErrRateLimited.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimitsHandler serves the current limits of the requests.
+func (g *Gateway) LimitsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(g.Limits())
+}
+
+// SetLimitsHandler replaces the limits of the requests, until the next reload.
+func (g *Gateway) SetLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	var limits Limits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(errors.Wrap(ErrLimitsNotValid, err.Error()).Error())
+		return
+	}
+	if err := g.SetLimits(limits); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	g.logger.WithField("limits", limits).Info("limits changed")
+
+	g.LimitsHandler(w, r)
+}
+
+// requestClient returns the ID of the client of the request: the principal if
+// authenticated, or the IP address.
+func requestClient(r *http.Request) string {
+	if info := getRequestInfo(r.Context()); info != nil {
+		if principal := info.getPrincipal(); principal != "" {
+			return "principal:" + principal
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// setRetryAfter sets the Retry-After header to the delay, in whole seconds.
+func setRetryAfter(w http.ResponseWriter, delay time.Duration) {
+	seconds := int(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
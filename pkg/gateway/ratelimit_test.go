@@ -0,0 +1,177 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gw, _ := newTestGateway(t, 1, WithLimits(Limits{ClientRate: 0.1, ClientBurst: 2}))
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/object/missing", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := get("192.0.2.1:1234"); rec.Code == http.StatusTooManyRequests {
+			t.Fatalf("got request %d rate limited within the burst", i)
+		}
+	}
+	rec := get("192.0.2.1:4321")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d above the burst, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("got Retry-After %q, want %q", got, "10")
+	}
+
+	// The clients are limited independently.
+	if rec := get("192.0.2.2:1234"); rec.Code == http.StatusTooManyRequests {
+		t.Error("got other client rate limited")
+	}
+
+	// The rate limits start over when the limits change.
+	if err := gw.SetLimits(Limits{ClientRate: 0.1, ClientBurst: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := get("192.0.2.1:1234"); rec.Code == http.StatusTooManyRequests {
+		t.Error("got client rate limited after the limits changed")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := newLimiter(Limits{ClientRate: 1, ClientBurst: 1})
+	now := time.Now()
+
+	if _, ok := l.reserve("a", now); !ok {
+		t.Fatal("got first request rate limited")
+	}
+	if delay, ok := l.reserve("a", now); ok || delay != time.Second {
+		t.Errorf("got allowed %t, delay %s, want delay %s", ok, delay, time.Second)
+	}
+
+	// The full buckets are dropped.
+	if _, ok := l.reserve("b", now.Add(2*limiterSweepInterval)); !ok {
+		t.Fatal("got request of other client rate limited")
+	}
+	if _, ok := l.clients["a"]; ok {
+		t.Error("got idle client limiter not dropped")
+	}
+}
+
+func TestNodeConcurrencyLimits(t *testing.T) {
+	gw, servers := newTestGateway(t, 1, WithAdminToken("secret"))
+	nodePool := gw.NodePool()
+
+	setLimits := func(body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/admin/limits", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", bearerPrefix+"secret")
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := setLimits(`{"clientRate": -1}`); code != http.StatusBadRequest {
+		t.Errorf("got status %d with limits not valid, want %d", code, http.StatusBadRequest)
+	}
+	if code := setLimits(`{"nodeMaxConcurrentRequests": 1}`); code != http.StatusOK {
+		t.Fatalf("got status %d setting limits, want %d", code, http.StatusOK)
+	}
+	if got := nodePool.MaxConcurrentRequests(); got != 1 {
+		t.Errorf("got node max concurrent requests %d, want 1", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/limits", nil)
+	req.Header.Set("Authorization", bearerPrefix+"secret")
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, req)
+	var got Limits
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got != (Limits{NodeMaxConcurrentRequests: 1}) {
+		t.Errorf("got limits %+v", got)
+	}
+
+	// The node serves a request already.
+	release, err := nodePool.AcquireNode(servers[0].Endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(method, "/object/foo", bytes.NewBufferString("hello")))
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("got %s status %d, Retry-After %q, want %d", method, rec.Code, rec.Header().Get("Retry-After"),
+				http.StatusTooManyRequests)
+		}
+	}
+	release()
+
+	rec = httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/foo", bytes.NewBufferString("hello")))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d once the node is released, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestNodeConcurrencyLimitsHalfOpenCircuit(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	server := miniotest.NewServer()
+	t.Cleanup(server.Close)
+
+	const cooldown = 200 * time.Millisecond
+	nodePool := nodepool.NewNodePool(
+		nodepool.WithNodeConfigs(nodepool.NewNodeConfig(server.Endpoint(), miniotest.AccessKey, miniotest.SecretKey)),
+		nodepool.WithLogger(logger),
+		nodepool.WithHealthCheckRetries(1),
+		nodepool.WithHealthCheckPeriod(0),
+		nodepool.WithMaxConcurrentRequests(1),
+		nodepool.WithCircuitBreaker(1, cooldown),
+	)
+	if err := nodePool.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nodePool.Close)
+	gw := NewGateway(WithLogger(logger), WithHTTPServer(&http.Server{}), WithNodePool(nodePool))
+
+	// The circuit is half-open, and the node serves a request already.
+	nodePool.ReportResult(server.Endpoint(), errors.New("connection refused"))
+	time.Sleep(cooldown)
+	release, err := nodePool.AcquireNode(server.Endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(method, "/object/foo", bytes.NewBufferString("hello")))
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("got %s status %d with node busy, want %d", method, rec.Code, http.StatusTooManyRequests)
+		}
+	}
+	release()
+
+	// The requests rejected as busy didn't take the trial request.
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/foo", bytes.NewBufferString("hello")))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d once the node is released, want %d", rec.Code, http.StatusOK)
+	}
+	if got := nodePool.NodeCircuitState(server.Endpoint()); got != nodepool.CircuitClosed {
+		t.Errorf("got circuit %s after the trial request, want %s", got, nodepool.CircuitClosed)
+	}
+}
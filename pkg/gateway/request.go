@@ -0,0 +1,234 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+
+	// maxRequestIDSize is the maximum size of the request IDs propagated from
+	// the clients. Longer request IDs are replaced.
+	maxRequestIDSize = 128
+)
+
+type requestInfoKey struct{}
+
+// requestInfo is what the handlers tell the middlewares about the request,
+// e.g. the node which served it.
+type requestInfo struct {
+	requestID string
+
+	// principal is the ID of the authenticated identity of the request.
+	principal string
+
+	// tenant is the tenant of the request, whose bucket stores the object.
+	tenant string
+
+	objectKey string
+	nodeID    string
+	err       error
+
+	mu sync.Mutex
+}
+
+// requestMiddleware assigns the request ID, and records the metrics and the
+// access log of the requests.
+func (g *Gateway) requestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		g.metrics.RequestStarted()
+
+		r, info := withRequestInfo(r)
+		w.Header().Set(requestIDHeader, info.requestID)
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		rw := newResponseWriter(w)
+
+		next.ServeHTTP(rw, r)
+
+		duration := time.Since(start)
+		_, nodeID, _ := info.get()
+		g.metrics.RequestFinished(r.Method, rw.status, nodeID, duration, body.bytes, rw.bytes)
+		g.logAccess(r, info, rw, body.bytes, duration)
+	})
+}
+
+// withRequestInfo returns the request with a new requestInfo in its context.
+// The request ID is propagated from the request header, if valid, or generated.
+func withRequestInfo(r *http.Request) (*http.Request, *requestInfo) {
+	info := &requestInfo{requestID: r.Header.Get(requestIDHeader)}
+	if !validRequestID(info.requestID) {
+		info.requestID = newRequestID()
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)), info
+}
+
+// getRequestInfo returns the requestInfo of the request context, or nil.
+func getRequestInfo(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+
+	return info
+}
+
+// setRequestObject records the object key and the node serving the request.
+func setRequestObject(ctx context.Context, objectKey, nodeID string) {
+	info := getRequestInfo(ctx)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	info.objectKey = objectKey
+	info.nodeID = nodeID
+}
+
+// setRequestError records the error the request failed with.
+func setRequestError(ctx context.Context, err error) {
+	info := getRequestInfo(ctx)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	info.err = err
+}
+
+// setRequestPrincipal records the authenticated identity of the request.
+func setRequestPrincipal(ctx context.Context, principal string) {
+	info := getRequestInfo(ctx)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	info.principal = principal
+}
+
+// setRequestTenant records the tenant of the request.
+func setRequestTenant(ctx context.Context, tenant string) {
+	info := getRequestInfo(ctx)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	info.tenant = tenant
+}
+
+// getRequestTenant returns the tenant of the request, or an empty string.
+func getRequestTenant(ctx context.Context) string {
+	info := getRequestInfo(ctx)
+	if info == nil {
+		return ""
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	return info.tenant
+}
+
+// getRequestID returns the ID of the request, or an empty string.
+func getRequestID(ctx context.Context) string {
+	info := getRequestInfo(ctx)
+	if info == nil {
+		return ""
+	}
+
+	return info.requestID
+}
+
+func (i *requestInfo) get() (objectKey, nodeID string, err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.objectKey, i.nodeID, i.err
+}
+
+func (i *requestInfo) getPrincipal() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.principal
+}
+
+// newRequestID returns a new random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// validRequestID returns whether the request ID propagated by a client is safe
+// to reuse, e.g. in logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDSize {
+		return false
+	}
+	for _, c := range id {
+		if c > unicode.MaxASCII || !unicode.IsPrint(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// responseWriter records the status code and the size of the response.
+type responseWriter struct {
+	http.ResponseWriter
+
+	status int
+	bytes  int64
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+
+	return n, err
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countingReader records the size of the request body.
+type countingReader struct {
+	io.ReadCloser
+
+	bytes int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.bytes += int64(n)
+
+	return n, err
+}
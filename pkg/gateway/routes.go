@@ -9,9 +9,14 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/minio/minio-go/v7"
+
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+	"github.com/maxgio92/homework-object-storage/pkg/cache"
+	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
 )
 
 var (
@@ -20,12 +25,25 @@ var (
 	ErrNodePoolEmpty     = errors.New("node pool empty")
 	ErrClientBuild       = errors.New("error building client")
 	ErrReadingBody       = errors.New("error reading body")
+	ErrNodeUnavailable   = errors.New("node unavailable")
 )
 
+// AddObjectRoutes adds the object routes, of the tenant of the principal, if
+// any, and of the tenants in the path, e.g. /t/{tenant}/object/{key}. The
+// objects are stored in the bucket of the tenant, or in the named bucket, e.g.
+// of /bucket/{bucket}/object/{key}.
 func (g *Gateway) AddObjectRoutes(r *mux.Router) {
-	objectRouter := r.PathPrefix("/object").Subrouter()
-	objectRouter.Methods(http.MethodGet).Path(fmt.Sprintf("/{key:%s}", objectKeyRegex)).HandlerFunc(g.GetObjectHandler)
-	objectRouter.Methods(http.MethodPut).Path(fmt.Sprintf("/{id:%s}", objectKeyRegex)).HandlerFunc(g.PutObjectHandler)
+	for _, prefix := range []string{
+		"/object",
+		fmt.Sprintf("/bucket/{bucket:%s}/object", bucketNameRegex),
+		fmt.Sprintf("/t/{tenant:%s}/object", tenantRegex),
+		fmt.Sprintf("/t/{tenant:%s}/bucket/{bucket:%s}/object", tenantRegex, bucketNameRegex),
+	} {
+		objectRouter := r.PathPrefix(prefix).Subrouter()
+		objectRouter.Use(g.authMiddleware, g.rateLimitMiddleware)
+		objectRouter.Methods(http.MethodGet).Path(fmt.Sprintf("/{key:%s}", objectKeyRegex)).HandlerFunc(g.GetObjectHandler)
+		objectRouter.Methods(http.MethodPut).Path(fmt.Sprintf("/{id:%s}", objectKeyRegex)).HandlerFunc(g.PutObjectHandler)
+	}
 }
 
 func (g *Gateway) HomeHandler(w http.ResponseWriter, r *http.Request) {
@@ -36,173 +54,478 @@ func (g *Gateway) GetObjectHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	objectKey := vars["key"]
-	if objectKey == "" {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrObjectKeyMissing.Error())
-		return
-	}
-	if len(objectKey) > maxObjectKeysize {
-		g.logger.Debug("requested object key is not valid")
+	setRequestObject(r.Context(), objectKey, "")
+	if err := g.validateObjectKey(r.Context(), objectKey); err != nil {
+		setRequestError(r.Context(), err)
 
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrObjectKeyNotValid.Error())
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrObjectKeyMissing) {
+			status = http.StatusInternalServerError
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(err.Error())
 		return
 	}
 
-	if g.nodePool == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
-		return
-	}
+	// The node pool is loaded once, so that the request completes against it
+	// even if it's swapped in the meantime.
+	nodePool := g.NodePool()
+	if nodePool == nil {
+		setRequestError(r.Context(), ErrNodePoolEmpty)
 
-	nodeID := g.nodePool.ObjectToNodeID(objectKey)
-	if nodeID == "" {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
 		return
 	}
 
-	client := g.nodePool.NodeClient(nodeID)
-
-	if client == nil {
-		g.logger.Debug("node client is nil")
-
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrClientBuild.Error())
-		return
+	// The objects owned by a peer gateway are cached by it, and read through it.
+	bucket := g.requestBucket(r)
+	res, forwarded := g.forwardObject(r.Context(), bucket, objectKey)
+	if !forwarded {
+		res = g.fetchObject(r.Context(), nodePool, bucket, objectKey)
 	}
-
-	bucket := defaultBucket
-	region := defaultRegion
-	if err := g.ensureBucket(r.Context(), client, bucket, region); err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(err.Error())
-		return
-	}
-
-	obj, err := client.GetObject(r.Context(), bucket, objectKey, minio.GetObjectOptions{})
+	content, nodeID, err := res.content, res.nodeID, res.err
+	setRequestObject(r.Context(), objectKey, nodeID)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(err.Error())
-		return
-	}
-	defer obj.Close()
+		setRequestError(r.Context(), err)
 
-	content, err := io.ReadAll(obj)
-	if err != nil {
-		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(err.Error())
-			return
+		status := errorStatusCode(err)
+		if status == http.StatusTooManyRequests {
+			setRetryAfter(w, time.Second)
 		}
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(err.Error())
 		return
 	}
+
 	g.logger.
 		WithField("operation", http.MethodGet).
 		WithField("object key", objectKey).
 		WithField("node id", nodeID).
-		Info("request")
+		Debug("request")
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(content)
 }
 
+// fetchObject returns the object in the bucket, served from the cache if
+// fresh, or read from the nodes otherwise.
+func (g *Gateway) fetchObject(ctx context.Context, nodePool *nodepool.NodePool, bucket, objectKey string) objectRead {
+	nodeIDs := g.lookupNodes(ctx, objectKey, nodePool.ObjectToReadNodeIDs)
+	if len(nodeIDs) == 0 {
+		return objectRead{err: ErrNodePoolEmpty}
+	}
+
+	// The fresh cached objects are served without reading them from the nodes.
+	cacheKey := objectCacheKey(bucket, objectKey)
+	cached, fresh, ok := g.cache.Get(cacheKey)
+	if ok && fresh {
+		g.metrics.CacheLookup(cacheTierMemory, cacheHit)
+		g.logger.
+			WithField("operation", http.MethodGet).
+			WithField("object key", objectKey).
+			Debug("request served from cache")
+
+		return objectRead{content: cached.Content, etag: cached.ETag}
+	}
+
+	// The concurrent reads of the object share a single read from the nodes.
+	// The read is retried, if the one shared is cancelled with its request.
+	// The objects not cached in memory are read if modified since they're
+	// cached on disk. The objects read are not cached, if put meanwhile.
+	base, onDisk := cached, false
+	read := func() objectRead {
+		if !ok {
+			base, onDisk = g.diskCached(cacheKey)
+		}
+		return g.readObject(ctx, nodePool, nodeIDs, bucket, objectKey, base)
+	}
+	store := func(res objectRead) {
+		g.cacheObject(cacheKey, cached, ok, res.etag, res.content, res.err)
+		g.diskCacheObject(cacheKey, base, !ok, onDisk, res)
+	}
+	res, shared := g.reads.do(ctx, cacheKey, read, store)
+	if shared && contextError(res.err) && ctx.Err() == nil {
+		res, _ = g.reads.do(ctx, cacheKey, read, store)
+	}
+
+	return res
+}
+
+// readObject reads the object from the first node which serves it, falling
+// back to the replicas. The stale cached object is read if it's modified only.
+func (g *Gateway) readObject(ctx context.Context, nodePool *nodepool.NodePool, nodeIDs []string, bucket, key string,
+	cached cache.Entry) objectRead {
+	var res objectRead
+	for _, res.nodeID = range nodeIDs {
+		// The node is acquired before its circuit is checked, so that a busy
+		// node doesn't take the trial request of a half-open circuit.
+		release, err := nodePool.AcquireNode(res.nodeID)
+		if err != nil {
+			res.err = err
+			continue
+		}
+		if !nodePool.NodeAvailable(res.nodeID) {
+			release()
+			res.err = ErrNodeUnavailable
+			continue
+		}
+		res.content, res.etag, res.err = g.getObject(ctx, nodePool, res.nodeID, bucket, key, cached.ETag)
+		release()
+		if notModified(res.err) {
+			res.content, res.etag, res.err = cached.Content, cached.ETag, nil
+		}
+		nodePool.ReportResult(res.nodeID, nodeError(res.err))
+		if res.err == nil {
+			break
+		}
+		g.logger.WithError(res.err).Debugf("error getting object from node %s", res.nodeID)
+	}
+
+	return res
+}
+
 func (g *Gateway) PutObjectHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
+	// The body is limited while it's read, as its length may be unknown.
+	if g.maxObjectSize > 0 {
+		if r.ContentLength > g.maxObjectSize {
+			err := errors.Wrapf(ErrObjectTooLarge, "content length %d exceeds %d bytes", r.ContentLength, g.maxObjectSize)
+			setRequestError(r.Context(), err)
+
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(ErrObjectTooLarge.Error())
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, g.maxObjectSize)
+	}
+
+	_, span := g.startSpan(r.Context(), "readBody")
 	buf := &bytes.Buffer{}
-	nRead, err := io.Copy(buf, r.Body)
+	_, err := io.Copy(buf, r.Body)
+	endSpan(span, err)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(ErrReadingBody.Error())
+		setRequestError(r.Context(), errors.Wrap(ErrReadingBody, err.Error()))
+
+		var maxBytesErr *http.MaxBytesError
+		status, message := http.StatusNotFound, ErrReadingBody.Error()
+		switch {
+		case errors.Is(err, auth.ErrContentHashMismatch):
+			status = http.StatusBadRequest
+		case errors.Is(err, auth.ErrContentTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.As(err, &maxBytesErr):
+			status, message = http.StatusRequestEntityTooLarge, ErrObjectTooLarge.Error()
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(message)
 		return
 	}
 
 	objectKey := vars["id"]
-	if objectKey == "" {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(ErrObjectKeyMissing.Error())
-		return
-	}
-	if len(objectKey) > maxObjectKeysize {
-		g.logger.Debug("requested object key is not valid")
+	setRequestObject(r.Context(), objectKey, "")
+	if err := g.validateObjectKey(r.Context(), objectKey); err != nil {
+		setRequestError(r.Context(), err)
 
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrObjectKeyNotValid.Error())
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrObjectKeyMissing) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(err.Error())
 		return
 	}
 
-	if g.nodePool == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
-		return
-	}
+	// The node pool is loaded once, so that the request completes against it
+	// even if it's swapped in the meantime.
+	nodePool := g.NodePool()
+	if nodePool == nil {
+		setRequestError(r.Context(), ErrNodePoolEmpty)
 
-	nodeID := g.nodePool.ObjectToNodeID(objectKey)
-	if nodeID == "" {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
 		return
 	}
-	if nodeID == "" {
+
+	nodeIDs := g.lookupNodes(r.Context(), objectKey, nodePool.ObjectToNodeIDs)
+	if len(nodeIDs) == 0 {
 		g.logger.Debug("node id is empty")
+		setRequestError(r.Context(), ErrNodePoolEmpty)
 
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(ErrNodePoolEmpty.Error())
 		return
 	}
 
-	client := g.nodePool.NodeClient(nodeID)
-	if client == nil {
-		g.logger.Debug("node client is nil")
+	// Write to the node closest to the key, and to its replicas.
+	setRequestObject(r.Context(), objectKey, nodeIDs[0])
 
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrClientBuild.Error())
+	// The quotas of the tenant apply to the objects in its bucket and in its
+	// named buckets.
+	bucket := g.requestBucket(r)
+	cancelQuota, err := g.reserveQuota(r.Context(), nodePool, nodeIDs, getRequestTenant(r.Context()), bucket, objectKey,
+		int64(buf.Len()))
+	if err != nil {
+		setRequestError(r.Context(), err)
+
+		w.WriteHeader(http.StatusInsufficientStorage)
+		json.NewEncoder(w).Encode(err.Error())
 		return
 	}
+	// The reservation is kept once the object is stored by the primary node.
+	stored := false
+	defer func() {
+		if !stored {
+			cancelQuota()
+		}
+	}()
+	// The cached object is stale once it's put, even if on some nodes only.
+	// The peer owning it removes it in the background.
+	defer g.uncacheObject(objectCacheKey(bucket, objectKey))
+	defer g.uncachePeerObject(r.Context(), bucket, objectKey)
+
+	// The object is stored by the primary node, and then copied to the replicas
+	// on a best-effort basis: the request doesn't fail once the primary node
+	// stored the object, and the replicas which fail miss it.
+	nodeID := nodeIDs[0]
+	release, err := nodePool.AcquireNode(nodeID)
+	if err != nil {
+		setRequestError(r.Context(), err)
 
-	bucket := defaultBucket
-	region := defaultRegion
-	if err = g.ensureBucket(r.Context(), client, bucket, region); err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(err.Error())
+		setRetryAfter(w, time.Second)
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(nodepool.ErrNodeBusy.Error())
 		return
 	}
+	if !nodePool.NodeAvailable(nodeID) {
+		release()
+		setRequestError(r.Context(), ErrNodeUnavailable)
 
-	upload, err := client.PutObject(r.Context(), bucket, objectKey, buf, nRead,
-		minio.PutObjectOptions{ContentType: "application/octet-stream"},
-	)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrNodeUnavailable.Error())
+		return
+	}
+	upload, err := g.putObject(r.Context(), nodePool, nodeID, bucket, objectKey, buf.Bytes())
+	release()
+	nodePool.ReportResult(nodeID, nodeError(err))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		g.logger.WithError(err).Debugf("error putting object to node %s", nodeID)
+		setRequestError(r.Context(), err)
+
+		status := http.StatusInternalServerError
+		if errors.Is(err, nodepool.ErrBucketNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(err.Error())
 		return
 	}
+	stored = true
+	for _, replicaID := range nodeIDs[1:] {
+		g.putReplica(r.Context(), nodePool, replicaID, bucket, objectKey, buf.Bytes())
+	}
 
 	g.logger.
 		WithField("operation", http.MethodPut).
 		WithField("object key", upload.Key).
-		WithField("node id", nodeID).
-		Info("request")
+		WithField("node id", nodeIDs[0]).
+		Debug("request")
 
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set(http.CanonicalHeaderKey("Content-Length"), strconv.FormatInt(upload.Size, 10))
 	json.NewEncoder(w).Encode(upload)
 }
 
-func (g *Gateway) ensureBucket(ctx context.Context, client *minio.Client, name, region string) error {
-	exists, err := client.BucketExists(ctx, name)
+// putReplica copies the object in the bucket to the replica node. The failures
+// are logged only, as the object is stored by the primary node anyway.
+func (g *Gateway) putReplica(ctx context.Context, nodePool *nodepool.NodePool, nodeID, bucket, key string,
+	content []byte) {
+	release, err := nodePool.AcquireNode(nodeID)
+	if err == nil {
+		if nodePool.NodeAvailable(nodeID) {
+			_, err = g.putObject(ctx, nodePool, nodeID, bucket, key, content)
+			nodePool.ReportResult(nodeID, nodeError(err))
+		} else {
+			err = ErrNodeUnavailable
+		}
+		release()
+	}
 	if err != nil {
-		return err
+		g.logger.WithError(err).Warnf("error putting object %s to replica node %s", key, nodeID)
 	}
+}
 
-	if !exists {
-		err = client.MakeBucket(context.Background(), name, minio.MakeBucketOptions{Region: region})
-		if err != nil {
-			return err
+// validateObjectKey returns an error if the object key is not valid.
+func (g *Gateway) validateObjectKey(ctx context.Context, key string) (err error) {
+	_, span := g.startSpan(ctx, "validateObjectKey", attributeObjectKey.String(key))
+	defer func() { endSpan(span, err) }()
+
+	if key == "" {
+		return ErrObjectKeyMissing
+	}
+	if len(key) > maxObjectKeysize {
+		g.logger.Debug("requested object key is not valid")
+		return ErrObjectKeyNotValid
+	}
+
+	return nil
+}
+
+// lookupNodes returns the IDs of the nodes to read or write the object, the primary first.
+func (g *Gateway) lookupNodes(ctx context.Context, key string, lookup func(key string) []string) []string {
+	_, span := g.startSpan(ctx, "ring.lookup", attributeObjectKey.String(key))
+	defer span.End()
+
+	nodeIDs := lookup(key)
+	if len(nodeIDs) > 0 {
+		span.SetAttributes(attributeNodeID.String(nodeIDs[0]))
+	}
+
+	return nodeIDs
+}
+
+// getObject returns the content of the object in the bucket from the node, and
+// its ETag. If the ETag of a cached content is given, the object is returned
+// only if it's modified, and the error is not modified otherwise.
+func (g *Gateway) getObject(ctx context.Context, nodePool *nodepool.NodePool, nodeID, bucket, key,
+	cachedETag string) (content []byte, etag string, err error) {
+	ctx, span := g.startSpan(ctx, "getObject", attributeNodeID.String(nodeID), attributeObjectKey.String(key))
+	defer func() { endSpan(span, err) }()
+
+	client := nodePool.NodeClient(nodeID)
+	if client == nil {
+		g.logger.Debug("node client is nil")
+		return nil, "", ErrClientBuild
+	}
+
+	ctx, minioSpan := g.startSpan(ctx, "minio.GetObject", attributeNodeID.String(nodeID), attributeObjectKey.String(key))
+	defer func() { endSpan(minioSpan, nodeError(err)) }()
+
+	opts := minio.GetObjectOptions{}
+	if cachedETag != "" {
+		if err = opts.SetMatchETagExcept(cachedETag); err != nil {
+			return nil, "", err
+		}
+	}
+	// The bucket is not checked, as the object is not found without it.
+	obj, err := client.GetObject(ctx, bucket, key, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	defer obj.Close()
+
+	content, err = io.ReadAll(obj)
+	if noSuchBucket(err) {
+		nodePool.ForgetBucket(nodeID, bucket)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return content, info.ETag, nil
+}
+
+// putObject stores the object with the content in the bucket on the node.
+func (g *Gateway) putObject(ctx context.Context, nodePool *nodepool.NodePool, nodeID, bucket, key string,
+	content []byte) (info minio.UploadInfo, err error) {
+	ctx, span := g.startSpan(ctx, "putObject", attributeNodeID.String(nodeID), attributeObjectKey.String(key))
+	defer func() { endSpan(span, err) }()
+
+	client := nodePool.NodeClient(nodeID)
+	if client == nil {
+		g.logger.Debug("node client is nil")
+		return minio.UploadInfo{}, ErrClientBuild
+	}
+
+	// The bucket is checked again once, if it's been removed from the node
+	// since it's been checked, e.g. as the node lost its data.
+	for retry := true; ; retry = false {
+		if err = g.ensureBucket(ctx, nodePool, nodeID, bucket); err != nil {
+			return minio.UploadInfo{}, err
+		}
+
+		info, err = g.putNodeObject(ctx, client, nodeID, bucket, key, content)
+		if !noSuchBucket(err) || !retry {
+			return info, err
 		}
+		nodePool.ForgetBucket(nodeID, bucket)
+	}
+}
+
+func (g *Gateway) putNodeObject(ctx context.Context, client *minio.Client, nodeID, bucket, key string,
+	content []byte) (info minio.UploadInfo, err error) {
+	ctx, minioSpan := g.startSpan(ctx, "minio.PutObject", attributeNodeID.String(nodeID), attributeObjectKey.String(key))
+	defer func() { endSpan(minioSpan, err) }()
+
+	return client.PutObject(ctx, bucket, key, bytes.NewReader(content), int64(len(content)),
+		minio.PutObjectOptions{ContentType: "application/octet-stream"},
+	)
+}
+
+// ensureBucket creates the bucket of the tenant on the node, if missing. The
+// named buckets are created with the bucket API only. The buckets known to
+// exist on the node are not checked again.
+func (g *Gateway) ensureBucket(ctx context.Context, nodePool *nodepool.NodePool, nodeID, name string) (err error) {
+	ctx, span := g.startSpan(ctx, "ensureBucket", attributeBucket.String(name))
+	defer func() { endSpan(span, err) }()
+
+	_, bucketName, _ := g.parseBucket(name)
+	if bucketName == "" {
+		return nodePool.EnsureBucket(ctx, nodeID, name, g.region)
+	}
+
+	exists, err := nodePool.BucketExists(ctx, nodeID, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.Wrapf(nodepool.ErrBucketNotFound, "bucket %s", bucketName)
 	}
 
 	return nil
 }
+
+// noSuchBucket returns whether the error is due to the bucket missing on the node.
+func noSuchBucket(err error) bool {
+	return err != nil && minio.ToErrorResponse(err).Code == "NoSuchBucket"
+}
+
+// errorStatusCode returns the HTTP status code of the error returned by a MinIO node.
+func errorStatusCode(err error) int {
+	if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, nodepool.ErrBucketNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, ErrNodeUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, nodepool.ErrNodeBusy) {
+		return http.StatusTooManyRequests
+	}
+
+	return http.StatusInternalServerError
+}
+
+// contextError returns whether the error is due to a context cancelled or
+// past its deadline.
+func contextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// nodeError returns the error if it's due to the node, to be reported to its
+// circuit breaker, and nil otherwise, e.g. when the object is not found.
+func nodeError(err error) error {
+	if err == nil || minio.ToErrorResponse(err).StatusCode == http.StatusNotFound ||
+		errors.Is(err, nodepool.ErrBucketNotFound) || notModified(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,202 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+	"github.com/maxgio92/homework-object-storage/pkg/nodepool"
+)
+
+// newTestGateway returns a gateway in front of a node pool of fake MinIO servers.
+func newTestGateway(t *testing.T, nodes int, opts ...Option) (*Gateway, []*miniotest.Server) {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	servers := make([]*miniotest.Server, nodes)
+	configs := make([]*nodepool.NodeConfig, nodes)
+	for i := range servers {
+		servers[i] = miniotest.NewServer()
+		t.Cleanup(servers[i].Close)
+		configs[i] = nodepool.NewNodeConfig(servers[i].Endpoint(), miniotest.AccessKey, miniotest.SecretKey)
+	}
+
+	nodePool := nodepool.NewNodePool(
+		nodepool.WithNodeConfigs(configs...),
+		nodepool.WithLogger(logger),
+		nodepool.WithHealthCheckRetries(1),
+	)
+	if err := nodePool.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nodePool.Close)
+
+	opts = append([]Option{WithLogger(logger), WithHTTPServer(&http.Server{}), WithNodePool(nodePool)}, opts...)
+
+	return NewGateway(opts...), servers
+}
+
+func TestObjectHandlers(t *testing.T) {
+	gw, servers := newTestGateway(t, 3)
+
+	content := []byte("hello world")
+
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/hello", bytes.NewReader(content)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got put status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var stored int
+	for _, s := range servers {
+		if obj, ok := s.Object(defaultBucket, "hello"); ok {
+			stored++
+			if !bytes.Equal(obj.Data, content) {
+				t.Errorf("got stored content %q, want %q", obj.Data, content)
+			}
+		}
+	}
+	if stored != 1 {
+		t.Errorf("got object stored on %d nodes, want 1", stored)
+	}
+
+	testCases := []struct {
+		name       string
+		key        string
+		wantStatus int
+		want       []byte
+	}{
+		{name: "with object", key: "hello", wantStatus: http.StatusOK, want: content},
+		{name: "with object not found", key: "missing", wantStatus: http.StatusNotFound},
+		{name: "with key not valid", key: "0123456789abcdef0123456789abcdef0", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/object/"+tt.key, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.want == nil {
+				return
+			}
+
+			var got []byte
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectHandlersBucketChecks(t *testing.T) {
+	gw, servers := newTestGateway(t, 1)
+	srv := servers[0]
+
+	serve := func(method, path, body string) int {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return rec.Code
+	}
+	checks := func() int {
+		return srv.Calls(miniotest.OpBucketExists) + srv.Calls(miniotest.OpMakeBucket)
+	}
+
+	if code := serve(http.MethodPut, "/object/foo", "hello"); code != http.StatusOK {
+		t.Fatalf("got put status %d, want %d", code, http.StatusOK)
+	}
+	calls := checks()
+	for i := 0; i < 3; i++ {
+		serve(http.MethodPut, "/object/foo", "hello")
+		serve(http.MethodGet, "/object/foo", "")
+	}
+	if got := checks() - calls; got != 0 {
+		t.Errorf("got %d bucket checks of bucket existing, want none", got)
+	}
+
+	// The bucket is created again, if the node loses it.
+	client := gw.NodePool().NodeClient(srv.Endpoint())
+	if err := client.RemoveObject(context.Background(), defaultBucket, "foo", minio.RemoveObjectOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveBucket(context.Background(), defaultBucket); err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(http.MethodPut, "/object/foo", "hello"); code != http.StatusOK {
+		t.Errorf("got put status %d after bucket lost, want %d", code, http.StatusOK)
+	}
+	if !srv.BucketExists(defaultBucket) {
+		t.Error("got bucket lost not created again")
+	}
+}
+
+func TestPutObjectReplicas(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	servers := make(map[string]*miniotest.Server)
+	configs := make([]*nodepool.NodeConfig, 2)
+	for i := range configs {
+		srv := miniotest.NewServer()
+		t.Cleanup(srv.Close)
+		servers[srv.Endpoint()] = srv
+		configs[i] = nodepool.NewNodeConfig(srv.Endpoint(), miniotest.AccessKey, miniotest.SecretKey)
+	}
+	nodePool := nodepool.NewNodePool(
+		nodepool.WithNodeConfigs(configs...),
+		nodepool.WithLogger(logger),
+		nodepool.WithHealthCheckRetries(1),
+		nodepool.WithReplicationFactor(2),
+	)
+	if err := nodePool.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nodePool.Close)
+	gw := NewGateway(WithLogger(logger), WithHTTPServer(&http.Server{}), WithNodePool(nodePool))
+
+	put := func(key string) int {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/object/"+key, bytes.NewReader([]byte("hello"))))
+		return rec.Code
+	}
+
+	if code := put("foo"); code != http.StatusOK {
+		t.Fatalf("got put status %d, want %d", code, http.StatusOK)
+	}
+	for id, srv := range servers {
+		if _, ok := srv.Object(defaultBucket, "foo"); !ok {
+			t.Errorf("got object missing on node %s, want it replicated", id)
+		}
+	}
+
+	// The replicas are written on a best-effort basis, once the primary node
+	// stored the object.
+	nodeIDs := nodePool.ObjectToNodeIDs("bar")
+	for i := 0; i < 5; i++ {
+		nodePool.ReportResult(nodeIDs[1], errors.New("node failed"))
+	}
+	if code := put("bar"); code != http.StatusOK {
+		t.Errorf("got put status %d with a replica failing, want %d", code, http.StatusOK)
+	}
+	if _, ok := servers[nodeIDs[0]].Object(defaultBucket, "bar"); !ok {
+		t.Error("got object missing on the primary node")
+	}
+	if _, ok := servers[nodeIDs[1]].Object(defaultBucket, "bar"); ok {
+		t.Error("got object on the failing replica")
+	}
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+)
+
+const (
+	// maxBucketNameSize is the maximum size of the S3 bucket names.
+	maxBucketNameSize = 63
+)
+
+var (
+	ErrTenantNotValid = errors.New("tenant not valid")
+)
+
+var tenantPattern = regexp.MustCompile("^" + tenantRegex + "$")
+
+// tenantBucket returns the bucket of the objects of the tenant, on every node:
+// the gateway bucket suffixed with the tenant, or the gateway bucket itself
+// without tenant.
+func (g *Gateway) tenantBucket(tenant string) string {
+	if tenant == "" {
+		return g.bucket
+	}
+
+	return g.bucket + "-" + tenant
+}
+
+// ownsBucket returns whether the bucket stores the objects of any tenant,
+// either in its bucket or in a named one.
+func (g *Gateway) ownsBucket(bucket string) bool {
+	_, _, ok := g.parseBucket(bucket)
+
+	return ok
+}
+
+// parseBucket returns the tenant and the name of the bucket, either empty, and
+// whether the bucket is one of the gateway.
+func (g *Gateway) parseBucket(bucket string) (tenant, name string, ok bool) {
+	rest, ok := strings.CutPrefix(bucket, g.bucket)
+	if !ok {
+		return "", "", false
+	}
+	rest, name, named := strings.Cut(rest, ".")
+	if named && !bucketNamePattern.MatchString(name) {
+		return "", "", false
+	}
+	if rest == "" {
+		return "", name, true
+	}
+	tenant, ok = strings.CutPrefix(rest, "-")
+	if !ok || !tenantPattern.MatchString(tenant) {
+		return "", "", false
+	}
+
+	return tenant, name, true
+}
+
+// validateTenant returns an error if the tenant is not valid, e.g. if the name
+// of its bucket would be too long.
+func (g *Gateway) validateTenant(tenant string) error {
+	if tenant == "" {
+		return nil
+	}
+	if !tenantPattern.MatchString(tenant) || len(g.tenantBucket(tenant)) > maxBucketNameSize {
+		return errors.Wrapf(ErrTenantNotValid, "tenant %q", tenant)
+	}
+
+	return nil
+}
+
+// resolveTenant returns the tenant of the request, either the one of the
+// principal, if any, or the one of the path. The principals of a tenant are
+// forbidden the paths of the others.
+func resolveTenant(principal *auth.Principal, pathTenant string) (string, error) {
+	if principal == nil || principal.Tenant == "" {
+		return pathTenant, nil
+	}
+	if pathTenant != "" && pathTenant != principal.Tenant {
+		return "", errors.Wrapf(auth.ErrForbidden, "%s of tenant %s, not %s", principal.ID, principal.Tenant, pathTenant)
+	}
+
+	return principal.Tenant, nil
+}
+
+// requestBucket returns the bucket of the request, either the named one in its
+// path or the one of its tenant.
+func (g *Gateway) requestBucket(r *http.Request) string {
+	bucket := g.tenantBucket(getRequestTenant(r.Context()))
+	if name := mux.Vars(r)["bucket"]; name != "" {
+		bucket += "." + name
+	}
+
+	return bucket
+}
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maxgio92/homework-object-storage/pkg/auth"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	readWrite := auth.Policy{Actions: []auth.Action{auth.ActionRead, auth.ActionWrite}}
+	acme := auth.Key{ID: "acme", Secret: "acme-secret", Tenant: "acme", Policy: readWrite}
+	globex := auth.Key{ID: "globex", Secret: "globex-secret", Tenant: "globex", Policy: readWrite}
+	admin := auth.Key{ID: "admin", Secret: "admin-secret", Policy: readWrite}
+
+	gw, servers := newTestGateway(t, 2,
+		WithAuthenticator(auth.NewAuthenticator(auth.WithKeys(acme, globex, admin))))
+
+	serve := func(method, path, secret, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(auth.APIKeyHeader, secret)
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(http.MethodPut, "/object/foo", acme.Secret, "acme data"); rec.Code != http.StatusOK {
+		t.Fatalf("got put status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	testCases := []struct {
+		name       string
+		path       string
+		secret     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "with tenant of the principal", path: "/object/foo", secret: acme.Secret,
+			wantStatus: http.StatusOK, wantBody: "acme data"},
+		{name: "with path of the tenant of the principal", path: "/t/acme/object/foo", secret: acme.Secret,
+			wantStatus: http.StatusOK, wantBody: "acme data"},
+		{name: "with other tenant", path: "/object/foo", secret: globex.Secret, wantStatus: http.StatusNotFound},
+		{name: "with path of other tenant", path: "/t/acme/object/foo", secret: globex.Secret,
+			wantStatus: http.StatusForbidden},
+		{name: "with path of tenant without tenant", path: "/t/acme/object/foo", secret: admin.Secret,
+			wantStatus: http.StatusOK, wantBody: "acme data"},
+		{name: "without tenant", path: "/object/foo", secret: admin.Secret, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(http.MethodGet, tt.path, tt.secret, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			var got []byte
+			json.NewDecoder(rec.Body).Decode(&got)
+			if string(got) != tt.wantBody {
+				t.Errorf("got body %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+
+	// The objects of the tenant are stored in its bucket, on every node it's put to.
+	for _, srv := range servers {
+		if _, ok := srv.Object(defaultBucket, "foo"); ok {
+			t.Errorf("got object of tenant in the bucket %s of node %s", defaultBucket, srv.Endpoint())
+		}
+	}
+	var stored bool
+	for _, srv := range servers {
+		_, ok := srv.Object(defaultBucket+"-acme", "foo")
+		stored = stored || ok
+	}
+	if !stored {
+		t.Errorf("got object not stored in the bucket %s-acme", defaultBucket)
+	}
+}
+
+func TestTenantPaths(t *testing.T) {
+	gw, _ := newTestGateway(t, 1)
+
+	serve := func(method, path, body string) int {
+		rec := httptest.NewRecorder()
+		gw.r.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec.Code
+	}
+
+	// The tenants are namespaces, also without authentication.
+	if code := serve(http.MethodPut, "/t/acme/object/foo", "hello"); code != http.StatusOK {
+		t.Fatalf("got put status %d, want %d", code, http.StatusOK)
+	}
+	if code := serve(http.MethodGet, "/t/globex/object/foo", ""); code != http.StatusNotFound {
+		t.Errorf("got status %d of other tenant, want %d", code, http.StatusNotFound)
+	}
+	if code := serve(http.MethodGet, "/object/foo", ""); code != http.StatusNotFound {
+		t.Errorf("got status %d without tenant, want %d", code, http.StatusNotFound)
+	}
+	if code := serve(http.MethodGet, "/t/"+strings.Repeat("a", 60)+"/object/foo", ""); code != http.StatusBadRequest {
+		t.Errorf("got status %d with tenant bucket name too long, want %d", code, http.StatusBadRequest)
+	}
+	if code := serve(http.MethodGet, "/t/Acme/object/foo", ""); code != http.StatusNotFound {
+		t.Errorf("got status %d with tenant not valid, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestOwnsBucket(t *testing.T) {
+	gw := NewGateway(WithHTTPServer(&http.Server{}))
+
+	testCases := []struct {
+		bucket string
+		want   bool
+	}{
+		{bucket: defaultBucket, want: true},
+		{bucket: defaultBucket + "-acme", want: true},
+		{bucket: defaultBucket + "-", want: false},
+		{bucket: defaultBucket + "-acme.backup", want: true},
+		{bucket: defaultBucket + ".photos", want: true},
+		{bucket: defaultBucket + ".", want: false},
+		{bucket: defaultBucket + "-acme.Backup", want: false},
+		{bucket: defaultBucket + "backup", want: false},
+		{bucket: "other", want: false},
+	}
+
+	for _, tt := range testCases {
+		if got := gw.ownsBucket(tt.bucket); got != tt.want {
+			t.Errorf("got owns bucket %s %t, want %t", tt.bucket, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	gw, _ := newTestGateway(t, 1, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+
+	req := httptest.NewRequest(http.MethodPut, "/object/hello", bytes.NewReader([]byte("hello world")))
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+	rec := httptest.NewRecorder()
+	gw.r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		if got := span.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("got span %s trace id %s, want %s", span.Name(), got, traceID)
+		}
+	}
+
+	for _, name := range []string{
+		"PUT /object/{id:[0-9a-z]+}", "readBody", "validateObjectKey", "ring.lookup",
+		"putObject", "ensureBucket", "minio.PutObject",
+	} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("got no span %s, want it", name)
+		}
+	}
+
+	server := spans["PUT /object/{id:[0-9a-z]+}"]
+	if server == nil {
+		t.FailNow()
+	}
+	if got := server.Parent().SpanID().String(); got != parentSpanID {
+		t.Errorf("got server span parent %s, want %s", got, parentSpanID)
+	}
+	if got := spans["minio.PutObject"].Parent().SpanID(); got != spans["putObject"].SpanContext().SpanID() {
+		t.Errorf("got minio.PutObject parent %s, want putObject span", got)
+	}
+}
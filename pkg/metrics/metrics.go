@@ -0,0 +1,288 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "object_storage_gateway"
+
+	subsystemHTTP     = "http"
+	subsystemNodePool = "nodepool"
+	subsystemCache    = "cache"
+	subsystemPeers    = "peers"
+
+	labelMethod = "method"
+	labelStatus = "status"
+	labelNode   = "node"
+	labelResult = "result"
+	labelTier   = "tier"
+)
+
+// Metrics are the Prometheus metrics of the gateway and its node pool.
+// All the methods are safe to call on a nil Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+	receivedBytes    *prometheus.CounterVec
+	sentBytes        *prometheus.CounterVec
+
+	nodeHealthy      *prometheus.GaugeVec
+	nodeCircuitState *prometheus.GaugeVec
+	ringNodes        prometheus.Gauge
+	ringKeyShare     *prometheus.GaugeVec
+
+	cacheLookups *prometheus.CounterVec
+	cacheEntries *prometheus.GaugeVec
+	cacheBytes   *prometheus.GaugeVec
+
+	peers     prometheus.Gauge
+	peerReads *prometheus.CounterVec
+}
+
+type Option func(m *Metrics)
+
+// WithRegistry sets the registry the metrics are registered to.
+// It defaults to a new registry, with the Go runtime and process collectors.
+func WithRegistry(registry *prometheus.Registry) Option {
+	return func(m *Metrics) {
+		m.registry = registry
+	}
+}
+
+// New returns new Metrics, registered to the registry.
+func New(opts ...Option) *Metrics {
+	m := new(Metrics)
+
+	for _, f := range opts {
+		f(m)
+	}
+
+	if m.registry == nil {
+		m.registry = prometheus.NewRegistry()
+		m.registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+
+	m.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystemHTTP,
+		Name:      "requests_total",
+		Help:      "The number of HTTP requests served, by method, status code and node.",
+	}, []string{labelMethod, labelStatus, labelNode})
+	m.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystemHTTP,
+		Name:      "request_duration_seconds",
+		Help:      "The latency of the HTTP requests, by method, status code and node.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{labelMethod, labelStatus, labelNode})
+	m.requestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystemHTTP,
+		Name:      "requests_in_flight",
+		Help:      "The number of HTTP requests being served.",
+	})
+	m.receivedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystemHTTP,
+		Name:      "received_bytes_total",
+		Help:      "The number of bytes of the HTTP request bodies, by method and node.",
+	}, []string{labelMethod, labelNode})
+	m.sentBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystemHTTP,
+		Name:      "sent_bytes_total",
+		Help:      "The number of bytes of the HTTP response bodies, by method and node.",
+	}, []string{labelMethod, labelNode})
+
+	m.nodeHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystemNodePool,
+		Name:      "node_healthy",
+		Help:      "Whether the node passed the last health check.",
+	}, []string{labelNode})
+	m.nodeCircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystemNodePool,
+		Name:      "node_circuit_state",
+		Help:      "The state of the node circuit breaker: 0 closed, 1 half-open, 2 open.",
+	}, []string{labelNode})
+	m.ringNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystemNodePool,
+		Name:      "ring_nodes",
+		Help:      "The number of nodes in the consistent hashing ring.",
+	})
+	m.ringKeyShare = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystemNodePool,
+		Name:      "ring_key_share_ratio",
+		Help:      "The estimated share of the key space each node is the primary of.",
+	}, []string{labelNode})
+
+	m.cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystemCache,
+		Name:      "lookups_total",
+		Help:      "The number of objects read looked up in the cache, by tier and result: hit, miss or revalidated.",
+	}, []string{labelTier, labelResult})
+	m.cacheEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystemCache,
+		Name:      "entries",
+		Help:      "The number of objects in the cache, by tier.",
+	}, []string{labelTier})
+	m.cacheBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystemCache,
+		Name:      "bytes",
+		Help:      "The size of the objects in the cache, by tier.",
+	}, []string{labelTier})
+	m.peers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystemPeers,
+		Name:      "members",
+		Help:      "The number of peer gateways in the ring, including the gateway itself.",
+	})
+	m.peerReads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystemPeers,
+		Name:      "reads_total",
+		Help:      "The number of objects read forwarded to the peers owning them, by result: forwarded or fallback.",
+	}, []string{labelResult})
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.requestsInFlight,
+		m.receivedBytes,
+		m.sentBytes,
+		m.nodeHealthy,
+		m.nodeCircuitState,
+		m.ringNodes,
+		m.ringKeyShare,
+		m.cacheLookups,
+		m.cacheEntries,
+		m.cacheBytes,
+		m.peers,
+		m.peerReads,
+	)
+
+	return m
+}
+
+// Handler returns the HTTP handler exposing the metrics.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// RequestStarted records a request in flight.
+func (m *Metrics) RequestStarted() {
+	if m == nil {
+		return
+	}
+	m.requestsInFlight.Inc()
+}
+
+// RequestFinished records a request served by the node, with its status code,
+// duration and body sizes. The node is empty when no node served the request.
+func (m *Metrics) RequestFinished(method string, status int, node string, duration time.Duration,
+	received, sent int64) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(status)
+
+	m.requestsInFlight.Dec()
+	m.requests.WithLabelValues(method, code, node).Inc()
+	m.requestDuration.WithLabelValues(method, code, node).Observe(duration.Seconds())
+	m.receivedBytes.WithLabelValues(method, node).Add(float64(received))
+	m.sentBytes.WithLabelValues(method, node).Add(float64(sent))
+}
+
+// SetNodeHealthy records whether the node is healthy.
+func (m *Metrics) SetNodeHealthy(node string, healthy bool) {
+	if m == nil {
+		return
+	}
+	var v float64
+	if healthy {
+		v = 1
+	}
+	m.nodeHealthy.WithLabelValues(node).Set(v)
+}
+
+// SetNodeCircuitState records the state of the node circuit breaker.
+func (m *Metrics) SetNodeCircuitState(node string, state int) {
+	if m == nil {
+		return
+	}
+	m.nodeCircuitState.WithLabelValues(node).Set(float64(state))
+}
+
+// SetRing records the ring membership, with the key space share of each node.
+// The per-node series are reset, so that the nodes no longer in the ring are forgotten.
+func (m *Metrics) SetRing(keyShares map[string]float64) {
+	if m == nil {
+		return
+	}
+	m.nodeHealthy.Reset()
+	m.nodeCircuitState.Reset()
+	m.ringKeyShare.Reset()
+
+	m.ringNodes.Set(float64(len(keyShares)))
+	for node, share := range keyShares {
+		m.ringKeyShare.WithLabelValues(node).Set(share)
+	}
+}
+
+// CacheLookup records a lookup of an object read in the cache tier, e.g. memory
+// or disk, with its result: hit, miss or revalidated.
+func (m *Metrics) CacheLookup(tier, result string) {
+	if m == nil {
+		return
+	}
+	m.cacheLookups.WithLabelValues(tier, result).Inc()
+}
+
+// SetCacheSize records the number of objects in the cache tier, and their size.
+func (m *Metrics) SetCacheSize(tier string, entries int, bytes int64) {
+	if m == nil {
+		return
+	}
+	m.cacheEntries.WithLabelValues(tier).Set(float64(entries))
+	m.cacheBytes.WithLabelValues(tier).Set(float64(bytes))
+}
+
+// SetPeers records the number of peer gateways in the ring.
+func (m *Metrics) SetPeers(n int) {
+	if m == nil {
+		return
+	}
+	m.peers.Set(float64(n))
+}
+
+// PeerRead records a read forwarded to the peer owning the object, with its
+// result: forwarded, or fallback when it's read by the gateway itself.
+func (m *Metrics) PeerRead(result string) {
+	if m == nil {
+		return
+	}
+	m.peerReads.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsNil(t *testing.T) {
+	var m *Metrics
+
+	m.RequestStarted()
+	m.RequestFinished(http.MethodGet, http.StatusOK, "minio-1:9000", time.Second, 0, 0)
+	m.SetNodeHealthy("minio-1:9000", true)
+	m.SetNodeCircuitState("minio-1:9000", 2)
+	m.SetRing(map[string]float64{"minio-1:9000": 1})
+	m.CacheLookup("memory", "hit")
+	m.SetCacheSize("memory", 1, 1024)
+	m.SetPeers(2)
+	m.PeerRead("forwarded")
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestMetricsRequests(t *testing.T) {
+	m := New(WithRegistry(prometheus.NewRegistry()))
+
+	m.RequestStarted()
+	m.RequestStarted()
+	m.RequestFinished(http.MethodPut, http.StatusOK, "minio-1:9000", 10*time.Millisecond, 1024, 64)
+
+	if got := testutil.ToFloat64(m.requestsInFlight); got != 1 {
+		t.Errorf("got %v requests in flight, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.requests.WithLabelValues(http.MethodPut, "200", "minio-1:9000")); got != 1 {
+		t.Errorf("got %v requests, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.receivedBytes.WithLabelValues(http.MethodPut, "minio-1:9000")); got != 1024 {
+		t.Errorf("got %v received bytes, want 1024", got)
+	}
+	if got := testutil.ToFloat64(m.sentBytes.WithLabelValues(http.MethodPut, "minio-1:9000")); got != 64 {
+		t.Errorf("got %v sent bytes, want 64", got)
+	}
+}
+
+func TestMetricsSetRing(t *testing.T) {
+	m := New(WithRegistry(prometheus.NewRegistry()))
+
+	m.SetRing(map[string]float64{"minio-1:9000": 0.5, "minio-2:9000": 0.5})
+	m.SetNodeHealthy("minio-1:9000", true)
+	m.SetNodeHealthy("minio-2:9000", false)
+	m.SetRing(map[string]float64{"minio-1:9000": 1})
+
+	if got := testutil.ToFloat64(m.ringNodes); got != 1 {
+		t.Errorf("got %v ring nodes, want 1", got)
+	}
+	if got := testutil.CollectAndCount(m.nodeHealthy); got != 0 {
+		t.Errorf("got %d node health series, want 0", got)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `object_storage_gateway_nodepool_ring_key_share_ratio{node="minio-1:9000"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("got metrics %s, want %s", rec.Body.String(), want)
+	}
+}
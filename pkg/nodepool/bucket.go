@@ -0,0 +1,196 @@
+package nodepool
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrBucketExists     = errors.New("bucket already exists")
+	ErrBucketNotFound   = errors.New("bucket not found")
+	ErrBucketNotEmpty   = errors.New("bucket not empty")
+	ErrNodesUnavailable = errors.New("nodes unavailable")
+)
+
+// Bucket is a bucket stored on the nodes.
+type Bucket struct {
+	Name      string
+	CreatedAt time.Time
+
+	// Nodes are the IDs of the nodes storing the bucket.
+	Nodes []string
+}
+
+// bucketNodeIDs returns the IDs of the nodes which store buckets, i.e. the
+// ones not removed, or an error if any is not available.
+func (p *NodePool) bucketNodeIDs() ([]string, error) {
+	var ids, unavailable []string
+	for _, c := range p.NodeConfigs() {
+		id := c.Endpoint()
+		if p.NodeState(id) == NodeStateRemoved {
+			continue
+		}
+		if p.NodeCircuitState(id) == CircuitOpen || p.NodeClient(id) == nil {
+			unavailable = append(unavailable, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(unavailable) > 0 {
+		return nil, errors.Wrapf(ErrNodesUnavailable, "nodes %s", strings.Join(unavailable, ", "))
+	}
+	if len(ids) == 0 {
+		return nil, errors.Wrap(ErrNodesUnavailable, "no nodes")
+	}
+
+	return ids, nil
+}
+
+// CreateBucket creates the bucket on every node, or on none: the bucket is
+// removed from the nodes it's been created on, if it fails on any. The nodes
+// which store the bucket already, e.g. after a partial failure, are skipped.
+func (p *NodePool) CreateBucket(ctx context.Context, bucket, region string) error {
+	ids, err := p.bucketNodeIDs()
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, id := range ids {
+		exists, err := p.NodeClient(id).BucketExists(ctx, bucket)
+		if err != nil {
+			return errors.Wrapf(err, "error checking bucket %s of node %s", bucket, id)
+		}
+		if !exists {
+			missing = append(missing, id)
+			continue
+		}
+		p.cacheBucket(id, bucket)
+	}
+	if len(missing) == 0 {
+		return errors.Wrapf(ErrBucketExists, "bucket %s", bucket)
+	}
+
+	for i, id := range missing {
+		err := p.NodeClient(id).MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: region})
+		if err == nil {
+			p.cacheBucket(id, bucket)
+			continue
+		}
+		// The rollback completes even if the request is cancelled.
+		for _, created := range missing[:i] {
+			p.ForgetBucket(created, bucket)
+			if rbErr := p.NodeClient(created).RemoveBucket(context.Background(), bucket); rbErr != nil {
+				p.logger.WithError(rbErr).Errorf("error rolling back bucket %s of node %s", bucket, created)
+			}
+		}
+
+		return errors.Wrapf(err, "error creating bucket %s on node %s", bucket, id)
+	}
+
+	return nil
+}
+
+// DeleteBucket removes the empty bucket from every node, or from none: the
+// bucket is created again on the nodes it's been removed from, if it fails on
+// any.
+func (p *NodePool) DeleteBucket(ctx context.Context, bucket, region string) error {
+	ids, err := p.bucketNodeIDs()
+	if err != nil {
+		return err
+	}
+
+	var existing []string
+	for _, id := range ids {
+		client := p.NodeClient(id)
+		exists, err := client.BucketExists(ctx, bucket)
+		if err != nil {
+			return errors.Wrapf(err, "error checking bucket %s of node %s", bucket, id)
+		}
+		if !exists {
+			continue
+		}
+		existing = append(existing, id)
+
+		listCtx, cancel := context.WithCancel(ctx)
+		obj, ok := <-client.ListObjects(listCtx, bucket, minio.ListObjectsOptions{Recursive: true, MaxKeys: 1})
+		cancel()
+		if ok && obj.Err != nil {
+			return errors.Wrapf(obj.Err, "error listing objects of bucket %s of node %s", bucket, id)
+		}
+		if ok {
+			return errors.Wrapf(ErrBucketNotEmpty, "bucket %s of node %s", bucket, id)
+		}
+	}
+	if len(existing) == 0 {
+		return errors.Wrapf(ErrBucketNotFound, "bucket %s", bucket)
+	}
+
+	for i, id := range existing {
+		p.ForgetBucket(id, bucket)
+		err := p.NodeClient(id).RemoveBucket(ctx, bucket)
+		if err == nil {
+			continue
+		}
+		// An object may be put since the bucket is checked.
+		if minio.ToErrorResponse(err).Code == "BucketNotEmpty" {
+			err = errors.Wrap(ErrBucketNotEmpty, err.Error())
+		}
+		// The rollback completes even if the request is cancelled.
+		for _, removed := range existing[:i] {
+			rbErr := p.NodeClient(removed).MakeBucket(context.Background(), bucket, minio.MakeBucketOptions{Region: region})
+			if rbErr != nil {
+				p.logger.WithError(rbErr).Errorf("error rolling back bucket %s of node %s", bucket, removed)
+			}
+		}
+
+		return errors.Wrapf(err, "error deleting bucket %s from node %s", bucket, id)
+	}
+
+	return nil
+}
+
+// ListBuckets returns the buckets with the name prefix stored on any available
+// node, by name.
+func (p *NodePool) ListBuckets(ctx context.Context, prefix string) ([]Bucket, error) {
+	buckets := make(map[string]*Bucket)
+	for _, c := range p.NodeConfigs() {
+		id := c.Endpoint()
+		client := p.NodeClient(id)
+		if client == nil || p.NodeCircuitState(id) == CircuitOpen || p.NodeState(id) == NodeStateRemoved {
+			continue
+		}
+
+		infos, err := client.ListBuckets(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error listing buckets of node %s", id)
+		}
+		for _, info := range infos {
+			if !strings.HasPrefix(info.Name, prefix) {
+				continue
+			}
+			b, ok := buckets[info.Name]
+			if !ok {
+				b = &Bucket{Name: info.Name, CreatedAt: info.CreationDate}
+				buckets[info.Name] = b
+			}
+			if info.CreationDate.Before(b.CreatedAt) {
+				b.CreatedAt = info.CreationDate
+			}
+			b.Nodes = append(b.Nodes, id)
+		}
+	}
+
+	list := make([]Bucket, 0, len(buckets))
+	for _, b := range buckets {
+		list = append(list, *b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list, nil
+}
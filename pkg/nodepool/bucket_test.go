@@ -0,0 +1,109 @@
+package nodepool
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+)
+
+func TestNodePoolBuckets(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	servers := []*miniotest.Server{miniotest.NewServer(), miniotest.NewServer(), miniotest.NewServer()}
+	configs := make([]*NodeConfig, len(servers))
+	for i, srv := range servers {
+		defer srv.Close()
+		configs[i] = NewNodeConfig(srv.Endpoint(), miniotest.AccessKey, miniotest.SecretKey)
+	}
+
+	pool := NewNodePool(WithNodeConfigs(configs...), WithLogger(logger), WithHealthCheckPeriod(0))
+	if err := pool.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+	stored := func(bucket string) (n int) {
+		for _, srv := range servers {
+			if srv.BucketExists(bucket) {
+				n++
+			}
+		}
+		return n
+	}
+
+	// The bucket is removed from the nodes it's been created on, if it fails on any.
+	servers[2].Deny(miniotest.OpMakeBucket, true)
+	if err := pool.CreateBucket(ctx, "photos", ""); err == nil {
+		t.Error("got no error creating bucket with node failing, want one")
+	}
+	if n := stored("photos"); n != 0 {
+		t.Errorf("got bucket on %d nodes after rollback, want none", n)
+	}
+	servers[2].Deny(miniotest.OpMakeBucket, false)
+
+	if err := pool.CreateBucket(ctx, "photos", ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := stored("photos"); n != len(servers) {
+		t.Errorf("got bucket on %d nodes, want %d", n, len(servers))
+	}
+	if err := pool.CreateBucket(ctx, "photos", ""); !errors.Is(err, ErrBucketExists) {
+		t.Errorf("got error %v creating bucket again, want %v", err, ErrBucketExists)
+	}
+
+	buckets, err := pool.ListBuckets(ctx, "ph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 || buckets[0].Name != "photos" || len(buckets[0].Nodes) != len(servers) {
+		t.Errorf("got buckets %+v, want photos on every node", buckets)
+	}
+
+	servers[1].PutObject("photos", "foo", []byte("hello"))
+	if err := pool.DeleteBucket(ctx, "photos", ""); !errors.Is(err, ErrBucketNotEmpty) {
+		t.Errorf("got error %v deleting bucket not empty, want %v", err, ErrBucketNotEmpty)
+	}
+
+	// The bucket is created again on the nodes it's been removed from, if it fails on any.
+	if err := pool.CreateBucket(ctx, "videos", ""); err != nil {
+		t.Fatal(err)
+	}
+	servers[2].Deny(miniotest.OpRemoveBucket, true)
+	if err := pool.DeleteBucket(ctx, "videos", ""); err == nil {
+		t.Error("got no error deleting bucket with node failing, want one")
+	}
+	if n := stored("videos"); n != len(servers) {
+		t.Errorf("got bucket on %d nodes after rollback, want %d", n, len(servers))
+	}
+	servers[2].Deny(miniotest.OpRemoveBucket, false)
+
+	if err := pool.DeleteBucket(ctx, "videos", ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := stored("videos"); n != 0 {
+		t.Errorf("got bucket on %d nodes after delete, want none", n)
+	}
+	if err := pool.DeleteBucket(ctx, "videos", ""); !errors.Is(err, ErrBucketNotFound) {
+		t.Errorf("got error %v deleting bucket again, want %v", err, ErrBucketNotFound)
+	}
+
+	// The bucket operations don't take the trial request of a half-open circuit,
+	// as they don't report their results.
+	openCircuit(pool, servers[0].Endpoint())
+	if err := pool.CreateBucket(ctx, "music", ""); !errors.Is(err, ErrNodesUnavailable) {
+		t.Errorf("got error %v creating bucket with circuit open, want %v", err, ErrNodesUnavailable)
+	}
+	if _, err := pool.ListBuckets(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !pool.NodeAvailable(servers[0].Endpoint()) {
+		t.Error("got trial request taken by the bucket operations")
+	}
+}
@@ -0,0 +1,131 @@
+package nodepool
+
+import (
+	"context"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// WithBuckets sets the buckets provisioned on every node, in the region, on
+// init and when the node joins, i.e. it's healthy again.
+func WithBuckets(region string, buckets ...string) Option {
+	return func(p *NodePool) {
+		p.region = region
+		p.buckets = buckets
+	}
+}
+
+// EnsureBucket creates the bucket on the node, if missing. The bucket is
+// checked on the node once, until it's forgotten with ForgetBucket.
+func (p *NodePool) EnsureBucket(ctx context.Context, id, bucket, region string) error {
+	if p.bucketCached(id, bucket) {
+		return nil
+	}
+
+	client := p.NodeClient(id)
+	if client == nil {
+		return errors.Wrapf(ErrNodeNotFound, "node %s", id)
+	}
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: region})
+		// The bucket may be created concurrently.
+		if err != nil && minio.ToErrorResponse(err).Code != "BucketAlreadyOwnedByYou" {
+			return err
+		}
+	}
+	p.cacheBucket(id, bucket)
+
+	return nil
+}
+
+// BucketExists returns whether the bucket exists on the node. The bucket is
+// checked on the node until it exists, then once until it's forgotten with
+// ForgetBucket.
+func (p *NodePool) BucketExists(ctx context.Context, id, bucket string) (bool, error) {
+	if p.bucketCached(id, bucket) {
+		return true, nil
+	}
+
+	client := p.NodeClient(id)
+	if client == nil {
+		return false, errors.Wrapf(ErrNodeNotFound, "node %s", id)
+	}
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		p.cacheBucket(id, bucket)
+	}
+
+	return exists, nil
+}
+
+// ForgetBucket forgets that the bucket exists on the node, e.g. after a
+// request fails with NoSuchBucket, so that it's checked again.
+func (p *NodePool) ForgetBucket(id, bucket string) {
+	p.bucketsMu.Lock()
+	defer p.bucketsMu.Unlock()
+
+	delete(p.nodeIdToBuckets[id], bucket)
+}
+
+func (p *NodePool) bucketCached(id, bucket string) bool {
+	p.bucketsMu.RLock()
+	defer p.bucketsMu.RUnlock()
+
+	return p.nodeIdToBuckets[id][bucket]
+}
+
+func (p *NodePool) cacheBucket(id, bucket string) {
+	p.bucketsMu.Lock()
+	defer p.bucketsMu.Unlock()
+
+	if p.nodeIdToBuckets[id] == nil {
+		p.nodeIdToBuckets[id] = make(map[string]bool)
+	}
+	p.nodeIdToBuckets[id][bucket] = true
+}
+
+// forgetBuckets forgets all the buckets of the node.
+func (p *NodePool) forgetBuckets(id string) {
+	p.bucketsMu.Lock()
+	defer p.bucketsMu.Unlock()
+
+	delete(p.nodeIdToBuckets, id)
+}
+
+// provisionBuckets creates the buckets on every node not removed.
+func (p *NodePool) provisionBuckets() error {
+	for id := range p.nodeIdToConfig {
+		if p.NodeState(id) == NodeStateRemoved {
+			continue
+		}
+		if err := p.provisionNode(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// provisionNode creates the buckets on the node, if missing.
+func (p *NodePool) provisionNode(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.healthCheckTimeout)
+	defer cancel()
+
+	for _, bucket := range p.buckets {
+		if err := p.EnsureBucket(ctx, id, bucket, p.region); err != nil {
+			return errors.Wrapf(err, "error provisioning bucket %s on node %s", bucket, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package nodepool
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+)
+
+func TestNodePoolBucketCache(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	servers := []*miniotest.Server{miniotest.NewServer("default"), miniotest.NewServer()}
+	configs := make([]*NodeConfig, len(servers))
+	for i, srv := range servers {
+		defer srv.Close()
+		configs[i] = NewNodeConfig(srv.Endpoint(), miniotest.AccessKey, miniotest.SecretKey)
+	}
+
+	pool := NewNodePool(WithNodeConfigs(configs...), WithLogger(logger), WithHealthCheckPeriod(0),
+		WithBuckets("", "default"))
+	if err := pool.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// The buckets are provisioned on init, on every node.
+	for _, srv := range servers {
+		if !srv.BucketExists("default") {
+			t.Errorf("got bucket not provisioned on node %s", srv.Endpoint())
+		}
+	}
+
+	ctx := context.Background()
+	id := servers[1].Endpoint()
+	// The client checks the location of the buckets, before their existence.
+	checks := func() int {
+		return servers[1].Calls(miniotest.OpBucketExists) + servers[1].Calls(miniotest.OpGetBucketLocation)
+	}
+
+	calls := checks()
+	for i := 0; i < 3; i++ {
+		if err := pool.EnsureBucket(ctx, id, "default", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := checks() - calls; got != 0 {
+		t.Errorf("got %d bucket checks of bucket provisioned, want none", got)
+	}
+
+	// The buckets missing are checked until they exist.
+	for i := 0; i < 2; i++ {
+		calls = checks()
+		if exists, err := pool.BucketExists(ctx, id, "photos"); err != nil || exists {
+			t.Fatalf("got bucket exists %t and error %v, want false", exists, err)
+		}
+		if checks() == calls {
+			t.Error("got bucket missing not checked")
+		}
+	}
+	if err := pool.EnsureBucket(ctx, id, "photos", ""); err != nil {
+		t.Fatal(err)
+	}
+	calls = checks()
+	if exists, _ := pool.BucketExists(ctx, id, "photos"); !exists {
+		t.Error("got bucket not existing after it's ensured")
+	}
+	if checks() != calls {
+		t.Error("got bucket ensured checked again")
+	}
+
+	// The buckets forgotten are checked again.
+	pool.ForgetBucket(id, "photos")
+	if exists, _ := pool.BucketExists(ctx, id, "photos"); !exists {
+		t.Error("got bucket not existing after it's forgotten")
+	}
+	if checks() == calls {
+		t.Error("got bucket forgotten not checked again")
+	}
+}
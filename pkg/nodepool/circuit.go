@@ -0,0 +1,118 @@
+package nodepool
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultCircuitBreakerThreshold = 5
+	defaultCircuitBreakerCooldown  = 30 * time.Second
+)
+
+// CircuitState is the state of a node circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets the requests through the node.
+	CircuitClosed CircuitState = iota
+
+	// CircuitHalfOpen lets a trial request through the node, after the cooldown.
+	CircuitHalfOpen
+
+	// CircuitOpen stops the requests to the node, after consecutive failures.
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker stops the requests to a node after threshold consecutive
+// failures, until cooldown elapses.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	trialAt  time.Time
+
+	now func() time.Time
+
+	mu sync.Mutex
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns whether a request can go through. Once the cooldown of an open
+// circuit elapsed, the circuit is half-open and a single trial request is allowed.
+// A trial whose result isn't recorded within the cooldown is given up, and a
+// new trial is allowed, so that a caller which never records doesn't keep the
+// circuit half-open.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.trialAt = b.now()
+		return true
+	case CircuitHalfOpen:
+		// A trial request is already in flight.
+		if b.now().Sub(b.trialAt) < b.cooldown {
+			return false
+		}
+		b.trialAt = b.now()
+		return true
+	default:
+		return true
+	}
+}
+
+// record records the result of a request and returns the resulting state.
+func (b *circuitBreaker) record(err error) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.state = CircuitClosed
+		b.failures = 0
+		return b.state
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+
+	return b.state
+}
+
+func (b *circuitBreaker) currentState() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
@@ -0,0 +1,58 @@
+package nodepool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	errNode := errors.New("connection refused")
+
+	now := time.Now()
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	steps := []struct {
+		name      string
+		elapsed   time.Duration
+		result    error
+		noRecord  bool
+		wantAllow bool
+		wantState CircuitState
+	}{
+		{name: "first failure", result: errNode, wantAllow: true, wantState: CircuitClosed},
+		{name: "threshold reached", result: errNode, wantAllow: true, wantState: CircuitOpen},
+		{name: "during cooldown", wantAllow: false, wantState: CircuitOpen},
+		{name: "trial after cooldown fails", elapsed: time.Minute, result: errNode, wantAllow: true, wantState: CircuitOpen},
+		{name: "trial after cooldown not recorded", elapsed: time.Minute, noRecord: true, wantAllow: true, wantState: CircuitHalfOpen},
+		{name: "during trial", wantAllow: false, wantState: CircuitHalfOpen},
+		{name: "trial after trial timeout succeeds", elapsed: time.Minute, wantAllow: true, wantState: CircuitClosed},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+
+		allowed := b.allow()
+		if allowed != step.wantAllow {
+			t.Fatalf("%s: got allow %t, want %t", step.name, allowed, step.wantAllow)
+		}
+		if allowed && !step.noRecord {
+			b.record(step.result)
+		}
+		if got := b.currentState(); got != step.wantState {
+			t.Fatalf("%s: got state %s, want %s", step.name, got, step.wantState)
+		}
+	}
+}
+
+// openCircuit opens the circuit of the node, with its cooldown elapsed.
+func openCircuit(pool *NodePool, id string) {
+	b := pool.nodeIdToCircuit[id]
+	for i := 0; i < b.threshold; i++ {
+		b.record(errors.New("connection refused"))
+	}
+	openedAt := b.openedAt
+	b.now = func() time.Time { return openedAt.Add(b.cooldown) }
+}
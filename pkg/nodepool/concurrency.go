@@ -0,0 +1,77 @@
+package nodepool
+
+import (
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNodeBusy = errors.New("node busy")
+)
+
+// WithMaxConcurrentRequests limits the requests in flight to each node. The
+// requests are not limited when zero.
+func WithMaxConcurrentRequests(n int) Option {
+	return func(p *NodePool) {
+		p.maxConcurrentRequests.Store(int64(n))
+	}
+}
+
+// SetMaxConcurrentRequests changes the limit of the requests in flight to each
+// node, at runtime. The requests in flight above the new limit complete.
+func (p *NodePool) SetMaxConcurrentRequests(n int) {
+	p.maxConcurrentRequests.Store(int64(n))
+}
+
+// MaxConcurrentRequests returns the limit of the requests in flight to each node.
+func (p *NodePool) MaxConcurrentRequests() int {
+	return int(p.maxConcurrentRequests.Load())
+}
+
+// AcquireNode reserves a slot for a request to the node, and returns the
+// function which releases it, once the request completes. It returns
+// ErrNodeBusy if the node serves the maximum concurrent requests already.
+func (p *NodePool) AcquireNode(id string) (func(), error) {
+	p.RLock()
+	inFlight, ok := p.nodeIdToInFlight[id]
+	p.RUnlock()
+	if !ok {
+		return func() {}, nil
+	}
+
+	if limit := p.maxConcurrentRequests.Load(); inFlight.Add(1) > limit && limit > 0 {
+		inFlight.Add(-1)
+		return nil, errors.Wrapf(ErrNodeBusy, "node %s", id)
+	}
+
+	var once atomic.Bool
+	return func() {
+		if once.CompareAndSwap(false, true) {
+			inFlight.Add(-1)
+		}
+	}, nil
+}
+
+// InFlightRequests returns the number of requests in flight to the node.
+func (p *NodePool) InFlightRequests(id string) int {
+	p.RLock()
+	defer p.RUnlock()
+
+	inFlight, ok := p.nodeIdToInFlight[id]
+	if !ok {
+		return 0
+	}
+
+	return int(inFlight.Load())
+}
+
+func (p *NodePool) buildInFlight() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.nodeIdToInFlight = make(map[string]*atomic.Int64, len(p.nodeIdToConfig))
+	for id := range p.nodeIdToConfig {
+		p.nodeIdToInFlight[id] = new(atomic.Int64)
+	}
+}
@@ -0,0 +1,161 @@
+package nodepool
+
+import (
+	"net"
+	"sort"
+	"time"
+)
+
+const (
+	defaultHealthCheckPeriod = 10 * time.Second
+)
+
+// NodeHealth is the health of a node, as of the last health check.
+type NodeHealth struct {
+	ID      string
+	Healthy bool
+
+	// Latency is the time the last health check took.
+	Latency time.Duration
+
+	// LastError is the error of the last health check, if failed.
+	LastError error
+
+	// LastCheck is the time of the last health check.
+	LastCheck time.Time
+
+	// Circuit is the state of the node circuit breaker.
+	Circuit CircuitState
+}
+
+// probe checks whether the node accepts connections, and records its health.
+func (p *NodePool) probe(id string) error {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", id, p.healthCheckTimeout)
+	latency := time.Since(start)
+	if err == nil {
+		conn.Close()
+	}
+
+	p.Lock()
+	p.nodeIdToHealth[id] = &NodeHealth{
+		ID:        id,
+		Healthy:   err == nil,
+		Latency:   latency,
+		LastError: err,
+		LastCheck: start,
+	}
+	p.Unlock()
+
+	p.metrics.SetNodeHealthy(id, err == nil)
+
+	return err
+}
+
+// startHealthChecks checks the health of the nodes every health check period,
+// until the node pool is closed.
+func (p *NodePool) startHealthChecks() {
+	if p.healthCheckPeriod <= 0 || p.stop != nil {
+		return
+	}
+
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+
+	go func() {
+		defer close(p.stopped)
+
+		ticker := time.NewTicker(p.healthCheckPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				for id := range p.nodeIdToConfig {
+					if p.NodeState(id) == NodeStateRemoved {
+						continue
+					}
+					healthy := p.nodeHealthy(id)
+					if err := p.probe(id); err != nil {
+						p.logger.WithError(err).Warnf("health check of node %s failed", id)
+						continue
+					}
+					// The node joins again, and may have lost its buckets.
+					if !healthy {
+						p.forgetBuckets(id)
+						if err := p.provisionNode(id); err != nil {
+							p.logger.WithError(err).Warnf("error provisioning the buckets of node %s", id)
+						}
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the health checks of the node pool, and the changes of its node states.
+func (p *NodePool) Close() {
+	p.closeOnce.Do(func() {
+		p.Lock()
+		p.closed = true
+		p.Unlock()
+
+		if p.stop != nil {
+			close(p.stop)
+			<-p.stopped
+		}
+	})
+}
+
+// Health returns the health of the nodes, by ID.
+func (p *NodePool) Health() []NodeHealth {
+	p.RLock()
+	health := make([]NodeHealth, 0, len(p.nodeIdToConfig))
+	for id := range p.nodeIdToConfig {
+		h := NodeHealth{ID: id}
+		if v, ok := p.nodeIdToHealth[id]; ok {
+			h = *v
+		}
+		health = append(health, h)
+	}
+	p.RUnlock()
+
+	for i := range health {
+		health[i].Circuit = p.NodeCircuitState(health[i].ID)
+	}
+	sort.Slice(health, func(i, j int) bool { return health[i].ID < health[j].ID })
+
+	return health
+}
+
+// nodeHealthy returns whether the node passed the last health check.
+func (p *NodePool) nodeHealthy(id string) bool {
+	p.RLock()
+	defer p.RUnlock()
+
+	h, ok := p.nodeIdToHealth[id]
+
+	return ok && h.Healthy
+}
+
+// HealthyNodes returns the number of nodes which passed the last health check.
+func (p *NodePool) HealthyNodes() int {
+	p.RLock()
+	defer p.RUnlock()
+
+	var n int
+	for _, h := range p.nodeIdToHealth {
+		if h.Healthy {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Initialized returns whether the node pool has been initialized.
+func (p *NodePool) Initialized() bool {
+	return p.initialized.Load()
+}
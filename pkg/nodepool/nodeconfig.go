@@ -1,16 +1,80 @@
 package nodepool
 
+const (
+	defaultNodeWeight = 1
+)
+
 // NodeConfig represents the set of configurations of a MinIO node.
 type NodeConfig struct {
 	endpoint             string
 	accessKey, secretKey string
+
+	// weight is the relative share of the keys the node stores. A node is
+	// placed on the ring weight times the virtual nodes of the node pool.
+	weight int
+
+	// tls is the TLS configuration of the connections to the node. The
+	// connections are in cleartext when nil.
+	tls *NodeTLS
+}
+
+// NodeTLS is the TLS configuration of the connections to a node.
+type NodeTLS struct {
+	// CAFile is the CA bundle the node certificate is verified against. The
+	// system roots are used when empty.
+	CAFile string
+
+	// ServerName is the name the node certificate is verified for, instead of
+	// the endpoint host.
+	ServerName string
+
+	// InsecureSkipVerify disables the verification of the node certificate,
+	// e.g. in development.
+	InsecureSkipVerify bool
+}
+
+type NodeConfigOption func(c *NodeConfig)
+
+// WithWeight sets the relative share of the keys the node stores.
+func WithWeight(weight int) NodeConfigOption {
+	return func(c *NodeConfig) {
+		c.weight = weight
+	}
 }
 
-func NewNodeConfig(endpoint, accessKey, secretKey string) *NodeConfig {
+// WithTLS enables the TLS to the node.
+func WithTLS(tls NodeTLS) NodeConfigOption {
+	return func(c *NodeConfig) {
+		c.tls = &tls
+	}
+}
+
+func NewNodeConfig(endpoint, accessKey, secretKey string, opts ...NodeConfigOption) *NodeConfig {
 	config := new(NodeConfig)
 	config.endpoint = endpoint
 	config.accessKey = accessKey
 	config.secretKey = secretKey
+	config.weight = defaultNodeWeight
+
+	for _, f := range opts {
+		f(config)
+	}
 
 	return config
 }
+
+// Endpoint returns the host:port address of the node, which is its ID.
+func (c *NodeConfig) Endpoint() string {
+	return c.endpoint
+}
+
+// Weight returns the relative share of the keys the node stores.
+func (c *NodeConfig) Weight() int {
+	return c.weight
+}
+
+// TLS returns the TLS configuration of the connections to the node, or nil if
+// they're in cleartext.
+func (c *NodeConfig) TLS() *NodeTLS {
+	return c.tls
+}
@@ -1,8 +1,9 @@
 package nodepool
 
 import (
-	"net"
+	"crypto/x509"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/maxgio92/consistenthash"
@@ -10,18 +11,31 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/pkg/metrics"
 )
 
 const (
-	maxHealthCheckRetry = 20
+	defaultHealthCheckRetries  = 20
+	defaultHealthCheckInterval = 1 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultReplicationFactor   = 1
+	defaultVirtualNodes        = 1
 )
 
 // NodePool represents a sharding pool of MinIO instances.
 // Each node is supposed to serve a specific object, in a sharding manner.
 type NodePool struct {
 	// ring is a network for consistent hashed nodes.
+	// Each node is placed on the ring as weight times virtualNodes virtual nodes.
 	ring *consistenthash.Ring
 
+	// ringIdToNodeId maps the virtual nodes on the ring to their node.
+	ringIdToNodeId map[string]string
+
+	// virtualNodes is the number of virtual nodes of each node, per weight unit.
+	virtualNodes int
+
 	// nodeIdToClient is an in-memory storage of node-specific MinIO clients.
 	nodeIdToClient map[string]*minio.Client
 
@@ -30,7 +44,70 @@ type NodePool struct {
 
 	sync.RWMutex
 
-	logger *log.Logger
+	// healthCheckRetries is the number of connection attempts to each node on init.
+	healthCheckRetries int
+
+	// healthCheckInterval is the interval between the connection attempts.
+	healthCheckInterval time.Duration
+
+	// healthCheckTimeout is the timeout of each connection attempt.
+	healthCheckTimeout time.Duration
+
+	// healthCheckPeriod is the period of the health checks, after init.
+	// The nodes are checked on init only, when zero.
+	healthCheckPeriod time.Duration
+
+	// nodeIdToHealth is an in-memory storage of the last node health checks.
+	nodeIdToHealth map[string]*NodeHealth
+
+	initialized atomic.Bool
+
+	// stop stops the health checks, which are stopped when stopped is closed.
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+
+	// closed node pools don't write the node states, which the node pool
+	// replacing them owns.
+	closed bool
+
+	// replicationFactor is the number of nodes each object is stored on.
+	replicationFactor int
+
+	// nodeIdToCircuit is an in-memory storage of node circuit breakers.
+	nodeIdToCircuit map[string]*circuitBreaker
+
+	// circuitBreakerThreshold is the number of consecutive failures which open
+	// the circuit of a node.
+	circuitBreakerThreshold int
+
+	// circuitBreakerCooldown is the time the circuit of a node stays open.
+	circuitBreakerCooldown time.Duration
+
+	// nodeIdToState is an in-memory storage of the states of the nodes which
+	// are not active. The map is replaced on every change.
+	nodeIdToState map[string]NodeState
+
+	// stateFile is the file the node states are persisted to.
+	stateFile string
+
+	// nodeIdToInFlight is the number of requests in flight to each node,
+	// limited to maxConcurrentRequests when positive.
+	nodeIdToInFlight      map[string]*atomic.Int64
+	maxConcurrentRequests atomic.Int64
+
+	// buckets are the buckets provisioned on every node, in region, on init
+	// and when the node joins, i.e. it's healthy again.
+	buckets []string
+	region  string
+
+	// nodeIdToBuckets caches the buckets known to exist on each node, until
+	// a request fails as they're missing.
+	nodeIdToBuckets map[string]map[string]bool
+	bucketsMu       sync.RWMutex
+
+	logger  *log.Logger
+	metrics *metrics.Metrics
 }
 
 type Option func(p *NodePool)
@@ -46,25 +123,102 @@ func WithNodeConfigs(configs ...*NodeConfig) Option {
 		p.nodeIdToConfig = make(map[string]*NodeConfig, len(configs))
 
 		for _, v := range configs {
-			p.ring.AddNode(v.endpoint)
 			p.nodeIdToConfig[v.endpoint] = v
 		}
 	}
 }
 
+func WithHealthCheckRetries(retries int) Option {
+	return func(p *NodePool) {
+		p.healthCheckRetries = retries
+	}
+}
+
+func WithHealthCheckInterval(interval time.Duration) Option {
+	return func(p *NodePool) {
+		p.healthCheckInterval = interval
+	}
+}
+
+func WithHealthCheckTimeout(timeout time.Duration) Option {
+	return func(p *NodePool) {
+		p.healthCheckTimeout = timeout
+	}
+}
+
+// WithVirtualNodes sets the number of virtual nodes of each node on the ring,
+// per weight unit. More virtual nodes spread the keys more evenly.
+func WithVirtualNodes(n int) Option {
+	return func(p *NodePool) {
+		p.virtualNodes = n
+	}
+}
+
+// WithHealthCheckPeriod sets the period of the health checks, after init.
+// The nodes are checked on init only, when zero.
+func WithHealthCheckPeriod(period time.Duration) Option {
+	return func(p *NodePool) {
+		p.healthCheckPeriod = period
+	}
+}
+
+// WithReplicationFactor sets the number of nodes each object is stored on.
+// The node pool places the replicas only: writing them is up to the clients.
+func WithReplicationFactor(n int) Option {
+	return func(p *NodePool) {
+		p.replicationFactor = n
+	}
+}
+
+// WithCircuitBreaker sets the number of consecutive failures which stop the
+// requests to a node, and the time after which they're tried again.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(p *NodePool) {
+		p.circuitBreakerThreshold = threshold
+		p.circuitBreakerCooldown = cooldown
+	}
+}
+
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(p *NodePool) {
+		p.metrics = m
+	}
+}
+
 func NewNodePool(opts ...Option) *NodePool {
 	np := new(NodePool)
 
+	np.healthCheckRetries = defaultHealthCheckRetries
+	np.healthCheckInterval = defaultHealthCheckInterval
+	np.healthCheckTimeout = defaultHealthCheckTimeout
+	np.healthCheckPeriod = defaultHealthCheckPeriod
+	np.replicationFactor = defaultReplicationFactor
+	np.virtualNodes = defaultVirtualNodes
+	np.circuitBreakerThreshold = defaultCircuitBreakerThreshold
+	np.circuitBreakerCooldown = defaultCircuitBreakerCooldown
+
 	np.ring = consistenthash.NewRing()
 
+	np.ringIdToNodeId = make(map[string]string)
+
 	np.nodeIdToClient = make(map[string]*minio.Client)
 
 	np.nodeIdToConfig = make(map[string]*NodeConfig)
 
+	np.nodeIdToCircuit = make(map[string]*circuitBreaker)
+
+	np.nodeIdToHealth = make(map[string]*NodeHealth)
+
+	np.nodeIdToState = make(map[string]NodeState)
+
+	np.nodeIdToBuckets = make(map[string]map[string]bool)
+
 	for _, f := range opts {
 		f(np)
 	}
 
+	np.buildRing()
+
 	return np
 }
 
@@ -72,12 +226,24 @@ func (p *NodePool) Init() error {
 	if err := p.validate(); err != nil {
 		return errors.Wrap(err, "error validating the node pool")
 	}
+	if err := p.loadState(); err != nil {
+		return errors.Wrap(err, "error loading the node states")
+	}
 	if err := p.buildClients(); err != nil {
 		return errors.Wrap(err, "error building clients")
 	}
+	p.buildCircuitBreakers()
+	p.buildInFlight()
+	p.metrics.SetRing(p.KeyShares())
+
 	if err := p.healthcheck(); err != nil {
 		return errors.Wrap(err, "error running healthcheck")
 	}
+	if err := p.provisionBuckets(); err != nil {
+		return errors.Wrap(err, "error provisioning the buckets")
+	}
+	p.startHealthChecks()
+	p.initialized.Store(true)
 
 	return nil
 }
@@ -89,6 +255,15 @@ func (p *NodePool) validate() error {
 	if p.logger == nil {
 		return errors.New("the node pool logger is nil")
 	}
+	if p.replicationFactor < 1 {
+		return errors.New("the node pool replication factor must be at least 1")
+	}
+	if p.virtualNodes < 1 {
+		return errors.New("the node pool virtual nodes must be at least 1")
+	}
+	if p.circuitBreakerThreshold < 1 {
+		return errors.New("the node pool circuit breaker threshold must be at least 1")
+	}
 
 	for _, node := range p.nodeIdToConfig {
 		if node.accessKey == "" || node.secretKey == "" {
@@ -97,6 +272,9 @@ func (p *NodePool) validate() error {
 		if node.endpoint == "" {
 			return errors.New("the node config is missing endpoint")
 		}
+		if node.weight < 1 {
+			return errors.New("the node config weight must be at least 1")
+		}
 	}
 
 	return nil
@@ -104,43 +282,72 @@ func (p *NodePool) validate() error {
 
 func (p *NodePool) healthcheck() error {
 	for _, node := range p.nodeIdToConfig {
+		if p.NodeState(node.endpoint) == NodeStateRemoved {
+			continue
+		}
 		p.logger.Debugf("running health check on node %s", node.endpoint)
 
 		// TODO: improve retry logic with smarter algorithm.
-		retry := maxHealthCheckRetry
-		for retry > 0 {
-			_, err := net.Dial("tcp", node.endpoint)
-			if err != nil {
-				p.logger.WithError(err).Errorf("can't connect to backend instance %s", node.endpoint)
-				retry--
-				time.Sleep(1 * time.Second)
+		var err error
+		for retry := p.healthCheckRetries; retry > 0; retry-- {
+			if err = p.probe(node.endpoint); err == nil {
+				break
+			}
+			p.logger.WithError(err).Errorf("can't connect to backend instance %s", node.endpoint)
 
-				return err
+			if retry > 1 {
+				time.Sleep(p.healthCheckInterval)
 			}
-			retry = 0
-			p.logger.Debugf("connection to backend instance %s accepted", node.endpoint)
 		}
+		if err != nil {
+			return err
+		}
+		p.logger.Debugf("connection to backend instance %s accepted", node.endpoint)
 	}
 
 	return nil
 }
 
 func (p *NodePool) buildClients() error {
-	p.nodeIdToClient = make(map[string]*minio.Client, len(p.nodeIdToConfig))
+	clients := make(map[string]*minio.Client, len(p.nodeIdToConfig))
+	caPools := make(map[string]*x509.CertPool)
 	for _, node := range p.nodeIdToConfig {
-		minioClient, err := minio.New(node.endpoint, &minio.Options{
+		opts := &minio.Options{
 			Creds:  credentials.NewStaticV4(node.accessKey, node.secretKey, ""),
-			Secure: false,
-		})
+			Secure: node.tls != nil,
+		}
+		if node.tls != nil {
+			transport, err := nodeTransport(node.tls, caPools)
+			if err != nil {
+				return errors.Wrapf(err, "node %s", node.endpoint)
+			}
+			opts.Transport = transport
+		}
+		minioClient, err := minio.New(node.endpoint, opts)
 		if err != nil {
 			return err
 		}
-		p.nodeIdToClient[node.endpoint] = minioClient
+		clients[node.endpoint] = minioClient
 	}
 
+	p.Lock()
+	p.nodeIdToClient = clients
+	p.Unlock()
+
 	return nil
 }
 
+func (p *NodePool) buildCircuitBreakers() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.nodeIdToCircuit = make(map[string]*circuitBreaker, len(p.nodeIdToConfig))
+	for id := range p.nodeIdToConfig {
+		p.nodeIdToCircuit[id] = newCircuitBreaker(p.circuitBreakerThreshold, p.circuitBreakerCooldown)
+		p.metrics.SetNodeCircuitState(id, int(CircuitClosed))
+	}
+}
+
 func (p *NodePool) NodeClient(id string) *minio.Client {
 	p.RLock()
 	defer p.RUnlock()
@@ -148,6 +355,153 @@ func (p *NodePool) NodeClient(id string) *minio.Client {
 	return p.nodeIdToClient[id]
 }
 
+// ObjectToNodeID returns the ID of the node closest to the key which serves writes.
 func (p *NodePool) ObjectToNodeID(key string) string {
-	return p.ring.Get(key)
+	ids := p.ObjectToNodeIDs(key)
+	if len(ids) == 0 {
+		return ""
+	}
+
+	return ids[0]
+}
+
+// ObjectToNodeIDs returns the IDs of the nodes which store the object: the node
+// closest to the key first, followed by the replicas, walking the ring clockwise
+// and skipping the virtual nodes of the nodes already picked, and the nodes
+// which don't serve writes, e.g. cordoned.
+// At most replication factor IDs are returned.
+func (p *NodePool) ObjectToNodeIDs(key string) []string {
+	return p.walkRing(key, p.inactiveNodes())
+}
+
+// ObjectToReadNodeIDs returns the IDs of the nodes to read the object from:
+// the nodes which store it, followed by the nodes which stored it before being
+// cordoned, as long as they're not removed from the ring.
+func (p *NodePool) ObjectToReadNodeIDs(key string) []string {
+	inactive := p.inactiveNodes()
+	ids := p.walkRing(key, inactive)
+	if len(inactive) == 0 {
+		return ids
+	}
+
+	for _, id := range p.walkRing(key, nil) {
+		if _, ok := inactive[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// walkRing returns the IDs of the first replication factor nodes clockwise
+// from the virtual node the ring places the key at, skipping the nodes in skip.
+func (p *NodePool) walkRing(key string, skip map[string]NodeState) []string {
+	n := p.replicationFactor
+	if n <= 0 {
+		return nil
+	}
+
+	// Look the key up and walk the ring under the same lock, so that the nodes
+	// removed meanwhile don't shift the position of the primary.
+	p.ring.RLock()
+	defer p.ring.RUnlock()
+
+	nodes := p.ring.Nodes
+	if len(nodes) == 0 {
+		return nil
+	}
+	// Get locks the ring itself, hence the lookup on a ring sharing the nodes.
+	primary := (&consistenthash.Ring{Nodes: nodes}).Get(key)
+
+	i := 0
+	for j, node := range nodes {
+		if node.Id == primary {
+			i = j
+			break
+		}
+	}
+
+	ids := make([]string, 0, n)
+	seen := make(map[string]struct{}, n)
+	for j := 0; j < len(nodes) && len(ids) < n; j++ {
+		id := p.ringIdToNodeId[nodes[(i+j)%len(nodes)].Id]
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		if _, ok := skip[id]; ok {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// NodeAvailable returns whether the node circuit lets a request through.
+func (p *NodePool) NodeAvailable(id string) bool {
+	p.RLock()
+	b, ok := p.nodeIdToCircuit[id]
+	p.RUnlock()
+	if !ok {
+		return true
+	}
+
+	available := b.allow()
+	p.metrics.SetNodeCircuitState(id, int(b.currentState()))
+
+	return available
+}
+
+// ReportResult reports the result of a request to the node, to its circuit breaker.
+// Errors which don't depend on the node health should not be reported.
+func (p *NodePool) ReportResult(id string, err error) {
+	p.RLock()
+	b, ok := p.nodeIdToCircuit[id]
+	p.RUnlock()
+	if !ok {
+		return
+	}
+
+	state := b.record(err)
+	if state == CircuitOpen && err != nil {
+		p.logger.WithError(err).Warnf("circuit of node %s open", id)
+	}
+	p.metrics.SetNodeCircuitState(id, int(state))
+}
+
+// NodeCircuitState returns the state of the node circuit breaker.
+func (p *NodePool) NodeCircuitState(id string) CircuitState {
+	p.RLock()
+	defer p.RUnlock()
+
+	b, ok := p.nodeIdToCircuit[id]
+	if !ok {
+		return CircuitClosed
+	}
+
+	return b.currentState()
+}
+
+// KeyShares returns the estimated share of the key space each node is the
+// primary of, by node ID: the fraction of the hash space between the node
+// and its predecessor on the ring.
+func (p *NodePool) KeyShares() map[string]float64 {
+	p.ring.RLock()
+	defer p.ring.RUnlock()
+
+	nodes := p.ring.Nodes
+	shares := make(map[string]float64, len(nodes))
+	if len(nodes) == 1 {
+		shares[p.ringIdToNodeId[nodes[0].Id]] = 1
+		return shares
+	}
+	for i, node := range nodes {
+		prev := nodes[(i+len(nodes)-1)%len(nodes)]
+		// The unsigned subtraction wraps around the ring.
+		arc := node.HashId - prev.HashId
+		shares[p.ringIdToNodeId[node.Id]] += float64(arc) / (1 << 32)
+	}
+
+	return shares
 }
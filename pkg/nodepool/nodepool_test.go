@@ -3,9 +3,11 @@ package nodepool
 import (
 	"github.com/maxgio92/consistenthash"
 	"github.com/pkg/errors"
+	"math"
 	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/sirupsen/logrus"
@@ -28,20 +30,115 @@ func TestNewNodePool(t *testing.T) {
 		want  *NodePool
 	}{
 		{name: "with no option", given: []Option{}, want: &NodePool{
-			nodeIdToClient: make(map[string]*minio.Client),
-			nodeIdToConfig: make(map[string]*NodeConfig),
-			ring:           consistenthash.NewRing(),
+			nodeIdToClient:          make(map[string]*minio.Client),
+			nodeIdToConfig:          make(map[string]*NodeConfig),
+			ring:                    consistenthash.NewRing(),
+			ringIdToNodeId:          make(map[string]string),
+			virtualNodes:            defaultVirtualNodes,
+			healthCheckRetries:      defaultHealthCheckRetries,
+			healthCheckInterval:     defaultHealthCheckInterval,
+			healthCheckTimeout:      defaultHealthCheckTimeout,
+			healthCheckPeriod:       defaultHealthCheckPeriod,
+			nodeIdToHealth:          make(map[string]*NodeHealth),
+			replicationFactor:       defaultReplicationFactor,
+			nodeIdToCircuit:         make(map[string]*circuitBreaker),
+			nodeIdToState:           make(map[string]NodeState),
+			nodeIdToBuckets:         make(map[string]map[string]bool),
+			circuitBreakerThreshold: defaultCircuitBreakerThreshold,
+			circuitBreakerCooldown:  defaultCircuitBreakerCooldown,
 		}},
 		{name: "with logger", given: []Option{WithLogger(logger)}, want: &NodePool{
-			logger:         logger,
-			nodeIdToClient: make(map[string]*minio.Client),
-			nodeIdToConfig: make(map[string]*NodeConfig),
-			ring:           consistenthash.NewRing(),
+			logger:                  logger,
+			nodeIdToClient:          make(map[string]*minio.Client),
+			nodeIdToConfig:          make(map[string]*NodeConfig),
+			ring:                    consistenthash.NewRing(),
+			ringIdToNodeId:          make(map[string]string),
+			virtualNodes:            defaultVirtualNodes,
+			healthCheckRetries:      defaultHealthCheckRetries,
+			healthCheckInterval:     defaultHealthCheckInterval,
+			healthCheckTimeout:      defaultHealthCheckTimeout,
+			healthCheckPeriod:       defaultHealthCheckPeriod,
+			nodeIdToHealth:          make(map[string]*NodeHealth),
+			replicationFactor:       defaultReplicationFactor,
+			nodeIdToCircuit:         make(map[string]*circuitBreaker),
+			nodeIdToState:           make(map[string]NodeState),
+			nodeIdToBuckets:         make(map[string]map[string]bool),
+			circuitBreakerThreshold: defaultCircuitBreakerThreshold,
+			circuitBreakerCooldown:  defaultCircuitBreakerCooldown,
 		}},
 		{name: "with node configs", given: []Option{WithNodeConfigs(nodeConfig, nodeConfig2)}, want: &NodePool{
-			nodeIdToClient: make(map[string]*minio.Client),
-			nodeIdToConfig: map[string]*NodeConfig{nodeConfig.endpoint: nodeConfig, nodeConfig2.endpoint: nodeConfig2},
-			ring:           ring,
+			nodeIdToClient:          make(map[string]*minio.Client),
+			nodeIdToConfig:          map[string]*NodeConfig{nodeConfig.endpoint: nodeConfig, nodeConfig2.endpoint: nodeConfig2},
+			ring:                    ring,
+			ringIdToNodeId:          map[string]string{nodeConfig.endpoint: nodeConfig.endpoint, nodeConfig2.endpoint: nodeConfig2.endpoint},
+			virtualNodes:            defaultVirtualNodes,
+			healthCheckRetries:      defaultHealthCheckRetries,
+			healthCheckInterval:     defaultHealthCheckInterval,
+			healthCheckTimeout:      defaultHealthCheckTimeout,
+			healthCheckPeriod:       defaultHealthCheckPeriod,
+			nodeIdToHealth:          make(map[string]*NodeHealth),
+			replicationFactor:       defaultReplicationFactor,
+			nodeIdToCircuit:         make(map[string]*circuitBreaker),
+			nodeIdToState:           make(map[string]NodeState),
+			nodeIdToBuckets:         make(map[string]map[string]bool),
+			circuitBreakerThreshold: defaultCircuitBreakerThreshold,
+			circuitBreakerCooldown:  defaultCircuitBreakerCooldown,
+		}},
+		{name: "with health check", given: []Option{
+			WithHealthCheckRetries(3), WithHealthCheckInterval(time.Second), WithHealthCheckTimeout(time.Minute),
+		}, want: &NodePool{
+			nodeIdToClient:          make(map[string]*minio.Client),
+			nodeIdToConfig:          make(map[string]*NodeConfig),
+			ring:                    consistenthash.NewRing(),
+			ringIdToNodeId:          make(map[string]string),
+			virtualNodes:            defaultVirtualNodes,
+			healthCheckRetries:      3,
+			healthCheckInterval:     time.Second,
+			healthCheckTimeout:      time.Minute,
+			healthCheckPeriod:       defaultHealthCheckPeriod,
+			nodeIdToHealth:          make(map[string]*NodeHealth),
+			replicationFactor:       defaultReplicationFactor,
+			nodeIdToCircuit:         make(map[string]*circuitBreaker),
+			nodeIdToState:           make(map[string]NodeState),
+			nodeIdToBuckets:         make(map[string]map[string]bool),
+			circuitBreakerThreshold: defaultCircuitBreakerThreshold,
+			circuitBreakerCooldown:  defaultCircuitBreakerCooldown,
+		}},
+		{name: "with replication factor", given: []Option{WithReplicationFactor(2)}, want: &NodePool{
+			nodeIdToClient:          make(map[string]*minio.Client),
+			nodeIdToConfig:          make(map[string]*NodeConfig),
+			ring:                    consistenthash.NewRing(),
+			ringIdToNodeId:          make(map[string]string),
+			virtualNodes:            defaultVirtualNodes,
+			healthCheckRetries:      defaultHealthCheckRetries,
+			healthCheckInterval:     defaultHealthCheckInterval,
+			healthCheckTimeout:      defaultHealthCheckTimeout,
+			healthCheckPeriod:       defaultHealthCheckPeriod,
+			nodeIdToHealth:          make(map[string]*NodeHealth),
+			replicationFactor:       2,
+			nodeIdToCircuit:         make(map[string]*circuitBreaker),
+			nodeIdToState:           make(map[string]NodeState),
+			nodeIdToBuckets:         make(map[string]map[string]bool),
+			circuitBreakerThreshold: defaultCircuitBreakerThreshold,
+			circuitBreakerCooldown:  defaultCircuitBreakerCooldown,
+		}},
+		{name: "with circuit breaker", given: []Option{WithCircuitBreaker(3, time.Minute)}, want: &NodePool{
+			nodeIdToClient:          make(map[string]*minio.Client),
+			nodeIdToConfig:          make(map[string]*NodeConfig),
+			ring:                    consistenthash.NewRing(),
+			ringIdToNodeId:          make(map[string]string),
+			virtualNodes:            defaultVirtualNodes,
+			healthCheckRetries:      defaultHealthCheckRetries,
+			healthCheckInterval:     defaultHealthCheckInterval,
+			healthCheckTimeout:      defaultHealthCheckTimeout,
+			healthCheckPeriod:       defaultHealthCheckPeriod,
+			nodeIdToHealth:          make(map[string]*NodeHealth),
+			replicationFactor:       defaultReplicationFactor,
+			nodeIdToCircuit:         make(map[string]*circuitBreaker),
+			nodeIdToState:           make(map[string]NodeState),
+			nodeIdToBuckets:         make(map[string]map[string]bool),
+			circuitBreakerThreshold: 3,
+			circuitBreakerCooldown:  time.Minute,
 		}},
 	}
 
@@ -76,7 +173,8 @@ func TestNodePoolInit(t *testing.T) {
 		want  error
 	}{
 		{name: "with online nodes", given: NewNodePool(WithLogger(logger), WithNodeConfigs(node)), want: nil},
-		{name: "with one offline node", given: NewNodePool(WithLogger(logger), WithNodeConfigs(node, node2)), want: unix.ECONNREFUSED},
+		{name: "with one offline node", given: NewNodePool(WithLogger(logger), WithNodeConfigs(node, node2),
+			WithHealthCheckRetries(2), WithHealthCheckInterval(10*time.Millisecond)), want: unix.ECONNREFUSED},
 	}
 
 	for _, tt := range testCases {
@@ -102,3 +200,233 @@ func TestNodePoolInit(t *testing.T) {
 		})
 	}
 }
+
+func TestNodePoolObjectToNodeIDs(t *testing.T) {
+	node := NewNodeConfig("localhost:3000", "mykey", "mysecret")
+	node2 := NewNodeConfig("localhost:3001", "mykey", "mysecret")
+	node3 := NewNodeConfig("localhost:3002", "mykey", "mysecret")
+
+	testCases := []struct {
+		name  string
+		given *NodePool
+		want  int
+	}{
+		{name: "with no nodes", given: NewNodePool(WithReplicationFactor(2)), want: 0},
+		{name: "with default replication factor", given: NewNodePool(WithNodeConfigs(node, node2, node3)), want: 1},
+		{name: "with replication factor", given: NewNodePool(WithNodeConfigs(node, node2, node3), WithReplicationFactor(2)), want: 2},
+		{name: "with replication factor greater than nodes", given: NewNodePool(WithNodeConfigs(node, node2), WithReplicationFactor(3)), want: 2},
+		{name: "with virtual nodes", given: NewNodePool(WithNodeConfigs(node, node2, node3), WithReplicationFactor(3), WithVirtualNodes(16)), want: 3},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"a", "foo", "bar", "0123456789abcdef0123456789abcdef"} {
+				got := tt.given.ObjectToNodeIDs(key)
+				if len(got) != tt.want {
+					t.Fatalf("got %d nodes, want %d", len(got), tt.want)
+				}
+				if len(got) > 0 && got[0] != tt.given.ObjectToNodeID(key) {
+					t.Errorf("got primary node %s, want %s", got[0], tt.given.ObjectToNodeID(key))
+				}
+				seen := map[string]bool{}
+				for _, id := range got {
+					if seen[id] {
+						t.Errorf("got duplicate node %s in %v", id, got)
+					}
+					seen[id] = true
+				}
+			}
+		})
+	}
+}
+
+func TestNodePoolKeyShares(t *testing.T) {
+	node := NewNodeConfig("localhost:3000", "mykey", "mysecret")
+	node2 := NewNodeConfig("localhost:3001", "mykey", "mysecret")
+	node3 := NewNodeConfig("localhost:3002", "mykey", "mysecret")
+
+	testCases := []struct {
+		name  string
+		given *NodePool
+		want  int
+	}{
+		{name: "with no nodes", given: NewNodePool(), want: 0},
+		{name: "with one node", given: NewNodePool(WithNodeConfigs(node)), want: 1},
+		{name: "with nodes", given: NewNodePool(WithNodeConfigs(node, node2, node3)), want: 3},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.given.KeyShares()
+			if len(got) != tt.want {
+				t.Fatalf("got %d nodes, want %d", len(got), tt.want)
+			}
+
+			var sum float64
+			for _, share := range got {
+				sum += share
+			}
+			if tt.want > 0 && math.Abs(sum-1) > 1e-9 {
+				t.Errorf("got key shares summing to %v, want 1", sum)
+			}
+		})
+	}
+}
+
+func TestNodePoolReportResult(t *testing.T) {
+	pool := NewNodePool(
+		WithNodeConfigs(NewNodeConfig("localhost:3000", "mykey", "mysecret")),
+		WithLogger(logrus.New()),
+		WithCircuitBreaker(1, time.Minute),
+	)
+	pool.buildCircuitBreakers()
+
+	if !pool.NodeAvailable("localhost:3000") {
+		t.Fatal("got node unavailable, want available")
+	}
+	pool.ReportResult("localhost:3000", errors.New("connection refused"))
+
+	if got := pool.NodeCircuitState("localhost:3000"); got != CircuitOpen {
+		t.Errorf("got circuit %s, want %s", got, CircuitOpen)
+	}
+	if pool.NodeAvailable("localhost:3000") {
+		t.Error("got node available, want unavailable")
+	}
+}
+
+func TestNodePoolHealthChecks(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := l.Addr().String()
+
+	pool := NewNodePool(
+		WithNodeConfigs(NewNodeConfig(endpoint, "mykey", "mysecret")),
+		WithLogger(logrus.New()),
+		WithHealthCheckRetries(1),
+		WithHealthCheckPeriod(10*time.Millisecond),
+	)
+	if pool.Initialized() {
+		t.Fatal("got node pool initialized, want not initialized")
+	}
+	if err = pool.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if !pool.Initialized() {
+		t.Error("got node pool not initialized, want initialized")
+	}
+	if got := pool.HealthyNodes(); got != 1 {
+		t.Errorf("got %d healthy nodes, want 1", got)
+	}
+
+	// The node stops accepting connections.
+	l.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for pool.HealthyNodes() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	health := pool.Health()
+	if len(health) != 1 || health[0].Healthy || health[0].LastError == nil {
+		t.Errorf("got health %+v, want node unhealthy with error", health)
+	}
+}
+
+func TestNodePoolRing(t *testing.T) {
+	node := NewNodeConfig("localhost:3000", "mykey", "mysecret")
+	node2 := NewNodeConfig("localhost:3001", "mykey", "mysecret", WithWeight(2))
+
+	testCases := []struct {
+		name  string
+		given *NodePool
+		want  map[string]int
+	}{
+		{name: "with no nodes", given: NewNodePool(), want: map[string]int{}},
+		{name: "with default virtual nodes", given: NewNodePool(WithNodeConfigs(node, node2)),
+			want: map[string]int{node.endpoint: 1, node2.endpoint: 2}},
+		{name: "with virtual nodes", given: NewNodePool(WithNodeConfigs(node, node2), WithVirtualNodes(8)),
+			want: map[string]int{node.endpoint: 8, node2.endpoint: 16}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]int)
+			var share float64
+			for _, n := range tt.given.Ring() {
+				got[n.ID] = len(n.VirtualNodes)
+				share += n.KeyShare
+				for _, v := range n.VirtualNodes {
+					if v.Hash != KeyHash(v.ID) {
+						t.Errorf("got virtual node %s hash %d, want %d", v.ID, v.Hash, KeyHash(v.ID))
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got virtual nodes %v, want %v", got, tt.want)
+			}
+			if len(tt.want) > 0 && math.Abs(share-1) > 1e-9 {
+				t.Errorf("got key shares summing to %f, want 1", share)
+			}
+		})
+	}
+}
+
+func TestNodePoolAcquireNode(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	endpoint := l.Addr().String()
+
+	pool := NewNodePool(
+		WithNodeConfigs(NewNodeConfig(endpoint, "mykey", "mysecret")),
+		WithLogger(logrus.New()),
+		WithHealthCheckPeriod(0),
+		WithMaxConcurrentRequests(2),
+	)
+	if err = pool.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	release1, err := pool.AcquireNode(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release2, err := pool.AcquireNode(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pool.AcquireNode(endpoint); !errors.Is(err, ErrNodeBusy) {
+		t.Errorf("got error %v above the limit, want %v", err, ErrNodeBusy)
+	}
+
+	// Releasing twice frees a single slot.
+	release1()
+	release1()
+	if got := pool.InFlightRequests(endpoint); got != 1 {
+		t.Errorf("got %d requests in flight, want 1", got)
+	}
+	release3, err := pool.AcquireNode(endpoint)
+	if err != nil {
+		t.Errorf("got error %v below the limit", err)
+	}
+
+	// The limit changes at runtime, and it's disabled when zero.
+	pool.SetMaxConcurrentRequests(0)
+	release4, err := pool.AcquireNode(endpoint)
+	if err != nil {
+		t.Errorf("got error %v without limit", err)
+	}
+	release2()
+	release3()
+	release4()
+	if got := pool.InFlightRequests(endpoint); got != 0 {
+		t.Errorf("got %d requests in flight, want 0", got)
+	}
+}
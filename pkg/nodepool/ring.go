@@ -0,0 +1,105 @@
+package nodepool
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/maxgio92/consistenthash"
+)
+
+// VirtualNode is a position of a node on the ring.
+type VirtualNode struct {
+	ID   string
+	Hash uint32
+}
+
+// RingNode is a node on the ring, with its virtual nodes.
+type RingNode struct {
+	ID     string
+	Weight int
+
+	VirtualNodes []VirtualNode
+
+	// KeyShare is the estimated share of the key space the node is the primary of.
+	KeyShare float64
+}
+
+// KeyHash returns the position of the key on the ring.
+func KeyHash(key string) uint32 {
+	return consistenthash.NewNode(key).HashId
+}
+
+// virtualNodeID returns the ID of the i-th virtual node of the node. The first
+// virtual node is the node itself, so that a single virtual node per node
+// places the keys as a plain ring.
+func virtualNodeID(nodeID string, i int) string {
+	if i == 0 {
+		return nodeID
+	}
+
+	return fmt.Sprintf("%s#%d", nodeID, i)
+}
+
+// buildRing places the virtual nodes of the nodes on the ring.
+func (p *NodePool) buildRing() {
+	p.ring.Lock()
+	defer p.ring.Unlock()
+
+	for id, node := range p.nodeIdToConfig {
+		for i := 0; i < node.weight*p.virtualNodes; i++ {
+			vid := virtualNodeID(id, i)
+			p.ring.AddNode(vid)
+			p.ringIdToNodeId[vid] = id
+		}
+	}
+}
+
+// Ring returns the nodes on the ring, by ID.
+func (p *NodePool) Ring() []RingNode {
+	shares := p.KeyShares()
+
+	p.ring.RLock()
+	byID := make(map[string]*RingNode, len(p.nodeIdToConfig))
+	for _, vnode := range p.ring.Nodes {
+		id := p.ringIdToNodeId[vnode.Id]
+		node, ok := byID[id]
+		if !ok {
+			node = &RingNode{ID: id, KeyShare: shares[id]}
+			if config, ok := p.nodeIdToConfig[id]; ok {
+				node.Weight = config.weight
+			}
+			byID[id] = node
+		}
+		node.VirtualNodes = append(node.VirtualNodes, VirtualNode{ID: vnode.Id, Hash: vnode.HashId})
+	}
+	p.ring.RUnlock()
+
+	nodes := make([]RingNode, 0, len(byID))
+	for _, node := range byID {
+		nodes = append(nodes, *node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	return nodes
+}
+
+// NodeConfigs returns the configs of the nodes, by ID.
+func (p *NodePool) NodeConfigs() []*NodeConfig {
+	configs := make([]*NodeConfig, 0, len(p.nodeIdToConfig))
+	for _, config := range p.nodeIdToConfig {
+		configs = append(configs, config)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].endpoint < configs[j].endpoint })
+
+	return configs
+}
+
+// ReplicationFactor returns the number of nodes each object is stored on.
+func (p *NodePool) ReplicationFactor() int {
+	return p.replicationFactor
+}
+
+// VirtualNodes returns the number of virtual nodes of each node, per weight unit.
+func (p *NodePool) VirtualNodes() int {
+	return p.virtualNodes
+}
@@ -0,0 +1,368 @@
+package nodepool
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// NodeState is the operational state of a node.
+type NodeState string
+
+const (
+	// NodeStateActive nodes serve reads and writes.
+	NodeStateActive NodeState = "active"
+
+	// NodeStateCordoned nodes serve reads of the objects they store, but no writes.
+	NodeStateCordoned NodeState = "cordoned"
+
+	// NodeStateDraining nodes are cordoned, and their objects are being copied
+	// to the nodes which store them in their place.
+	NodeStateDraining NodeState = "draining"
+
+	// NodeStateDrained nodes are cordoned, and their objects have been copied.
+	NodeStateDrained NodeState = "drained"
+
+	// NodeStateRemoved nodes are removed from the ring.
+	NodeStateRemoved NodeState = "removed"
+)
+
+var (
+	ErrNodeNotFound        = errors.New("node not found")
+	ErrNodeStateTransition = errors.New("node state transition not valid")
+	ErrNodePoolClosed      = errors.New("node pool closed")
+)
+
+// nodeStates is the format of the state file.
+type nodeStates struct {
+	Nodes map[string]NodeState `json:"nodes"`
+}
+
+// WithStateFile sets the file the node states are persisted to, so that they
+// survive restarts. The node states are kept in memory only, when empty.
+func WithStateFile(path string) Option {
+	return func(p *NodePool) {
+		p.stateFile = path
+	}
+}
+
+// NodeState returns the state of the node.
+func (p *NodePool) NodeState(id string) NodeState {
+	p.RLock()
+	defer p.RUnlock()
+
+	if state, ok := p.nodeIdToState[id]; ok {
+		return state
+	}
+
+	return NodeStateActive
+}
+
+// NodesInState returns the IDs of the nodes in the state, sorted.
+func (p *NodePool) NodesInState(state NodeState) []string {
+	p.RLock()
+	defer p.RUnlock()
+
+	var ids []string
+	for id := range p.nodeIdToConfig {
+		s, ok := p.nodeIdToState[id]
+		if !ok {
+			s = NodeStateActive
+		}
+		if s == state {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Cordon stops the writes to the node.
+func (p *NodePool) Cordon(id string) error {
+	return p.setState(id, NodeStateCordoned, NodeStateActive, NodeStateCordoned)
+}
+
+// Uncordon restores the writes to a cordoned or drained node.
+func (p *NodePool) Uncordon(id string) error {
+	return p.setState(id, NodeStateActive, NodeStateCordoned, NodeStateDrained)
+}
+
+// StartDrain cordons the node and marks it as draining, for Drain to copy its objects.
+func (p *NodePool) StartDrain(id string) error {
+	return p.setState(id, NodeStateDraining, NodeStateActive, NodeStateCordoned, NodeStateDraining)
+}
+
+// Drain copies the objects the draining node stores in the buckets it owns, as
+// told by owns, e.g. the ones of the tenants, to the nodes which store them in
+// its place, and marks it as drained. The objects already stored by those
+// nodes are not overwritten, so that Drain can be retried.
+func (p *NodePool) Drain(ctx context.Context, id, region string, owns func(bucket string) bool) error {
+	if state := p.NodeState(id); state != NodeStateDraining {
+		return errors.Wrapf(ErrNodeStateTransition, "node %s is %s, not %s", id, state, NodeStateDraining)
+	}
+
+	client := p.NodeClient(id)
+	if client == nil {
+		return errors.Wrapf(ErrNodeNotFound, "node %s", id)
+	}
+
+	buckets, err := client.ListBuckets(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error listing buckets of node %s", id)
+	}
+	var copied int
+	for _, bucket := range buckets {
+		if !owns(bucket.Name) {
+			continue
+		}
+		for obj := range client.ListObjects(ctx, bucket.Name, minio.ListObjectsOptions{Recursive: true}) {
+			if obj.Err != nil {
+				return errors.Wrapf(obj.Err, "error listing objects of node %s", id)
+			}
+			for _, target := range p.ObjectToNodeIDs(obj.Key) {
+				ok, err := p.copyObject(ctx, id, target, bucket.Name, region, obj.Key)
+				if err != nil {
+					return errors.Wrapf(err, "error copying object %s to node %s", obj.Key, target)
+				}
+				if ok {
+					copied++
+				}
+			}
+		}
+	}
+	p.logger.Infof("copied %d objects of node %s", copied, id)
+
+	// The node stays draining if the drain is cancelled meanwhile.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return p.setState(id, NodeStateDrained, NodeStateDraining)
+}
+
+// Remove removes the drained node from the ring.
+func (p *NodePool) Remove(id string) error {
+	if err := p.setState(id, NodeStateRemoved, NodeStateDrained); err != nil {
+		return err
+	}
+	p.removeFromRing(id)
+	p.metrics.SetRing(p.KeyShares())
+
+	return nil
+}
+
+// copyObject copies the object from the source node to the target node, unless
+// the target node already stores it. It returns whether the object was copied.
+func (p *NodePool) copyObject(ctx context.Context, source, target, bucket, region, key string) (bool, error) {
+	dst := p.NodeClient(target)
+	if dst == nil {
+		return false, errors.Wrapf(ErrNodeNotFound, "node %s", target)
+	}
+
+	_, err := dst.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return false, nil
+	}
+	if minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+		return false, err
+	}
+
+	if err := p.EnsureBucket(ctx, target, bucket, region); err != nil {
+		return false, err
+	}
+
+	obj, err := p.NodeClient(source).GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = dst.PutObject(ctx, bucket, key, obj, info.Size, minio.PutObjectOptions{ContentType: info.ContentType})
+
+	return err == nil, err
+}
+
+// setState moves the node to the state, if it's in one of the states from.
+func (p *NodePool) setState(id string, to NodeState, from ...NodeState) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.closed {
+		return ErrNodePoolClosed
+	}
+	if _, ok := p.nodeIdToConfig[id]; !ok {
+		return errors.Wrapf(ErrNodeNotFound, "node %s", id)
+	}
+
+	current, ok := p.nodeIdToState[id]
+	if !ok {
+		current = NodeStateActive
+	}
+
+	allowed := false
+	for _, s := range from {
+		if current == s {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return errors.Wrapf(ErrNodeStateTransition, "node %s from %s to %s", id, current, to)
+	}
+
+	previous := p.nodeIdToState
+	p.nodeIdToState = make(map[string]NodeState, len(previous)+1)
+	for k, v := range previous {
+		p.nodeIdToState[k] = v
+	}
+	if to == NodeStateActive {
+		delete(p.nodeIdToState, id)
+	} else {
+		p.nodeIdToState[id] = to
+	}
+
+	if err := p.saveState(); err != nil {
+		p.nodeIdToState = previous
+		return errors.Wrap(err, "error saving the node states")
+	}
+	p.logger.Infof("node %s is %s", id, to)
+
+	return nil
+}
+
+// inactiveNodes returns the nodes which don't serve writes.
+func (p *NodePool) inactiveNodes() map[string]NodeState {
+	p.RLock()
+	defer p.RUnlock()
+
+	// The map is replaced on every change, so it can be read without lock.
+	return p.nodeIdToState
+}
+
+// loadState loads the node states from the state file, if any, and removes
+// the removed nodes from the ring.
+func (p *NodePool) loadState() error {
+	if p.stateFile == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(p.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var states nodeStates
+	if err := json.Unmarshal(b, &states); err != nil {
+		return errors.Wrapf(err, "error decoding state file %s", p.stateFile)
+	}
+
+	p.Lock()
+	p.nodeIdToState = make(map[string]NodeState, len(states.Nodes))
+	for id, state := range states.Nodes {
+		if state != NodeStateActive {
+			p.nodeIdToState[id] = state
+		}
+	}
+	p.Unlock()
+
+	for id, state := range states.Nodes {
+		if state == NodeStateRemoved {
+			p.removeFromRing(id)
+		}
+	}
+
+	return nil
+}
+
+// InheritStates copies the node states of the node pool it replaces, and
+// removes the removed nodes from the ring, so that the node states survive the
+// reloads when they're kept in memory only. With a state file, the node states
+// are the ones loaded from it.
+func (p *NodePool) InheritStates(from *NodePool) {
+	if from == nil || from == p || p.stateFile != "" {
+		return
+	}
+	states := from.inactiveNodes()
+	if len(states) == 0 {
+		return
+	}
+
+	p.Lock()
+	next := make(map[string]NodeState, len(p.nodeIdToState)+len(states))
+	for id, state := range p.nodeIdToState {
+		next[id] = state
+	}
+	for id, state := range states {
+		next[id] = state
+	}
+	p.nodeIdToState = next
+	p.Unlock()
+
+	for id, state := range states {
+		if state == NodeStateRemoved {
+			p.removeFromRing(id)
+		}
+	}
+	p.metrics.SetRing(p.KeyShares())
+}
+
+// saveState writes the node states to the state file, if any. The file is
+// replaced atomically, so that it's never left partially written.
+func (p *NodePool) saveState() error {
+	if p.stateFile == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(nodeStates{Nodes: p.nodeIdToState}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.stateFile), filepath.Base(p.stateFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p.stateFile)
+}
+
+// removeFromRing removes the virtual nodes of the node from the ring.
+func (p *NodePool) removeFromRing(id string) {
+	p.ring.Lock()
+	nodes := make([]string, 0)
+	for _, vnode := range p.ring.Nodes {
+		if p.ringIdToNodeId[vnode.Id] == id {
+			nodes = append(nodes, vnode.Id)
+		}
+	}
+	p.ring.Unlock()
+
+	for _, vid := range nodes {
+		// The virtual nodes have just been found on the ring.
+		_ = p.ring.RemoveNode(vid)
+	}
+}
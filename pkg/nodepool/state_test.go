@@ -0,0 +1,176 @@
+package nodepool
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func TestNodePoolStateTransitions(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	node := NewNodeConfig("localhost:3000", "mykey", "mysecret")
+
+	testCases := []struct {
+		name    string
+		ops     []func(p *NodePool, id string) error
+		want    NodeState
+		wantErr error
+	}{
+		{name: "with no operation", want: NodeStateActive},
+		{name: "with cordon", ops: []func(p *NodePool, id string) error{(*NodePool).Cordon}, want: NodeStateCordoned},
+		{name: "with cordon and uncordon", ops: []func(p *NodePool, id string) error{(*NodePool).Cordon, (*NodePool).Uncordon},
+			want: NodeStateActive},
+		{name: "with drain started", ops: []func(p *NodePool, id string) error{(*NodePool).StartDrain}, want: NodeStateDraining},
+		{name: "with uncordon of active node", ops: []func(p *NodePool, id string) error{(*NodePool).Uncordon},
+			want: NodeStateActive, wantErr: ErrNodeStateTransition},
+		{name: "with remove of cordoned node", ops: []func(p *NodePool, id string) error{(*NodePool).Cordon, (*NodePool).Remove},
+			want: NodeStateCordoned, wantErr: ErrNodeStateTransition},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewNodePool(WithNodeConfigs(node), WithLogger(logger))
+
+			var err error
+			for _, op := range tt.ops {
+				if err = op(p, node.endpoint); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got := p.NodeState(node.endpoint); got != tt.want {
+				t.Errorf("got state %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	p := NewNodePool(WithNodeConfigs(node), WithLogger(logger))
+	if err := p.Cordon("localhost:4000"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("got error %v cordoning unknown node, want %v", err, ErrNodeNotFound)
+	}
+}
+
+func TestNodePoolCordonPlacement(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	node := NewNodeConfig("localhost:3000", "mykey", "mysecret")
+	node2 := NewNodeConfig("localhost:3001", "mykey", "mysecret")
+	node3 := NewNodeConfig("localhost:3002", "mykey", "mysecret")
+
+	p := NewNodePool(WithNodeConfigs(node, node2, node3), WithLogger(logger), WithReplicationFactor(2))
+
+	key := "foo"
+	owners := p.ObjectToNodeIDs(key)
+	cordoned := owners[0]
+	if err := p.Cordon(cordoned); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := p.ObjectToNodeIDs(key)
+	if len(writes) != 2 {
+		t.Fatalf("got %d write nodes, want 2", len(writes))
+	}
+	for _, id := range writes {
+		if id == cordoned {
+			t.Errorf("got cordoned node %s in write nodes %v", id, writes)
+		}
+	}
+
+	reads := p.ObjectToReadNodeIDs(key)
+	if len(reads) != 3 || reads[2] != cordoned {
+		t.Errorf("got read nodes %v, want write nodes %v followed by %s", reads, writes, cordoned)
+	}
+}
+
+func TestNodePoolStateFile(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	node := NewNodeConfig("127.0.0.1:1", "mykey", "mysecret")
+	node2 := NewNodeConfig("127.0.0.1:2", "mykey", "mysecret")
+	stateFile := filepath.Join(t.TempDir(), "nodes.json")
+
+	p := NewNodePool(WithNodeConfigs(node, node2), WithLogger(logger), WithStateFile(stateFile))
+	if err := p.Cordon(node.endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.StartDrain(node2.endpoint); err != nil {
+		t.Fatal(err)
+	}
+	// The node is drained as if its objects have been copied.
+	if err := p.setState(node2.endpoint, NodeStateDrained, NodeStateDraining); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Remove(node2.endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewNodePool(WithNodeConfigs(node, node2), WithLogger(logger), WithStateFile(stateFile))
+	if err := restarted.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.NodeState(node.endpoint); got != NodeStateCordoned {
+		t.Errorf("got node state %s, want %s", got, NodeStateCordoned)
+	}
+	if got := restarted.NodeState(node2.endpoint); got != NodeStateRemoved {
+		t.Errorf("got node state %s, want %s", got, NodeStateRemoved)
+	}
+	for _, n := range restarted.Ring() {
+		if n.ID == node2.endpoint {
+			t.Errorf("got removed node %s on the ring", n.ID)
+		}
+	}
+}
+
+func TestNodePoolInheritStates(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	node := NewNodeConfig("127.0.0.1:1", "mykey", "mysecret")
+	node2 := NewNodeConfig("127.0.0.1:2", "mykey", "mysecret")
+
+	p := NewNodePool(WithNodeConfigs(node, node2), WithLogger(logger))
+	if err := p.Cordon(node.endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.StartDrain(node2.endpoint); err != nil {
+		t.Fatal(err)
+	}
+	// The node is drained as if its objects have been copied.
+	if err := p.setState(node2.endpoint, NodeStateDrained, NodeStateDraining); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Remove(node2.endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewNodePool(WithNodeConfigs(node, node2), WithLogger(logger))
+	reloaded.InheritStates(p)
+	if got := reloaded.NodeState(node.endpoint); got != NodeStateCordoned {
+		t.Errorf("got node state %s, want %s", got, NodeStateCordoned)
+	}
+	if got := reloaded.NodeState(node2.endpoint); got != NodeStateRemoved {
+		t.Errorf("got node state %s, want %s", got, NodeStateRemoved)
+	}
+	for _, n := range reloaded.Ring() {
+		if n.ID == node2.endpoint {
+			t.Errorf("got removed node %s on the ring", n.ID)
+		}
+	}
+
+	// The node states of the previous node pool don't change with the new one.
+	if err := reloaded.Uncordon(node.endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.NodeState(node.endpoint); got != NodeStateCordoned {
+		t.Errorf("got node state %s on previous node pool, want %s", got, NodeStateCordoned)
+	}
+}
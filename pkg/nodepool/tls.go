@@ -0,0 +1,43 @@
+package nodepool
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+
+	"github.com/maxgio92/homework-object-storage/pkg/certs"
+)
+
+// nodeTransport returns the transport of the client of a node with TLS, which
+// verifies the node certificate as configured. The CA bundles are loaded once
+// per file, and cached in caPools.
+func nodeTransport(nodeTLS *NodeTLS, caPools map[string]*x509.CertPool) (http.RoundTripper, error) {
+	transport, err := minio.DefaultTransport(true)
+	if err != nil {
+		return nil, err
+	}
+
+	var rootCAs *x509.CertPool
+	if nodeTLS.CAFile != "" {
+		pool, ok := caPools[nodeTLS.CAFile]
+		if !ok {
+			if pool, err = certs.LoadCertPool(nodeTLS.CAFile); err != nil {
+				return nil, errors.Wrap(err, "error loading node ca bundle")
+			}
+			caPools[nodeTLS.CAFile] = pool
+		}
+		rootCAs = pool
+	}
+
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		RootCAs:            rootCAs,
+		ServerName:         nodeTLS.ServerName,
+		InsecureSkipVerify: nodeTLS.InsecureSkipVerify,
+	}
+
+	return transport, nil
+}
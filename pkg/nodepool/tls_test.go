@@ -0,0 +1,65 @@
+package nodepool
+
+import (
+	"context"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+)
+
+func TestNodePoolTLS(t *testing.T) {
+	srv := miniotest.NewTLSServer("default")
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		tls     NodeTLS
+		wantErr bool
+	}{
+		{name: "with pinned ca", tls: NodeTLS{CAFile: caFile}},
+		{name: "with pinned ca and server name", tls: NodeTLS{CAFile: caFile, ServerName: "example.com"}},
+		{name: "with pinned ca and other server name", tls: NodeTLS{CAFile: caFile, ServerName: "minio.test"}, wantErr: true},
+		{name: "with system roots", tls: NodeTLS{}, wantErr: true},
+		{name: "with insecure skip verify", tls: NodeTLS{InsecureSkipVerify: true}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := NewNodePool(
+				WithNodeConfigs(NewNodeConfig(srv.Endpoint(), miniotest.AccessKey, miniotest.SecretKey, WithTLS(tt.tls))),
+				WithLogger(logrus.New()),
+				WithHealthCheckRetries(1),
+				WithHealthCheckPeriod(0),
+			)
+			if err := pool.Init(); err != nil {
+				t.Fatal(err)
+			}
+			defer pool.Close()
+
+			_, err := pool.NodeClient(srv.Endpoint()).BucketExists(context.Background(), "default")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+
+	pool := NewNodePool(
+		WithNodeConfigs(NewNodeConfig(srv.Endpoint(), miniotest.AccessKey, miniotest.SecretKey,
+			WithTLS(NodeTLS{CAFile: filepath.Join(t.TempDir(), "missing.pem")}))),
+		WithLogger(logrus.New()),
+	)
+	if err := pool.Init(); err == nil {
+		pool.Close()
+		t.Error("got no error with missing ca bundle, want one")
+	}
+}
@@ -0,0 +1,89 @@
+package nodepool
+
+import (
+	"context"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// Usage is the storage used by objects.
+type Usage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+// usageObject is an object listed by a node, the latest among its replicas.
+type usageObject struct {
+	size         int64
+	lastModified time.Time
+}
+
+// Usage returns the storage used in the bucket by the objects with each of the
+// key prefixes, counting each object once across its replicas. The nodes not
+// available are skipped, as the replicas of their objects are counted.
+func (p *NodePool) Usage(ctx context.Context, bucket string, prefixes []string) (map[string]Usage, error) {
+	usage := make(map[string]Usage, len(prefixes))
+	for _, prefix := range prefixes {
+		objects := make(map[string]usageObject)
+		for _, c := range p.NodeConfigs() {
+			id := c.Endpoint()
+			if p.NodeCircuitState(id) == CircuitOpen {
+				continue
+			}
+			if err := p.listUsage(ctx, id, bucket, prefix, objects); err != nil {
+				return nil, err
+			}
+		}
+
+		var u Usage
+		for _, obj := range objects {
+			u.Bytes += obj.size
+			u.Objects++
+		}
+		usage[prefix] = u
+	}
+
+	return usage, nil
+}
+
+// newerReplica returns whether the object is newer than the current replica.
+// The larger one is, if they're modified at the same time, to the precision of
+// the listings.
+func newerReplica(obj minio.ObjectInfo, current usageObject) bool {
+	if obj.LastModified.Equal(current.lastModified) {
+		return obj.Size > current.size
+	}
+
+	return obj.LastModified.After(current.lastModified)
+}
+
+// listUsage adds the objects with the key prefix the node stores in the bucket
+// to objects, replacing their older replicas.
+func (p *NodePool) listUsage(ctx context.Context, id, bucket, prefix string, objects map[string]usageObject) error {
+	client := p.NodeClient(id)
+	if client == nil {
+		return errors.Wrapf(ErrNodeNotFound, "node %s", id)
+	}
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return errors.Wrapf(err, "error checking bucket of node %s", id)
+	}
+	if !exists {
+		return nil
+	}
+
+	for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return errors.Wrapf(obj.Err, "error listing objects of node %s", id)
+		}
+		if current, ok := objects[obj.Key]; ok && !newerReplica(obj, current) {
+			continue
+		}
+		objects[obj.Key] = usageObject{size: obj.Size, lastModified: obj.LastModified}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package nodepool
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/maxgio92/homework-object-storage/internal/miniotest"
+)
+
+func TestNodePoolUsage(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	servers := []*miniotest.Server{miniotest.NewServer("default"), miniotest.NewServer()}
+	configs := make([]*NodeConfig, len(servers))
+	for i, srv := range servers {
+		defer srv.Close()
+		configs[i] = NewNodeConfig(srv.Endpoint(), miniotest.AccessKey, miniotest.SecretKey)
+	}
+	// The replicas are counted once, the latest one.
+	servers[0].PutObject("default", "a1", []byte("hi"))
+	servers[0].PutObject("default", "a2", []byte("hello"))
+	servers[0].PutObject("default", "b1", []byte("hello"))
+	servers[1].PutObject("default", "a1", []byte("hello world"))
+
+	pool := NewNodePool(WithNodeConfigs(configs...), WithLogger(logger), WithHealthCheckPeriod(0))
+	if err := pool.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	usage, err := pool.Usage(context.Background(), "default", []string{"", "a", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Usage{
+		"":  {Bytes: 21, Objects: 3},
+		"a": {Bytes: 16, Objects: 2},
+		"c": {},
+	}
+	for prefix, w := range want {
+		if got := usage[prefix]; got != w {
+			t.Errorf("got usage of prefix %q %+v, want %+v", prefix, got, w)
+		}
+	}
+
+	// The usage doesn't take the trial request of a half-open circuit, as it
+	// doesn't report its results.
+	openCircuit(pool, servers[1].Endpoint())
+	if _, err := pool.Usage(context.Background(), "default", []string{""}); err != nil {
+		t.Fatal(err)
+	}
+	if !pool.NodeAvailable(servers[1].Endpoint()) {
+		t.Error("got trial request taken by the usage")
+	}
+}
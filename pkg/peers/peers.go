@@ -0,0 +1,121 @@
+package peers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/maxgio92/consistenthash"
+)
+
+const (
+	defaultVirtualNodes = 64
+)
+
+// Peers is the hash ring of the peer gateways, which share the ownership of
+// the cached objects: each object is cached by the peer owning its key, which
+// the other peers forward its reads to.
+// All the methods are safe to call on a nil Peers, whose self owns every key.
+type Peers struct {
+	// virtualNodes is the number of positions of each peer on the ring.
+	virtualNodes int
+
+	// self is the URL of the gateway itself, which owns every key when empty.
+	self string
+	urls []string
+
+	ring        *consistenthash.Ring
+	ringIdToURL map[string]string
+	mu          sync.RWMutex
+}
+
+type Option func(p *Peers)
+
+// WithVirtualNodes sets the number of virtual nodes of each peer on the ring.
+func WithVirtualNodes(n int) Option {
+	return func(p *Peers) {
+		p.virtualNodes = n
+	}
+}
+
+// New returns new Peers, without any peer.
+func New(opts ...Option) *Peers {
+	p := &Peers{
+		virtualNodes: defaultVirtualNodes,
+		ring:         consistenthash.NewRing(),
+		ringIdToURL:  make(map[string]string),
+	}
+
+	for _, f := range opts {
+		f(p)
+	}
+
+	return p
+}
+
+// Set replaces the peers with the ones at the URLs, and the gateway itself at
+// self, which is added to them if missing. The gateway owns every key when
+// self is empty, e.g. when it's not found among the peers.
+func (p *Peers) Set(self string, urls []string) {
+	if p == nil {
+		return
+	}
+
+	seen := make(map[string]struct{}, len(urls)+1)
+	members := make([]string, 0, len(urls)+1)
+	for _, url := range append([]string{self}, urls...) {
+		if _, ok := seen[url]; ok || url == "" {
+			continue
+		}
+		seen[url] = struct{}{}
+		members = append(members, url)
+	}
+	sort.Strings(members)
+
+	// The ring is built aside, so that the keys are looked up meanwhile.
+	ring := consistenthash.NewRing()
+	ringIdToURL := make(map[string]string, len(members)*p.virtualNodes)
+	for _, url := range members {
+		for i := 0; i < p.virtualNodes; i++ {
+			id := fmt.Sprintf("%s#%d", url, i)
+			ring.AddNode(id)
+			ringIdToURL[id] = url
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.self = self
+	p.urls = members
+	p.ring = ring
+	p.ringIdToURL = ringIdToURL
+}
+
+// Owner returns the URL of the peer owning the key, and whether it's the
+// gateway itself.
+func (p *Peers) Owner(key string) (url string, self bool) {
+	if p == nil {
+		return "", true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.self == "" || len(p.ring.Nodes) == 0 {
+		return p.self, true
+	}
+	url = p.ringIdToURL[p.ring.Get(key)]
+
+	return url, url == p.self
+}
+
+// URLs returns the URLs of the peers, including the gateway itself.
+func (p *Peers) URLs() []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return append([]string(nil), p.urls...)
+}
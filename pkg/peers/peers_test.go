@@ -0,0 +1,62 @@
+package peers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPeers(t *testing.T) {
+	p := New()
+	if _, self := p.Owner("foo"); !self {
+		t.Error("got foo owned by a peer without peers, want self")
+	}
+
+	p.Set("http://b:3000", []string{"http://a:3000", "http://b:3000", "http://c:3000"})
+	want := []string{"http://a:3000", "http://b:3000", "http://c:3000"}
+	if got := p.URLs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got peers %v, want %v", got, want)
+	}
+
+	owners := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		url, self := p.Owner(fmt.Sprintf("default/%d", i))
+		if self != (url == "http://b:3000") {
+			t.Errorf("got owner %s and self %t", url, self)
+		}
+		owners[url]++
+	}
+	for _, url := range want {
+		if owners[url] == 0 {
+			t.Errorf("got no keys owned by %s", url)
+		}
+	}
+
+	// The other peers agree on the owners of the keys.
+	other := New()
+	other.Set("http://a:3000", []string{"http://c:3000", "http://b:3000"})
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("default/%d", i)
+		got, _ := other.Owner(key)
+		if want, _ := p.Owner(key); got != want {
+			t.Errorf("got owner %s of %s, want %s", got, key, want)
+		}
+	}
+
+	// The gateway owns every key when it's not among the peers.
+	p.Set("", []string{"http://a:3000"})
+	if _, self := p.Owner("foo"); !self {
+		t.Error("got foo owned by a peer without self, want self")
+	}
+}
+
+func TestPeersNil(t *testing.T) {
+	var p *Peers
+	p.Set("http://a:3000", nil)
+	if _, self := p.Owner("foo"); !self {
+		t.Error("got foo owned by a peer of nil peers, want self")
+	}
+	if urls := p.URLs(); urls != nil {
+		t.Errorf("got peers %v, want none", urls)
+	}
+}
@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+const (
+	DefaultServiceName = "object-storage-gateway"
+
+	defaultSampleRatio = 1
+)
+
+var (
+	ErrEndpointMissing = errors.New("tracing endpoint missing")
+)
+
+// TracerProvider builds OpenTelemetry tracer providers, exporting the spans
+// with OTLP over HTTP, or with the exporter, e.g. in-memory in tests.
+type TracerProvider struct {
+	endpoint    string
+	insecure    bool
+	sampleRatio float64
+	serviceName string
+	exporter    sdktrace.SpanExporter
+}
+
+type Option func(p *TracerProvider)
+
+// WithEndpoint sets the host:port address of the OTLP collector.
+func WithEndpoint(endpoint string) Option {
+	return func(p *TracerProvider) {
+		p.endpoint = endpoint
+	}
+}
+
+// WithInsecure disables TLS to the OTLP collector.
+func WithInsecure(insecure bool) Option {
+	return func(p *TracerProvider) {
+		p.insecure = insecure
+	}
+}
+
+// WithSampleRatio sets the ratio of the traces sampled, when the parent span
+// doesn't tell.
+func WithSampleRatio(ratio float64) Option {
+	return func(p *TracerProvider) {
+		p.sampleRatio = ratio
+	}
+}
+
+func WithServiceName(name string) Option {
+	return func(p *TracerProvider) {
+		p.serviceName = name
+	}
+}
+
+// WithExporter sets the exporter of the spans, instead of the OTLP one.
+func WithExporter(exporter sdktrace.SpanExporter) Option {
+	return func(p *TracerProvider) {
+		p.exporter = exporter
+	}
+}
+
+// NewTracerProvider returns a new OpenTelemetry tracer provider.
+// It must be shut down to flush the spans.
+func NewTracerProvider(ctx context.Context, opts ...Option) (*sdktrace.TracerProvider, error) {
+	p := &TracerProvider{
+		sampleRatio: defaultSampleRatio,
+		serviceName: DefaultServiceName,
+	}
+
+	for _, f := range opts {
+		f(p)
+	}
+
+	exporter := p.exporter
+	if exporter == nil {
+		if p.endpoint == "" {
+			return nil, ErrEndpointMissing
+		}
+
+		clientOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(p.endpoint)}
+		if p.insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+
+		var err error
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "error building otlp exporter")
+		}
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(p.serviceName),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "error building tracing resource")
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(p.sampleRatio))),
+	), nil
+}
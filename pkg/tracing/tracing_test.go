@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewTracerProvider(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+
+	testCases := []struct {
+		name      string
+		given     []Option
+		wantErr   error
+		wantSpans int
+	}{
+		{name: "without endpoint", given: []Option{}, wantErr: ErrEndpointMissing},
+		{name: "with endpoint", given: []Option{WithEndpoint("localhost:4318"), WithInsecure(true)}},
+		{name: "with exporter", given: []Option{WithExporter(exporter)}, wantSpans: 1},
+		{name: "with exporter not sampling", given: []Option{WithExporter(exporter), WithSampleRatio(0)}, wantSpans: 0},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+
+			tp, err := NewTracerProvider(context.Background(), tt.given...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			_, span := tp.Tracer("test").Start(context.Background(), "span")
+			span.End()
+			if err = tp.ForceFlush(context.Background()); err != nil && tt.wantSpans > 0 {
+				t.Fatal(err)
+			}
+
+			if got := len(exporter.GetSpans()); got != tt.wantSpans {
+				t.Errorf("got %d spans, want %d", got, tt.wantSpans)
+			}
+		})
+	}
+}